@@ -0,0 +1,40 @@
+package core
+
+import (
+	"time"
+
+	"github.com/govdbot/govd/enums"
+	"github.com/govdbot/govd/models"
+	"github.com/govdbot/govd/util"
+
+	"go.uber.org/zap"
+)
+
+// SetClip makes the format download only the clip. its duration
+// and estimated size become the ones of the clip, so that the
+// instance limits are checked against what is downloaded
+func SetClip(format *models.MediaFormat, clip *models.Clip) error {
+	if format.Type == enums.MediaTypePhoto || format.IsLive {
+		return nil
+	}
+	duration := format.Duration
+	if duration > 0 {
+		if clip.Start >= time.Duration(duration)*time.Second {
+			return util.ErrInvalidClip
+		}
+		clipDuration := int64(clip.Duration(duration).Seconds())
+		format.FileSize = format.FileSize * clipDuration / duration
+		format.Duration = clipDuration
+	}
+	zap.S().Debugf(
+		"clipping %s from %s to %s",
+		format.FormatID, clip.Start, clip.End,
+	)
+
+	// mp4 videos are re-encoded to h264 when cut
+	if format.Type == enums.MediaTypeVideo && format.VideoCodec == enums.MediaCodecHEVC {
+		format.VideoCodec = enums.MediaCodecAVC
+	}
+	format.DownloadConfig.Clip = clip
+	return nil
+}
@@ -6,7 +6,9 @@ import (
 
 	"github.com/govdbot/govd/config"
 	"github.com/govdbot/govd/database"
+	"github.com/govdbot/govd/enums"
 	"github.com/govdbot/govd/models"
+	"github.com/govdbot/govd/plugins"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
@@ -20,7 +22,8 @@ func HandleDefaultFormatDownload(
 	taskCtx context.Context,
 	dlCtx *models.DownloadContext,
 ) error {
-	if config.Env.Caching {
+	// stored medias have no subtitles
+	if config.Env().Caching && dlCtx.SubtitlesMode == enums.SubtitlesModeNone {
 		storedMedias, err := database.GetDefaultMedias(
 			dlCtx.Extractor.CodeName,
 			dlCtx.MatchedContentID,
@@ -29,7 +32,11 @@ func HandleDefaultFormatDownload(
 			return err
 		}
 
-		if len(storedMedias) > 0 {
+		if len(storedMedias) > 0 && canSendStoredMedias(dlCtx, storedMedias) {
+			err = ValidateStoredMedias(dlCtx, storedMedias)
+			if err != nil {
+				return err
+			}
 			zap.S().Debugf(
 				"found %d stored medias for %s (%s)",
 				len(storedMedias),
@@ -57,7 +64,23 @@ func HandleDefaultFormatDownload(
 		return nil
 	}
 
-	err = ValidateMediaList(mediaList)
+	err = ValidateMediaList(dlCtx, mediaList)
+	if err != nil {
+		return err
+	}
+	err = ValidateSubtitles(dlCtx, mediaList)
+	if err != nil {
+		return err
+	}
+	err = ValidateNotes(dlCtx, mediaList)
+	if err != nil {
+		return err
+	}
+	SetRecordDuration(dlCtx, mediaList)
+	slideshowDelay := GetSlideshowDelay(dlCtx, mediaList)
+	isCacheable := IsCacheable(dlCtx, mediaList)
+
+	mediaList, err = RunPreDownloadPlugins(taskCtx, dlCtx, mediaList)
 	if err != nil {
 		return err
 	}
@@ -71,47 +94,75 @@ func HandleDefaultFormatDownload(
 		return errors.New("no formats downloaded")
 	}
 
+	if slideshowDelay > 0 {
+		slideshow, err := RenderSlideshow(taskCtx, medias, slideshowDelay)
+		if err != nil {
+			return err
+		}
+		medias = []*models.DownloadedMedia{slideshow}
+	}
+
+	// post-download plugins process the media before anything
+	// else, for things like merging audio and video, etc.
+	medias, err = RunPlugins(taskCtx, dlCtx, enums.PluginStagePostDownload, medias)
+	if err != nil {
+		return err
+	}
+
+	var subtitlePaths []string
+	switch dlCtx.SubtitlesMode {
+	case enums.SubtitlesModeEmbed:
+		err = EmbedSubtitles(taskCtx, dlCtx, medias)
+		if err != nil {
+			return err
+		}
+	case enums.SubtitlesModeDocument:
+		subtitlePaths, err = DownloadSubtitles(taskCtx, dlCtx, medias)
+		if err != nil {
+			return err
+		}
+	}
+
+	medias, err = RunPlugins(taskCtx, dlCtx, enums.PluginStagePreSend, medias)
+	if err != nil {
+		removeSubtitles(subtitlePaths)
+		return err
+	}
+
+	err = ConvertNotes(taskCtx, dlCtx, medias)
+	if err != nil {
+		removeSubtitles(subtitlePaths)
+		return err
+	}
+
+	// plugins may have changed the caption
 	isCaptionEnabled := true
 	if dlCtx.GroupSettings != nil && !*dlCtx.GroupSettings.Captions {
 		isCaptionEnabled = false
 	}
 	messageCaption := FormatCaption(
-		mediaList[0],
+		medias[0].Media,
 		isCaptionEnabled,
 	)
 
-	// plugins act as post-processing for the media.
-	// they are run after the media is downloaded
-	// and before it is sent to the user
-	// this allows for things like merging audio and video, etc.
-	for _, media := range medias {
-		format := media.Media.Format
-		zap.S().Debugf(
-			"running %d plugins for %s (%s)",
-			len(format.Plugins),
-			dlCtx.MatchedContentID,
-			dlCtx.Extractor.CodeName,
-		)
-		for _, plugin := range format.Plugins {
-			err = plugin(media, format.DownloadConfig)
-			if err != nil {
-				return fmt.Errorf("failed to run plugin: %w", err)
-			}
-		}
-	}
-
 	msgs, err := SendMedias(
 		bot, ctx, dlCtx,
 		medias,
 		&models.SendMediaFormatsOptions{
-			Caption:  messageCaption,
-			IsStored: false,
+			Caption:   messageCaption,
+			SkipStore: !isCacheable,
 		},
 	)
 	if err != nil {
+		removeSubtitles(subtitlePaths)
 		return fmt.Errorf("failed to send formats: %w", err)
 	}
 
+	err = SendSubtitles(bot, ctx, subtitlePaths)
+	if err != nil {
+		return err
+	}
+
 	zap.S().Debugf(
 		"sent %d medias for %s (%s)",
 		len(msgs),
@@ -157,3 +208,65 @@ func HandleDefaultStoredFormatDownload(
 	}
 	return nil
 }
+
+// stored medias are sent with the default settings: albums
+// are not rendered as slideshows, photos are compressed,
+// videos are not clipped or converted to notes and audios
+// are not processed
+func canSendStoredMedias(
+	dlCtx *models.DownloadContext,
+	storedMedias []*models.Media,
+) bool {
+	if dlCtx.Clip != nil || dlCtx.NoteMode != enums.NoteModeNone {
+		return false
+	}
+	if IsSlideshowEnabled(dlCtx) && isPhotoAlbum(storedMedias) {
+		return false
+	}
+	if plugins.IsAudioProcessingEnabled(dlCtx.GroupSettings) &&
+		hasMediaType(storedMedias, enums.MediaTypeAudio) {
+		return false
+	}
+	if dlCtx.SendOriginals {
+		for _, media := range storedMedias {
+			format := media.Format
+			if format != nil && format.Type == enums.MediaTypePhoto && !format.IsDocument {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// IsCacheable reports whether the medias can be stored as
+// the default format of the content. live recordings, slideshows,
+// original photos, clips, processed audios, notes and videos with
+// embedded subtitles depend on the request or the group settings.
+// must be called before the pre-download plugins run
+func IsCacheable(dlCtx *models.DownloadContext, mediaList []*models.Media) bool {
+	for _, media := range mediaList {
+		if media.Format != nil && media.Format.IsLive {
+			return false
+		}
+	}
+	switch {
+	case GetSlideshowDelay(dlCtx, mediaList) > 0,
+		dlCtx.SendOriginals && hasMediaType(mediaList, enums.MediaTypePhoto),
+		dlCtx.Clip != nil,
+		plugins.IsAudioProcessingEnabled(dlCtx.GroupSettings) &&
+			hasMediaType(mediaList, enums.MediaTypeAudio),
+		dlCtx.NoteMode != enums.NoteModeNone,
+		dlCtx.SubtitlesMode == enums.SubtitlesModeEmbed:
+		return false
+	}
+	return true
+}
+
+func hasMediaType(mediaList []*models.Media, mediaType enums.MediaType) bool {
+	for _, media := range mediaList {
+		if media.Format != nil && media.Format.Type == mediaType {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -12,8 +13,10 @@ import (
 	"github.com/govdbot/govd/enums"
 	"github.com/govdbot/govd/models"
 	"github.com/govdbot/govd/util"
+	"github.com/govdbot/govd/util/libav"
 
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
 )
 
 func DownloadMediaItem(
@@ -50,11 +53,45 @@ func DownloadMediaItem(
 		if err != nil {
 			return nil, fmt.Errorf("failed to download image: %w", err)
 		}
-		path := filepath.Join(config.Env.DownloadsDirectory, fileName)
-		if err := util.ImgToJPEG(file, path); err != nil {
-			return nil, fmt.Errorf("failed to convert image: %w", err)
+		isAnimated, err := util.IsAnimatedImage(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect image format: %w", err)
+		}
+		var photo io.ReadSeeker = file
+		if isAnimated {
+			// gifs are sent as animations, not as still photos
+			filePath, thumbnailFilePath, err = SaveAnimation(ctx, format, file, downloadConfig)
+			if err == nil {
+				cleanup = false
+				return &models.DownloadedMedia{
+					FilePath:          filePath,
+					ThumbnailFilePath: thumbnailFilePath,
+					Media:             media,
+					Index:             idx,
+				}, nil
+			}
+			if !errors.Is(err, errAnimationConversion) {
+				return nil, err
+			}
+			// e.g. ffmpeg builds that can't decode animated webp
+			zap.S().Warnf("sending first frame of animation: %v", err)
+			photo, err = util.GetFirstFrame(file)
+			if err != nil {
+				return nil, err
+			}
+		}
+		path, err := SavePhoto(format, photo)
+		if err != nil {
+			return nil, err
 		}
 		filePath = path
+		if format.IsDocument {
+			path, err := GetFileThumbnail(ctx, format, filePath, downloadConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get thumbnail: %w", err)
+			}
+			thumbnailFilePath = path
+		}
 		cleanup = false
 		return &models.DownloadedMedia{
 			FilePath:          filePath,
@@ -65,7 +102,23 @@ func DownloadMediaItem(
 	}
 
 	// hndle non-photo (video/audio/other)
-	if len(format.Segments) == 0 {
+	ctx, releaseSpace, err := util.ReserveDiskSpace(ctx, format.GetEstimatedFileSize())
+	if err != nil {
+		return nil, err
+	}
+	// once downloaded, the file itself accounts for its space
+	defer releaseSpace()
+
+	if format.LivePlaylist != nil {
+		path, err := util.RecordLiveStream(
+			ctx, format.LivePlaylist,
+			fileName, downloadConfig,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record live stream: %w", err)
+		}
+		filePath = path
+	} else if len(format.Segments) == 0 {
 		path, err := util.DownloadFile(ctx, format.URL, fileName, downloadConfig)
 		if err != nil {
 			return nil, fmt.Errorf("failed to download file: %w", err)
@@ -95,7 +148,7 @@ func DownloadMediaItem(
 		InsertVideoInfo(format, filePath)
 
 		// check if the extracted video duration exceeds limit
-		if util.ExceedsMaxDuration(format.Duration) {
+		if util.ExceedsMaxDuration(format.Duration, downloadConfig) {
 			return nil, util.ErrDurationTooLong
 		}
 	}
@@ -109,6 +162,111 @@ func DownloadMediaItem(
 	}, nil
 }
 
+// SavePhoto saves the image as a jpeg photo. documents keep the
+// original file: photos in originals mode, and images telegram
+// would reject as photos for their size or aspect ratio
+func SavePhoto(format *models.MediaFormat, file io.ReadSeeker) (string, error) {
+	imageFormat, err := util.DetectImageFormat(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to detect image format: %w", err)
+	}
+	format.FileExt = util.GetImageExtension(imageFormat)
+
+	if !format.IsDocument {
+		width, height, err := util.CheckImageLimits(file, imageFormat)
+		if err != nil {
+			return "", err
+		}
+		format.IsDocument = util.ExceedsPhotoLimits(width, height)
+	}
+	if !format.IsDocument {
+		path := filepath.Join(config.Env().DownloadsDirectory, format.GetFileName())
+		if err := util.ImgToJPEG(file, path); err != nil {
+			return "", fmt.Errorf("failed to convert image: %w", err)
+		}
+		info, err := os.Stat(path)
+		if err == nil && info.Size() <= util.TelegramPhotoMaxSize {
+			return path, nil
+		}
+		os.Remove(path)
+		format.IsDocument = true
+	}
+
+	zap.S().Debugf("sending %s image as document", imageFormat)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to reset file position: %w", err)
+	}
+	path := filepath.Join(config.Env().DownloadsDirectory, format.GetFileName())
+	output, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	_, err = io.Copy(output, file)
+	output.Close()
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write image: %w", err)
+	}
+	return path, nil
+}
+
+// returned by SaveAnimation when ffmpeg can't convert the image
+var errAnimationConversion = errors.New("animation not supported")
+
+// SaveAnimation converts an animated image into a silent mp4,
+// turning its photo format into an animation one. returns the
+// paths of the video and of its thumbnail
+func SaveAnimation(
+	ctx context.Context,
+	format *models.MediaFormat,
+	file io.ReadSeeker,
+	downloadConfig *models.DownloadConfig,
+) (string, string, error) {
+	imageFormat, err := util.DetectImageFormat(file)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to detect image format: %w", err)
+	}
+	// frames have the size of the image
+	if _, _, err := util.CheckImageLimits(file, imageFormat); err != nil {
+		return "", "", err
+	}
+
+	inputFile, err := os.CreateTemp(config.Env().DownloadsDirectory, "animation")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(inputFile.Name())
+	_, err = io.Copy(inputFile, file)
+	inputFile.Close()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to write image: %w", err)
+	}
+
+	videoCodec, audioCodec := format.VideoCodec, format.AudioCodec
+	format.Type = enums.MediaTypeVideo
+	format.VideoCodec = enums.MediaCodecAVC
+	format.AudioCodec = ""
+	format.IsAnimation = true
+
+	filePath := filepath.Join(config.Env().DownloadsDirectory, format.GetFileName())
+	if err := libav.ConvertToAnimation(inputFile.Name(), filePath); err != nil {
+		// the caller can still send it as a photo
+		format.Type = enums.MediaTypePhoto
+		format.VideoCodec = videoCodec
+		format.AudioCodec = audioCodec
+		format.IsAnimation = false
+		return "", "", fmt.Errorf("%w: %w", errAnimationConversion, err)
+	}
+	InsertVideoInfo(format, filePath)
+
+	thumbnailFilePath, err := GetFileThumbnail(ctx, format, filePath, downloadConfig)
+	if err != nil {
+		os.Remove(filePath)
+		return "", "", fmt.Errorf("failed to get thumbnail: %w", err)
+	}
+	return filePath, thumbnailFilePath, nil
+}
+
 func StartDownloadTask(
 	ctx context.Context,
 	media *models.Media,
@@ -105,6 +105,10 @@ func HandleInline(
 		if len(cached) > 1 {
 			return util.ErrInlineMediaGroup
 		}
+		err = ValidateStoredMedias(dlCtx, cached)
+		if err != nil {
+			return err
+		}
 		err = HandleInlineCached(
 			bot, ctx, cached[0],
 		)
@@ -150,6 +154,14 @@ func HandleInlineCached(
 			Caption:     mediaCaption,
 			ParseMode:   gotgbot.ParseModeHTML,
 		}
+	case "animation":
+		result = &gotgbot.InlineQueryResultCachedMpeg4Gif{
+			Id:          resultID,
+			Mpeg4FileId: format.FileID,
+			Title:       resultTitle,
+			Caption:     mediaCaption,
+			ParseMode:   gotgbot.ParseModeHTML,
+		}
 	case "audio":
 		result = &gotgbot.InlineQueryResultCachedAudio{
 			Id:          resultID,
@@ -269,14 +281,26 @@ func GetInlineFormat(
 		errChan <- util.ErrInlineMediaGroup
 		return
 	}
+	if format := mediaList[0].Format; format != nil && format.IsLive {
+		// recordings are cut to the requested
+		// duration, which can't be set inline
+		errChan <- util.ErrInlineLiveStream
+		return
+	}
 
-	err = ValidateMediaList(mediaList)
+	err = ValidateMediaList(dlCtx, mediaList)
 	if err != nil {
 		errChan <- err
 		return
 	}
 
-	messageCaption := FormatCaption(mediaList[0], true)
+	isCacheable := IsCacheable(dlCtx, mediaList)
+
+	mediaList, err = RunPreDownloadPlugins(taskCtx, dlCtx, mediaList)
+	if err != nil {
+		errChan <- err
+		return
+	}
 
 	medias, err := DownloadMedias(taskCtx, mediaList)
 	if err != nil {
@@ -284,31 +308,25 @@ func GetInlineFormat(
 		return
 	}
 
-	// plugins act as post-processing for the media.
-	// they are run after the media is downloaded
-	// and before it is sent to the user
-	// this allows for things like merging audio and video, etc.
-	for _, media := range medias {
-		format := media.Media.Format
-		zap.S().Debugf(
-			"running %d plugins for %s (%s)",
-			len(format.Plugins),
-			dlCtx.MatchedContentID,
-			dlCtx.Extractor.CodeName,
-		)
-		for _, plugin := range format.Plugins {
-			err = plugin(media, format.DownloadConfig)
-			if err != nil {
-				errChan <- fmt.Errorf("failed to run plugin: %w", err)
-				return
-			}
+	// there is no processing between the post-download
+	// and pre-send plugins for inline results
+	for _, stage := range []enums.PluginStage{
+		enums.PluginStagePostDownload,
+		enums.PluginStagePreSend,
+	} {
+		medias, err = RunPlugins(taskCtx, dlCtx, stage, medias)
+		if err != nil {
+			errChan <- err
+			return
 		}
 	}
+	messageCaption := FormatCaption(medias[0].Media, true)
 
 	msgs, err := SendMedias(
 		bot, ctx, dlCtx,
 		medias, &models.SendMediaFormatsOptions{
-			Caption: messageCaption,
+			Caption:   messageCaption,
+			SkipStore: !isCacheable,
 		},
 	)
 	if err != nil {
@@ -0,0 +1,26 @@
+package core
+
+import (
+	"github.com/govdbot/govd/models"
+)
+
+// SetRecordDuration applies the user-given recording limit
+// to live formats. returns whether any format is live
+func SetRecordDuration(
+	dlCtx *models.DownloadContext,
+	mediaList []*models.Media,
+) bool {
+	var isLive bool
+	for _, media := range mediaList {
+		format := media.Format
+		if format == nil || !format.IsLive {
+			continue
+		}
+		isLive = true
+		maxDuration := format.DownloadConfig.MaxDuration
+		if dlCtx.RecordDuration > 0 && (maxDuration <= 0 || dlCtx.RecordDuration < maxDuration) {
+			format.DownloadConfig.MaxDuration = dlCtx.RecordDuration
+		}
+	}
+	return isLive
+}
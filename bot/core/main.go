@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"slices"
 	"time"
 
 	"github.com/pkg/errors"
@@ -83,11 +82,9 @@ func SendMedias(
 
 	var sentMessages []gotgbot.Message
 
-	mediaGroupChunks := slices.Collect(
-		slices.Chunk(medias, 10),
-	)
+	mediaGroupChunks := GetMediaGroupChunks(medias)
 
-	for _, chunk := range mediaGroupChunks {
+	for chunkIdx, chunk := range mediaGroupChunks {
 		var inputMediaList []gotgbot.InputMedia
 		for idx, media := range chunk {
 			// always clean up files, in case of error
@@ -99,6 +96,10 @@ func SendMedias(
 					os.Remove(media.ThumbnailFilePath)
 				}
 			}()
+			if media.Media.Format.IsNote() {
+				// sent on its own, see SendNote
+				continue
+			}
 			var caption string
 
 			if idx == 0 {
@@ -116,14 +117,37 @@ func SendMedias(
 			inputMediaList = append(inputMediaList, inputMedia)
 		}
 		mediaType := chunk[0].Media.Format.Type
-		SendingEffect(bot, chatID, mediaType)
-		msgs, err := bot.SendMediaGroup(
-			chatID,
-			inputMediaList,
-			messageOptions,
-		)
-		if err != nil {
-			return nil, err
+		if !chunk[0].Media.Format.IsNote() {
+			SendingEffect(bot, chatID, mediaType)
+		}
+		var msgs []gotgbot.Message
+		var err error
+		if chunk[0].Media.Format.IsNote() {
+			// notes are sent one by one, only the first has the caption
+			var caption string
+			if chunkIdx == 0 {
+				caption = options.Caption
+			}
+			msg, err := SendNote(bot, chatID, chunk[0], caption, messageOptions)
+			if err != nil {
+				return nil, err
+			}
+			msgs = []gotgbot.Message{*msg}
+		} else if animation, ok := inputMediaList[0].(*gotgbot.InputMediaAnimation); ok {
+			msg, err := SendAnimation(bot, chatID, animation, messageOptions)
+			if err != nil {
+				return nil, err
+			}
+			msgs = []gotgbot.Message{*msg}
+		} else {
+			msgs, err = bot.SendMediaGroup(
+				chatID,
+				inputMediaList,
+				messageOptions,
+			)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		sentMessages = append(sentMessages, msgs...)
@@ -137,14 +161,77 @@ func SendMedias(
 		return nil, errors.New("no messages sent")
 	}
 	if !options.IsStored {
-		err := StoreMedias(
-			dlCtx,
-			sentMessages,
-			medias,
-		)
+		err := SetMediaFileIDs(sentMessages, medias)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !options.IsStored && !options.SkipStore {
+		err := StoreMedias(dlCtx, medias)
 		if err != nil {
 			return nil, fmt.Errorf("failed to cache formats: %w", err)
 		}
 	}
 	return sentMessages, nil
 }
+
+// GetMediaGroupChunks splits the medias into groups of up to 10,
+// keeping their order. documents and audios can only be grouped
+// with medias of the same kind, and animations, voice messages and
+// video notes can't be part of media groups, so each one is in a
+// group of its own
+func GetMediaGroupChunks(medias []*models.DownloadedMedia) [][]*models.DownloadedMedia {
+	var chunks [][]*models.DownloadedMedia
+	var chunk []*models.DownloadedMedia
+	var chunkKind string
+	for _, media := range medias {
+		kind := getMediaGroupKind(media.Media.Format)
+		if len(chunk) > 0 && (kind != chunkKind || isSentAlone(kind) || len(chunk) == 10) {
+			chunks = append(chunks, chunk)
+			chunk = nil
+		}
+		chunk = append(chunk, media)
+		chunkKind = kind
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// photos and videos can be mixed in media groups
+func getMediaGroupKind(format *models.MediaFormat) string {
+	_, inputMediaType := format.GetFormatInfo()
+	if inputMediaType == "photo" || inputMediaType == "video" {
+		return "visual"
+	}
+	return inputMediaType
+}
+
+func isSentAlone(kind string) bool {
+	return kind == "animation" || kind == "voice" || kind == "video_note"
+}
+
+// SendAnimation sends an animation on its own,
+// with the options of the media group it replaces
+func SendAnimation(
+	bot *gotgbot.Bot,
+	chatID int64,
+	animation *gotgbot.InputMediaAnimation,
+	options *gotgbot.SendMediaGroupOpts,
+) (*gotgbot.Message, error) {
+	animationOptions := &gotgbot.SendAnimationOpts{
+		Duration:   animation.Duration,
+		Width:      animation.Width,
+		Height:     animation.Height,
+		Thumbnail:  animation.Thumbnail,
+		Caption:    animation.Caption,
+		ParseMode:  animation.ParseMode,
+		HasSpoiler: animation.HasSpoiler,
+	}
+	if options != nil {
+		animationOptions.ReplyParameters = options.ReplyParameters
+		animationOptions.DisableNotification = options.DisableNotification
+	}
+	return bot.SendAnimation(chatID, animation.Media, animationOptions)
+}
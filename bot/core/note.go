@@ -0,0 +1,215 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/govdbot/govd/enums"
+	"github.com/govdbot/govd/models"
+	"github.com/govdbot/govd/util"
+	"github.com/govdbot/govd/util/libav"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"go.uber.org/zap"
+)
+
+// telegram shows video notes in a circle
+// of up to 640px, larger ones are refused
+const videoNoteMaxLength = 640
+
+// ConvertNotes converts the downloaded medias into voice messages
+// or video notes, as requested with #voice and #round. medias that
+// can't be converted, like photos, are sent as they are
+func ConvertNotes(
+	ctx context.Context,
+	dlCtx *models.DownloadContext,
+	medias []*models.DownloadedMedia,
+) error {
+	var converted int
+	for _, media := range medias {
+		format := media.Media.Format
+		var err error
+		switch dlCtx.NoteMode {
+		case enums.NoteModeVoice:
+			if format.Type == enums.MediaTypePhoto || format.IsAnimation {
+				continue
+			}
+			err = convertToVoice(ctx, media)
+		case enums.NoteModeVideo:
+			if format.Type != enums.MediaTypeVideo {
+				continue
+			}
+			err = convertToVideoNote(ctx, media)
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		converted++
+	}
+	if converted == 0 {
+		return util.ErrNoteNotSupported
+	}
+	return nil
+}
+
+// ValidateNotes ensures that the videos to convert into video
+// notes are not longer than telegram allows. formats are already
+// clipped, videos of unknown duration are checked once downloaded
+func ValidateNotes(
+	dlCtx *models.DownloadContext,
+	mediaList []*models.Media,
+) error {
+	if dlCtx.NoteMode != enums.NoteModeVideo {
+		return nil
+	}
+	for _, media := range mediaList {
+		format := media.Format
+		if format == nil || format.Type != enums.MediaTypeVideo {
+			continue
+		}
+		duration := time.Duration(format.Duration) * time.Second
+		if duration == 0 && dlCtx.Clip != nil {
+			duration = dlCtx.Clip.Duration(0)
+		}
+		if duration > libav.VideoNoteMaxDuration*time.Second {
+			return util.ErrVideoNoteTooLong
+		}
+	}
+	return nil
+}
+
+func convertToVoice(ctx context.Context, media *models.DownloadedMedia) error {
+	format := media.Media.Format
+	outputPath := getNotePath(media.FilePath, "voice")
+	zap.S().Debugf("converting %s to voice message", format.FormatID)
+
+	err := libav.ConvertToVoice(ctx, media.FilePath, outputPath)
+	if err != nil {
+		return err
+	}
+	os.Remove(media.FilePath)
+	media.FilePath = outputPath
+
+	// voice messages have no thumbnail
+	if media.ThumbnailFilePath != "" {
+		os.Remove(media.ThumbnailFilePath)
+		media.ThumbnailFilePath = ""
+	}
+	format.Type = enums.MediaTypeAudio
+	format.VideoCodec = ""
+	format.AudioCodec = enums.MediaCodecOpus
+	format.IsVoice = true
+	return nil
+}
+
+func convertToVideoNote(ctx context.Context, media *models.DownloadedMedia) error {
+	format := media.Media.Format
+	outputPath := getNotePath(media.FilePath, "note")
+	if format.Duration > libav.VideoNoteMaxDuration {
+		return util.ErrVideoNoteTooLong
+	}
+	length := getVideoNoteLength(format)
+	zap.S().Debugf(
+		"converting %s to %dpx video note",
+		format.FormatID, length,
+	)
+
+	err := libav.ConvertToVideoNote(ctx, media.FilePath, outputPath, length)
+	if err != nil {
+		return err
+	}
+	os.Remove(media.FilePath)
+	media.FilePath = outputPath
+
+	format.VideoCodec = enums.MediaCodecAVC
+	format.Width = length
+	format.Height = length
+	format.IsAnimation = false
+	format.IsVideoNote = true
+	return nil
+}
+
+// side of the cropped square, which is never upscaled.
+// h264 needs it to be even
+func getVideoNoteLength(format *models.MediaFormat) int64 {
+	length := min(format.Width, format.Height)
+	if length <= 0 || length > videoNoteMaxLength {
+		length = videoNoteMaxLength
+	}
+	return length - length%2
+}
+
+func getNotePath(filePath string, suffix string) string {
+	extension := ".mp4"
+	if suffix == "voice" {
+		extension = ".ogg"
+	}
+	return strings.TrimSuffix(
+		filePath,
+		filepath.Ext(filePath),
+	) + "_" + suffix + extension
+}
+
+// SendNote sends a voice message or a video note on its own,
+// with the options of the media group it replaces. video
+// notes can't have a caption
+func SendNote(
+	bot *gotgbot.Bot,
+	chatID int64,
+	media *models.DownloadedMedia,
+	caption string,
+	options *gotgbot.SendMediaGroupOpts,
+) (*gotgbot.Message, error) {
+	format := media.Media.Format
+	file, err := os.Open(media.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	var replyParameters *gotgbot.ReplyParameters
+	var disableNotification bool
+	if options != nil {
+		replyParameters = options.ReplyParameters
+		disableNotification = options.DisableNotification
+	}
+	inputFile := gotgbot.InputFileByReader(filepath.Base(media.FilePath), file)
+
+	if format.IsVoice {
+		bot.SendChatAction(chatID, "upload_voice", nil)
+		return bot.SendVoice(chatID, inputFile, &gotgbot.SendVoiceOpts{
+			Caption:             caption,
+			ParseMode:           gotgbot.ParseModeHTML,
+			Duration:            format.Duration,
+			ReplyParameters:     replyParameters,
+			DisableNotification: disableNotification,
+		})
+	}
+
+	var thumbnail gotgbot.InputFile
+	if media.ThumbnailFilePath != "" {
+		thumbnailFile, err := os.Open(media.ThumbnailFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file: %w", err)
+		}
+		defer thumbnailFile.Close()
+		thumbnail = gotgbot.InputFileByReader(
+			filepath.Base(media.ThumbnailFilePath),
+			thumbnailFile,
+		)
+	}
+	bot.SendChatAction(chatID, "upload_video_note", nil)
+	return bot.SendVideoNote(chatID, inputFile, &gotgbot.SendVideoNoteOpts{
+		Duration:            format.Duration,
+		Length:              format.Width,
+		Thumbnail:           thumbnail,
+		ReplyParameters:     replyParameters,
+		DisableNotification: disableNotification,
+	})
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/govdbot/govd/enums"
+	"github.com/govdbot/govd/models"
+	"github.com/govdbot/govd/plugins"
+	"github.com/govdbot/govd/util"
+)
+
+// RunPlugins runs the plugins of a stage for every media.
+// medias skipped by a plugin are removed from the returned list
+func RunPlugins(
+	ctx context.Context,
+	dlCtx *models.DownloadContext,
+	stage enums.PluginStage,
+	medias []*models.DownloadedMedia,
+) ([]*models.DownloadedMedia, error) {
+	kept := make([]*models.DownloadedMedia, 0, len(medias))
+	for _, media := range medias {
+		// plugins may depend on the group settings
+		media.GroupSettings = dlCtx.GroupSettings
+		err := plugins.Run(ctx, stage, media)
+		if errors.Is(err, plugins.ErrSkipMedia) {
+			removeMediaFiles(media)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		kept = append(kept, media)
+	}
+	if len(kept) == 0 {
+		return nil, util.ErrSkippedByPlugin
+	}
+	return kept, nil
+}
+
+// RunPreDownloadPlugins runs the pre-download plugins,
+// before any file exists for the medias
+func RunPreDownloadPlugins(
+	ctx context.Context,
+	dlCtx *models.DownloadContext,
+	mediaList []*models.Media,
+) ([]*models.Media, error) {
+	medias := make([]*models.DownloadedMedia, 0, len(mediaList))
+	for idx, media := range mediaList {
+		medias = append(medias, &models.DownloadedMedia{
+			Media: media,
+			Index: idx,
+		})
+	}
+	medias, err := RunPlugins(ctx, dlCtx, enums.PluginStagePreDownload, medias)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]*models.Media, 0, len(medias))
+	for _, media := range medias {
+		kept = append(kept, media.Media)
+	}
+	return kept, nil
+}
+
+func removeMediaFiles(media *models.DownloadedMedia) {
+	if media.FilePath != "" {
+		os.Remove(media.FilePath)
+	}
+	if media.ThumbnailFilePath != "" {
+		os.Remove(media.ThumbnailFilePath)
+	}
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/govdbot/govd/config"
+	"github.com/govdbot/govd/enums"
+	"github.com/govdbot/govd/models"
+	"github.com/govdbot/govd/util"
+	"github.com/govdbot/govd/util/libav"
+
+	"go.uber.org/zap"
+)
+
+// IsSlideshowEnabled reports whether the group
+// renders photo posts with music as videos
+func IsSlideshowEnabled(dlCtx *models.DownloadContext) bool {
+	return dlCtx.GroupSettings != nil && dlCtx.GroupSettings.SlideshowDelay > 0
+}
+
+// GetSlideshowDelay returns how long each image is shown when
+// the medias are rendered as a slideshow, or zero to send them
+// as they are. only photo posts with music are rendered
+func GetSlideshowDelay(
+	dlCtx *models.DownloadContext,
+	mediaList []*models.Media,
+) time.Duration {
+	if !IsSlideshowEnabled(dlCtx) || !isPhotoAlbum(mediaList) {
+		return 0
+	}
+	if mediaList[0].AudioFormat == nil {
+		return 0
+	}
+	return time.Duration(dlCtx.GroupSettings.SlideshowDelay) * time.Second
+}
+
+// RenderSlideshow renders the downloaded photos into a single
+// video with the music of the post. the returned media replaces
+// the photos, whose files are removed
+func RenderSlideshow(
+	ctx context.Context,
+	medias []*models.DownloadedMedia,
+	delay time.Duration,
+) (*models.DownloadedMedia, error) {
+	first := medias[0]
+	audioFormat := first.Media.AudioFormat
+
+	// the photo formats have the limits of the
+	// extractor and the group, set when validated
+	downloadConfig := first.Media.Format.DownloadConfig
+	if util.ExceedsMaxDuration(int64(delay.Seconds())*int64(len(medias)), downloadConfig) {
+		removeDownloadedMedias(medias)
+		return nil, util.ErrDurationTooLong
+	}
+
+	zap.S().Debugf(
+		"rendering slideshow of %d images for %s (%s)",
+		len(medias),
+		first.Media.ContentID,
+		first.Media.ExtractorCodeName,
+	)
+
+	imagePaths := make([]string, 0, len(medias))
+	for _, media := range medias {
+		imagePaths = append(imagePaths, media.FilePath)
+	}
+	defer removeDownloadedMedias(medias)
+
+	audioFile, err := util.DownloadFile(
+		ctx, audioFormat.URL,
+		audioFormat.GetFileName(),
+		models.GetDownloadConfig(audioFormat.DownloadConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download audio file: %w", err)
+	}
+	defer os.Remove(audioFile)
+
+	format := &models.MediaFormat{
+		Type:       enums.MediaTypeVideo,
+		FormatID:   "slideshow",
+		VideoCodec: enums.MediaCodecAVC,
+		AudioCodec: enums.MediaCodecAAC,
+		Title:      audioFormat.Title,
+		Artist:     audioFormat.Artist,
+	}
+	filePath := filepath.Join(config.Env().DownloadsDirectory, format.GetFileName())
+	err = libav.RenderSlideshow(ctx, imagePaths, audioFile, filePath, delay)
+	if err != nil {
+		return nil, err
+	}
+	InsertVideoInfo(format, filePath)
+
+	thumbnailFilePath, err := GetFileThumbnail(
+		ctx, format, filePath,
+		models.GetDownloadConfig(nil),
+	)
+	if err != nil {
+		os.Remove(filePath)
+		return nil, fmt.Errorf("failed to get thumbnail: %w", err)
+	}
+
+	media := first.Media
+	media.Format = format
+	media.Formats = []*models.MediaFormat{format}
+	// the music is already in the video,
+	// merge_audio must not add it again
+	media.AudioFormat = nil
+	return &models.DownloadedMedia{
+		FilePath:          filePath,
+		ThumbnailFilePath: thumbnailFilePath,
+		Media:             media,
+		Index:             0,
+	}, nil
+}
+
+func isPhotoAlbum(mediaList []*models.Media) bool {
+	if len(mediaList) == 0 {
+		return false
+	}
+	for _, media := range mediaList {
+		if media.Format == nil || media.Format.Type != enums.MediaTypePhoto {
+			return false
+		}
+	}
+	return true
+}
+
+func removeDownloadedMedias(medias []*models.DownloadedMedia) {
+	for _, media := range medias {
+		removeMediaFiles(media)
+	}
+}
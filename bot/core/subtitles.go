@@ -0,0 +1,184 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/govdbot/govd/enums"
+	"github.com/govdbot/govd/models"
+	"github.com/govdbot/govd/util"
+	"github.com/govdbot/govd/util/libav"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"go.uber.org/zap"
+)
+
+// ValidateSubtitles ensures that the requested
+// subtitles are available for at least one media
+func ValidateSubtitles(
+	dlCtx *models.DownloadContext,
+	mediaList []*models.Media,
+) error {
+	if dlCtx.SubtitlesMode == enums.SubtitlesModeNone {
+		return nil
+	}
+	for _, media := range mediaList {
+		if len(media.Subtitles) > 0 {
+			return nil
+		}
+	}
+	return util.ErrNoSubtitles
+}
+
+// DownloadSubtitles downloads the preferred subtitle
+// track of every downloaded video as an srt file.
+// the returned paths match the order of the medias,
+// with empty paths for medias without subtitles
+func DownloadSubtitles(
+	ctx context.Context,
+	dlCtx *models.DownloadContext,
+	medias []*models.DownloadedMedia,
+) ([]string, error) {
+	paths := make([]string, len(medias))
+	for idx, media := range medias {
+		format := media.Media.Format
+		if format.Type != enums.MediaTypeVideo {
+			continue
+		}
+		subtitle := media.Media.GetSubtitle(dlCtx.SubtitlesLanguage)
+		if subtitle == nil {
+			continue
+		}
+		zap.S().Debugf(
+			"downloading %s subtitles (%s) for %s",
+			subtitle.Language,
+			subtitle.Format,
+			media.Media.ContentID,
+		)
+		path, err := util.DownloadSubtitle(
+			ctx, subtitle,
+			getSubtitleFileName(media.FilePath, subtitle),
+			format.DownloadConfig,
+		)
+		if err != nil {
+			for _, path := range paths {
+				if path != "" {
+					os.Remove(path)
+				}
+			}
+			return nil, fmt.Errorf("failed to download subtitles: %w", err)
+		}
+		paths[idx] = path
+	}
+	return paths, nil
+}
+
+// EmbedSubtitles soft-muxes the preferred
+// subtitle track into every downloaded video
+func EmbedSubtitles(
+	ctx context.Context,
+	dlCtx *models.DownloadContext,
+	medias []*models.DownloadedMedia,
+) error {
+	paths, err := DownloadSubtitles(ctx, dlCtx, medias)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, path := range paths {
+			if path != "" {
+				os.Remove(path)
+			}
+		}
+	}()
+	for idx, path := range paths {
+		if path == "" {
+			continue
+		}
+		media := medias[idx]
+		if !strings.EqualFold(filepath.Ext(media.FilePath), ".mp4") {
+			// mov_text tracks are only supported by mp4
+			zap.S().Debugf("skipping subtitles for %s", media.FilePath)
+			continue
+		}
+		err := libav.EmbedSubtitles(
+			media.FilePath, path,
+			media.Media.GetSubtitle(dlCtx.SubtitlesLanguage).Language,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendSubtitles sends the given srt files
+// as documents, replying to the user message
+func SendSubtitles(
+	bot *gotgbot.Bot,
+	ctx *ext.Context,
+	paths []string,
+) error {
+	chatID := ctx.EffectiveMessage.Chat.Id
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		err := sendSubtitle(bot, ctx, chatID, path)
+		os.Remove(path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sendSubtitle(
+	bot *gotgbot.Bot,
+	ctx *ext.Context,
+	chatID int64,
+	path string,
+) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	SendingEffect(bot, chatID, "")
+	_, err = bot.SendDocument(
+		chatID,
+		gotgbot.InputFileByReader(filepath.Base(path), file),
+		&gotgbot.SendDocumentOpts{
+			ReplyParameters: &gotgbot.ReplyParameters{
+				MessageId: ctx.EffectiveMessage.MessageId,
+			},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to send subtitles: %w", err)
+	}
+	return nil
+}
+
+func removeSubtitles(paths []string) {
+	for _, path := range paths {
+		if path != "" {
+			os.Remove(path)
+		}
+	}
+}
+
+func getSubtitleFileName(filePath string, subtitle *models.Subtitle) string {
+	fileName := filepath.Base(filePath)
+	fileName = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	language := subtitle.Language
+	if language == "" {
+		language = "und"
+	}
+	return fileName + "." + language + ".srt"
+}
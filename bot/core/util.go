@@ -3,14 +3,15 @@ package core
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/govdbot/govd/config"
 	"github.com/govdbot/govd/database"
 	"github.com/govdbot/govd/enums"
 	"github.com/govdbot/govd/models"
-	"github.com/govdbot/govd/plugins"
 	"github.com/govdbot/govd/util"
 	"github.com/govdbot/govd/util/libav"
 	"github.com/govdbot/govd/util/mp4box"
@@ -22,8 +23,13 @@ import (
 )
 
 func ValidateMediaList(
+	dlCtx *models.DownloadContext,
 	mediaList []*models.Media,
 ) error {
+	var audioLanguage string
+	if dlCtx.GroupSettings != nil {
+		audioLanguage = dlCtx.GroupSettings.AudioLanguage
+	}
 	for i := range mediaList {
 		defaultFormat := mediaList[i].GetDefaultFormat()
 		if defaultFormat == nil {
@@ -36,18 +42,33 @@ func ValidateMediaList(
 		zap.S().Debugf("default format selected: %s (media %d)", defaultFormat.FormatID, i)
 
 		// ensure we can merge video and audio formats
-		EnsureMergeFormats(mediaList[i], defaultFormat)
+		EnsureMergeFormats(mediaList[i], defaultFormat, audioLanguage)
 
-		// ensure download config is set
+		// photos are sent as documents, keeping their quality
+		if dlCtx.SendOriginals && defaultFormat.Type == enums.MediaTypePhoto {
+			defaultFormat.IsDocument = true
+		}
+
+		// ensure download config is set, with the
+		// overrides of the extractor in config.yaml
 		if defaultFormat.DownloadConfig == nil {
 			defaultFormat.DownloadConfig = models.GetDownloadConfig(nil)
 		}
+		extractorConfig := config.GetExtractorDownloadConfig(dlCtx.Extractor)
+		defaultFormat.DownloadConfig.Merge(extractorConfig)
+		SetGroupLimits(dlCtx.GroupSettings, defaultFormat.DownloadConfig, extractorConfig)
+
+		if dlCtx.Clip != nil {
+			if err := SetClip(defaultFormat, dlCtx.Clip); err != nil {
+				return err
+			}
+		}
 
 		// check for file size and duration limits
-		if util.ExceedsMaxFileSize(defaultFormat.FileSize) {
+		if util.ExceedsMaxFileSize(defaultFormat.FileSize, defaultFormat.DownloadConfig) {
 			return util.ErrFileTooLarge
 		}
-		if util.ExceedsMaxDuration(defaultFormat.Duration) {
+		if util.ExceedsMaxDuration(defaultFormat.Duration, defaultFormat.DownloadConfig) {
 			return util.ErrDurationTooLong
 		}
 
@@ -56,12 +77,74 @@ func ValidateMediaList(
 	return nil
 }
 
+// SetGroupLimits applies the limits of the group, if set. they
+// can only lower the ones of the extractor, unless its config
+// allows groups to raise them. the instance limits still apply
+func SetGroupLimits(
+	settings *models.GroupSettings,
+	downloadConfig *models.DownloadConfig,
+	extractorConfig *models.ExtractorDownloadConfig,
+) {
+	if settings == nil {
+		return
+	}
+	canRaise := extractorConfig != nil && extractorConfig.AllowGroupLimits
+	if settings.MaxFileSize > 0 {
+		maxFileSize := int64(settings.MaxFileSize) * 1024 * 1024
+		if canRaise || downloadConfig.MaxFileSize <= 0 || maxFileSize < downloadConfig.MaxFileSize {
+			downloadConfig.MaxFileSize = maxFileSize
+		}
+	}
+	if settings.MaxDuration > 0 {
+		maxDuration := time.Duration(settings.MaxDuration) * time.Second
+		if canRaise || downloadConfig.MaxDuration <= 0 || maxDuration < downloadConfig.MaxDuration {
+			downloadConfig.MaxDuration = maxDuration
+		}
+	}
+}
+
+// ValidateStoredMedias checks the stored medias against the limits
+// of the extractor and the group, which may be lower than the
+// ones they were downloaded with
+func ValidateStoredMedias(
+	dlCtx *models.DownloadContext,
+	storedMedias []*models.Media,
+) error {
+	downloadConfig := models.GetDownloadConfig(nil)
+	extractorConfig := config.GetExtractorDownloadConfig(dlCtx.Extractor)
+	downloadConfig.Merge(extractorConfig)
+	SetGroupLimits(dlCtx.GroupSettings, downloadConfig, extractorConfig)
+	for _, media := range storedMedias {
+		format := media.Format
+		if format == nil {
+			continue
+		}
+		if util.ExceedsMaxFileSize(format.FileSize, downloadConfig) {
+			return util.ErrFileTooLarge
+		}
+		if util.ExceedsMaxDuration(format.Duration, downloadConfig) {
+			return util.ErrDurationTooLong
+		}
+	}
+	return nil
+}
+
+// GetFileThumbnail saves the thumbnail of the format, when the
+// extractor gives one, or generates it from the file: the most
+// informative frame of videos, the cover art of audios and a
+// downscaled copy of images sent as documents. returns an empty
+// path when the file has no thumbnail
 func GetFileThumbnail(
 	ctx context.Context,
 	format *models.MediaFormat,
 	filePath string,
 	downloadConfig *models.DownloadConfig,
 ) (string, error) {
+	if format.Type == enums.MediaTypePhoto && !format.IsDocument {
+		// telegram makes its own for photos
+		return "", nil
+	}
+
 	fileDir := filepath.Dir(filePath)
 	fileName := filepath.Base(filePath)
 	fileExt := filepath.Ext(fileName)
@@ -71,30 +154,48 @@ func GetFileThumbnail(
 	if len(format.Thumbnail) > 0 {
 		zap.S().Debugf("downloading thumbnail from URL: %s", format.Thumbnail)
 		file, err := util.DownloadFileInMemory(ctx, format.Thumbnail, downloadConfig)
-		if err != nil {
-			return "", fmt.Errorf("failed to download file in memory: %w", err)
+		if err == nil {
+			err = util.ImgToThumbnail(file, thumbnailFilePath)
 		}
-		if format.Type == enums.MediaTypeAudio {
-			zap.S().Debug("resizing audio thumbnail")
-			// thumbnails for audio files are usually 320x320
-			err = util.ResizeImgToJPEG(file, thumbnailFilePath, 320)
-			if err != nil {
-				return "", fmt.Errorf("failed to convert to JPEG: %w", err)
-			}
-		} else {
-			err = util.ImgToJPEG(file, thumbnailFilePath)
-			if err != nil {
-				return "", fmt.Errorf("failed to convert to JPEG: %w", err)
-			}
+		if err == nil {
+			return thumbnailFilePath, nil
 		}
-		return thumbnailFilePath, nil
+		// generated from the file instead
+		zap.S().Debugf("failed to get thumbnail from URL: %v", err)
 	}
-	if format.Type == enums.MediaTypeVideo {
+
+	switch format.Type {
+	case enums.MediaTypeVideo:
 		zap.S().Debug("extracting video thumbnail with libav")
-		err := libav.ExtractVideoThumbnail(filePath, thumbnailFilePath)
+		img, err := libav.ExtractVideoThumbnail(filePath)
 		if err != nil {
 			return "", fmt.Errorf("failed to extract video thumbnail: %w", err)
 		}
+		if err := util.SaveThumbnail(img, thumbnailFilePath); err != nil {
+			return "", err
+		}
+		return thumbnailFilePath, nil
+	case enums.MediaTypeAudio:
+		zap.S().Debug("extracting audio cover art with libav")
+		img, err := libav.DecodeImage(filePath, 0)
+		if err != nil {
+			// not every audio file has one
+			zap.S().Debugf("no cover art found: %v", err)
+			return "", nil
+		}
+		if err := util.SaveThumbnail(img, thumbnailFilePath); err != nil {
+			return "", err
+		}
+		return thumbnailFilePath, nil
+	case enums.MediaTypePhoto:
+		file, err := os.Open(filePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to open image: %w", err)
+		}
+		defer file.Close()
+		if err := util.ImgToThumbnail(file, thumbnailFilePath); err != nil {
+			return "", err
+		}
 		return thumbnailFilePath, nil
 	}
 	return "", nil
@@ -153,12 +254,29 @@ func GetMessageFileSize(msg *gotgbot.Message) int64 {
 	}
 }
 
+// SetMediaFileIDs sets the file ID and size of the
+// sent messages to the formats of their medias
+func SetMediaFileIDs(
+	msgs []gotgbot.Message,
+	medias []*models.DownloadedMedia,
+) error {
+	for idx, msg := range msgs {
+		fileID := GetMessageFileID(&msg)
+		if len(fileID) == 0 {
+			return fmt.Errorf("no file ID found for media at index %d", idx)
+		}
+		fileSize := GetMessageFileSize(&msg)
+		medias[idx].Media.Format.FileID = fileID
+		medias[idx].Media.Format.FileSize = fileSize
+	}
+	return nil
+}
+
 func StoreMedias(
 	dlCtx *models.DownloadContext,
-	msgs []gotgbot.Message,
 	medias []*models.DownloadedMedia,
 ) error {
-	if !config.Env.Caching {
+	if !config.Env().Caching {
 		return nil
 	}
 	if len(medias) == 0 {
@@ -172,26 +290,15 @@ func StoreMedias(
 		dlCtx.Extractor.CodeName,
 	)
 
-	storedMedias := make([]*models.Media, 0, len(medias))
-
-	for idx, msg := range msgs {
-		fileID := GetMessageFileID(&msg)
-		if len(fileID) == 0 {
-			return fmt.Errorf("no file ID found for media at index %d", idx)
+	for _, media := range medias {
+		if media.Media.Format.IsLive {
+			// recordings depend on the requested duration
+			continue
 		}
-		fileSize := GetMessageFileSize(&msg)
-		medias[idx].Media.Format.FileID = fileID
-		medias[idx].Media.Format.FileSize = fileSize
-		storedMedias = append(
-			storedMedias,
-			medias[idx].Media,
-		)
-	}
-	for _, media := range storedMedias {
 		err := database.StoreMedia(
 			dlCtx.Extractor.CodeName,
-			media.ContentID,
-			media,
+			media.Media.ContentID,
+			media.Media,
 		)
 		if err != nil {
 			return err
@@ -206,7 +313,7 @@ func FormatCaption(
 ) string {
 	var description string
 	header := strings.ReplaceAll(
-		config.Env.CaptionHeader,
+		config.Env().CaptionHeader,
 		"{{url}}",
 		media.ContentURL,
 	)
@@ -216,7 +323,7 @@ func FormatCaption(
 			text = text[:600] + "..."
 		}
 		description = strings.ReplaceAll(
-			config.Env.CaptionDescription,
+			config.Env().CaptionDescription,
 			"{{text}}",
 			util.EscapeCaption(text),
 		)
@@ -355,6 +462,7 @@ func SendErrorMessage(
 func EnsureMergeFormats(
 	media *models.Media,
 	videoFormat *models.MediaFormat,
+	audioLanguage string,
 ) {
 	zap.S().Debugf(
 		"ensuring merge formats for %s (%s)",
@@ -363,14 +471,24 @@ func EnsureMergeFormats(
 	if videoFormat.Type != enums.MediaTypeVideo {
 		return
 	}
-	if videoFormat.AudioCodec != "" {
+	// animations are silent on purpose
+	if videoFormat.AudioCodec != "" || videoFormat.IsAnimation {
 		return
 	}
-	// video with no audio
-	audioFormat := media.GetDefaultAudioFormat()
+	// video with no audio, prefer the
+	// track in the requested language
+	audioFormat := media.GetLanguageAudioFormat(audioLanguage)
+	if audioFormat == nil {
+		audioFormat = media.GetDefaultAudioFormat()
+	}
 	if audioFormat == nil {
 		return
 	}
+	zap.S().Debugf(
+		"merge audio format selected: %s (%s)",
+		audioFormat.FormatID, audioFormat.Language,
+	)
+	// merged by the merge_audio plugin
+	media.AudioFormat = audioFormat
 	videoFormat.AudioCodec = audioFormat.AudioCodec
-	videoFormat.Plugins = append(videoFormat.Plugins, plugins.MergeAudio)
 }
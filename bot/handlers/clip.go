@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"time"
+
+	extractors "github.com/govdbot/govd/ext"
+	"github.com/govdbot/govd/util"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+func ClipHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	args := ctx.Args()
+	if len(args) != 3 {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"usage: /clip (url) (range, e.g. 1:20-2:05)",
+			nil,
+		)
+		return nil
+	}
+
+	clip, err := util.ParseClipRange(args[2])
+	if err != nil {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			err.Error(),
+			nil,
+		)
+		return nil
+	}
+
+	dlCtx, err := extractors.CtxByURL(args[1])
+	if err != nil || dlCtx == nil || dlCtx.Extractor == nil {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"this url is not supported",
+			nil,
+		)
+		return nil
+	}
+	dlCtx.Clip = clip
+	return handleDownload(bot, ctx, dlCtx, 10*time.Minute)
+}
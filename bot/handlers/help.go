@@ -11,13 +11,24 @@ var helpMessage = "usage:\n" +
 	"- you can send a link to the bot privately " +
 	"to download the media too\n" +
 	"- you can use inline mode " +
-	"to download media from any chat\n\n" +
+	"to download media from any chat\n" +
+	"- /record (url) [duration] = record a live stream\n" +
+	"- /clip (url) (start-end) = download part of a video, e.g. 1:20-2:05\n" +
+	"- /voice (url) = send as a voice message, or add #voice to a link\n" +
+	"- /round (url) = send as a video note, up to 60s, or add #round to a link\n" +
+	"- /originals (true|false) = send photos as documents in original quality\n\n" +
 	"group commands:\n" +
 	"- /settings = show current settings\n" +
 	"- /captions (true|false) = enable/disable descriptions\n" +
 	"- /nsfw (true|false) = enable/disable nsfw content\n" +
 	"- /silent (true|false) = enable/disable silent mode\n" +
-	"- /limit (int) = set max items in media groups\n\n" +
+	"- /limit (int) = set max items in media groups\n" +
+	"- /language (code|any) = set preferred audio language\n" +
+	"- /slideshow (seconds|off) = send photo posts with music as a video\n" +
+	"- /normalize (true|false) = normalize the loudness of audio files\n" +
+	"- /audiocodec (mp3|aac|opus|original) = re-encode audio files\n" +
+	"- /maxsize (MB|default) = set max file size\n" +
+	"- /maxduration (duration|default) = set max media duration, e.g. 10m\n\n" +
 	"note: the bot is still in beta, " +
 	"so expect some bugs and missing features.\n"
 
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/govdbot/govd/enums"
+	extractors "github.com/govdbot/govd/ext"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+func VoiceHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	return handleNote(bot, ctx, "voice", enums.NoteModeVoice)
+}
+
+func RoundHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	return handleNote(bot, ctx, "round", enums.NoteModeVideo)
+}
+
+func handleNote(
+	bot *gotgbot.Bot,
+	ctx *ext.Context,
+	command string,
+	mode enums.NoteMode,
+) error {
+	args := ctx.Args()
+	if len(args) != 2 {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"usage: /"+command+" (url)",
+			nil,
+		)
+		return nil
+	}
+
+	dlCtx, err := extractors.CtxByURL(args[1])
+	if err != nil || dlCtx == nil || dlCtx.Extractor == nil {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"this url is not supported",
+			nil,
+		)
+		return nil
+	}
+	dlCtx.NoteMode = mode
+	return handleDownload(bot, ctx, dlCtx, 10*time.Minute)
+}
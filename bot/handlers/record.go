@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/govdbot/govd/config"
+	extractors "github.com/govdbot/govd/ext"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+func RecordHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	args := ctx.Args()
+	if len(args) != 2 && len(args) != 3 {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"usage: /record (url) [duration, e.g. 5m]",
+			nil,
+		)
+		return nil
+	}
+
+	duration := config.Env().MaxDuration
+	if len(args) == 3 {
+		value, err := time.ParseDuration(args[2])
+		if err != nil || value <= 0 {
+			ctx.EffectiveMessage.Reply(
+				bot,
+				fmt.Sprintf("invalid duration (%s), use values like 30s, 5m or 1h", args[2]),
+				nil,
+			)
+			return nil
+		}
+		if value > duration {
+			ctx.EffectiveMessage.Reply(
+				bot,
+				fmt.Sprintf("duration can't exceed %s on this instance", duration),
+				nil,
+			)
+			return nil
+		}
+		duration = value
+	}
+
+	dlCtx, err := extractors.CtxByURL(args[1])
+	if err != nil || dlCtx == nil || dlCtx.Extractor == nil {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"this url is not supported",
+			nil,
+		)
+		return nil
+	}
+	dlCtx.RecordDuration = duration
+
+	// the stream is recorded in real time, leave
+	// some room for the download and the upload
+	return handleDownload(bot, ctx, dlCtx, duration+10*time.Minute)
+}
@@ -2,14 +2,20 @@ package handlers
 
 import (
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/govdbot/govd/config"
 	"github.com/govdbot/govd/database"
+	"github.com/govdbot/govd/enums"
+	"github.com/govdbot/govd/plugins"
 	"github.com/govdbot/govd/util"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"golang.org/x/text/language"
 )
 
 func SettingsHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
@@ -25,6 +31,26 @@ func SettingsHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 	if err != nil {
 		return err
 	}
+	audioLanguage := settings.AudioLanguage
+	if audioLanguage == "" {
+		audioLanguage = "any"
+	}
+	slideshow := "off"
+	if settings.SlideshowDelay > 0 {
+		slideshow = fmt.Sprintf("%ds per image", settings.SlideshowDelay)
+	}
+	audioCodec := settings.AudioCodec
+	if audioCodec == "" {
+		audioCodec = "original"
+	}
+	maxFileSize := "default"
+	if settings.MaxFileSize > 0 {
+		maxFileSize = fmt.Sprintf("%dMB", settings.MaxFileSize)
+	}
+	maxDuration := "default"
+	if settings.MaxDuration > 0 {
+		maxDuration = (time.Duration(settings.MaxDuration) * time.Second).String()
+	}
 	ctx.EffectiveMessage.Reply(
 		bot,
 		fmt.Sprintf(
@@ -32,11 +58,25 @@ func SettingsHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 				"captions: %s\n"+
 				"nsfw: %s\n"+
 				"silent mode: %s\n"+
-				"media group limit: %d\n",
+				"media group limit: %d\n"+
+				"audio language: %s\n"+
+				"slideshow: %s\n"+
+				"originals: %s\n"+
+				"normalize audio: %s\n"+
+				"audio codec: %s\n"+
+				"max file size: %s\n"+
+				"max duration: %s\n",
 			strconv.FormatBool(*settings.Captions),
 			strconv.FormatBool(*settings.NSFW),
 			strconv.FormatBool(*settings.Silent),
 			settings.MediaGroupLimit,
+			audioLanguage,
+			slideshow,
+			strconv.FormatBool(settings.SendOriginals),
+			strconv.FormatBool(settings.NormalizeAudio),
+			audioCodec,
+			maxFileSize,
+			maxDuration,
 		),
 		nil,
 	)
@@ -275,3 +315,418 @@ func SilentHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 	)
 	return nil
 }
+
+func AudioLanguageHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	if ctx.EffectiveMessage.Chat.Type == gotgbot.ChatTypePrivate {
+		return nil
+	}
+
+	chatID := ctx.EffectiveMessage.Chat.Id
+	userID := ctx.EffectiveMessage.From.Id
+
+	args := ctx.Args()
+	if len(args) != 2 {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"usage: /language (code|any)",
+			nil,
+		)
+		return nil
+	}
+	if !util.IsUserAdmin(bot, chatID, userID) {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"you don't have permission to change settings",
+			nil,
+		)
+		return nil
+	}
+	userInput := strings.ToLower(args[1])
+	var value string
+	if userInput != "any" {
+		tag, err := language.Parse(userInput)
+		if err != nil {
+			ctx.EffectiveMessage.Reply(
+				bot,
+				fmt.Sprintf("invalid language (%s), use a code like en or pt-br", userInput),
+				nil,
+			)
+			return nil
+		}
+		value = tag.String()
+	}
+	err := database.UpdateGroupAudioLanguage(chatID, value)
+	if err != nil {
+		return err
+	}
+	message := "preferred audio language cleared"
+	if value != "" {
+		message = fmt.Sprintf("preferred audio language set to %s", value)
+	}
+	ctx.EffectiveMessage.Reply(
+		bot,
+		message,
+		nil,
+	)
+	return nil
+}
+
+func SlideshowHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	if ctx.EffectiveMessage.Chat.Type == gotgbot.ChatTypePrivate {
+		return nil
+	}
+
+	chatID := ctx.EffectiveMessage.Chat.Id
+	userID := ctx.EffectiveMessage.From.Id
+
+	args := ctx.Args()
+	if len(args) != 2 {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"usage: /slideshow (seconds|off)",
+			nil,
+		)
+		return nil
+	}
+	if !util.IsUserAdmin(bot, chatID, userID) {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"you don't have permission to change settings",
+			nil,
+		)
+		return nil
+	}
+	userInput := strings.ToLower(args[1])
+	var value int
+	if userInput != "off" {
+		delay, err := strconv.Atoi(userInput)
+		if err != nil {
+			ctx.EffectiveMessage.Reply(
+				bot,
+				fmt.Sprintf("invalid value (%s), use a number or off", userInput),
+				nil,
+			)
+			return nil
+		}
+		if delay < 1 || delay > 10 {
+			ctx.EffectiveMessage.Reply(
+				bot,
+				"slideshow delay must be between 1 and 10 seconds",
+				nil,
+			)
+			return nil
+		}
+		value = delay
+	}
+	err := database.UpdateGroupSlideshowDelay(chatID, value)
+	if err != nil {
+		return err
+	}
+	message := "slideshows disabled, photos are sent as albums"
+	if value > 0 {
+		message = fmt.Sprintf("slideshows enabled, %ds per image", value)
+	}
+	ctx.EffectiveMessage.Reply(
+		bot,
+		message,
+		nil,
+	)
+	return nil
+}
+
+// in private chats the setting is stored for the user
+func OriginalsHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	chatID := ctx.EffectiveMessage.Chat.Id
+	userID := ctx.EffectiveMessage.From.Id
+	isPrivate := ctx.EffectiveMessage.Chat.Type == gotgbot.ChatTypePrivate
+
+	args := ctx.Args()
+	if len(args) != 2 {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"usage: /originals (true|false)",
+			nil,
+		)
+		return nil
+	}
+	if !isPrivate && !util.IsUserAdmin(bot, chatID, userID) {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"you don't have permission to change settings",
+			nil,
+		)
+		return nil
+	}
+	userInput := strings.ToLower(args[1])
+	value, err := strconv.ParseBool(userInput)
+	if err != nil {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			fmt.Sprintf("invalid value (%s), use true or false", userInput),
+			nil,
+		)
+		return nil
+	}
+	if isPrivate {
+		// ensure the user exists
+		if _, err := database.GetUser(userID); err != nil {
+			return err
+		}
+		err = database.UpdateUserSendOriginals(userID, value)
+	} else {
+		err = database.UpdateGroupSendOriginals(chatID, value)
+	}
+	if err != nil {
+		return err
+	}
+	var message string
+	if value {
+		message = "photos will be sent as documents in original quality"
+	} else {
+		message = "photos will be sent as compressed photos"
+	}
+	ctx.EffectiveMessage.Reply(
+		bot,
+		message,
+		nil,
+	)
+	return nil
+}
+
+func NormalizeHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	if ctx.EffectiveMessage.Chat.Type == gotgbot.ChatTypePrivate {
+		return nil
+	}
+
+	chatID := ctx.EffectiveMessage.Chat.Id
+	userID := ctx.EffectiveMessage.From.Id
+
+	args := ctx.Args()
+	if len(args) != 2 {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"usage: /normalize (true|false)",
+			nil,
+		)
+		return nil
+	}
+	if !util.IsUserAdmin(bot, chatID, userID) {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"you don't have permission to change settings",
+			nil,
+		)
+		return nil
+	}
+	userInput := strings.ToLower(args[1])
+	value, err := strconv.ParseBool(userInput)
+	if err != nil {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			fmt.Sprintf("invalid value (%s), use true or false", userInput),
+			nil,
+		)
+		return err
+	}
+	err = database.UpdateGroupNormalizeAudio(chatID, value)
+	if err != nil {
+		return err
+	}
+	var message string
+	if value {
+		message = "audio loudness normalization enabled"
+	} else {
+		message = "audio loudness normalization disabled"
+	}
+	ctx.EffectiveMessage.Reply(
+		bot,
+		message,
+		nil,
+	)
+	return nil
+}
+
+func AudioCodecHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	if ctx.EffectiveMessage.Chat.Type == gotgbot.ChatTypePrivate {
+		return nil
+	}
+
+	chatID := ctx.EffectiveMessage.Chat.Id
+	userID := ctx.EffectiveMessage.From.Id
+
+	args := ctx.Args()
+	if len(args) != 2 {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"usage: /audiocodec (mp3|aac|opus|original)",
+			nil,
+		)
+		return nil
+	}
+	if !util.IsUserAdmin(bot, chatID, userID) {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"you don't have permission to change settings",
+			nil,
+		)
+		return nil
+	}
+	userInput := strings.ToLower(args[1])
+	var value string
+	if userInput != "original" {
+		if !slices.Contains(plugins.AudioCodecs, enums.MediaCodec(userInput)) {
+			ctx.EffectiveMessage.Reply(
+				bot,
+				fmt.Sprintf("invalid codec (%s), use mp3, aac, opus or original", userInput),
+				nil,
+			)
+			return nil
+		}
+		value = userInput
+	}
+	err := database.UpdateGroupAudioCodec(chatID, value)
+	if err != nil {
+		return err
+	}
+	message := "audio files will keep their codec"
+	if value != "" {
+		message = fmt.Sprintf("audio files will be re-encoded to %s", value)
+	}
+	ctx.EffectiveMessage.Reply(
+		bot,
+		message,
+		nil,
+	)
+	return nil
+}
+
+// group limits replace the ones of the extractor,
+// but can't be higher than the instance limits
+func MaxFileSizeHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	if ctx.EffectiveMessage.Chat.Type == gotgbot.ChatTypePrivate {
+		return nil
+	}
+
+	chatID := ctx.EffectiveMessage.Chat.Id
+	userID := ctx.EffectiveMessage.From.Id
+
+	args := ctx.Args()
+	if len(args) != 2 {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"usage: /maxsize (MB|default)",
+			nil,
+		)
+		return nil
+	}
+	if !util.IsUserAdmin(bot, chatID, userID) {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"you don't have permission to change settings",
+			nil,
+		)
+		return nil
+	}
+	userInput := strings.ToLower(args[1])
+	var value int
+	if userInput != "default" {
+		size, err := strconv.Atoi(strings.TrimSuffix(userInput, "mb"))
+		if err != nil || size < 1 {
+			ctx.EffectiveMessage.Reply(
+				bot,
+				fmt.Sprintf("invalid value (%s), use a size in MB or default", userInput),
+				nil,
+			)
+			return nil
+		}
+		instanceLimit := config.Env().MaxFileSize / 1024 / 1024
+		if int64(size) > instanceLimit {
+			ctx.EffectiveMessage.Reply(
+				bot,
+				fmt.Sprintf("max file size can't be higher than the instance limit (%dMB)", instanceLimit),
+				nil,
+			)
+			return nil
+		}
+		value = size
+	}
+	err := database.UpdateGroupMaxFileSize(chatID, value)
+	if err != nil {
+		return err
+	}
+	message := "max file size set to default"
+	if value > 0 {
+		// see SetGroupLimits
+		message = fmt.Sprintf("max file size set to %dMB, services with a lower limit keep it", value)
+	}
+	ctx.EffectiveMessage.Reply(
+		bot,
+		message,
+		nil,
+	)
+	return nil
+}
+
+func MaxDurationHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	if ctx.EffectiveMessage.Chat.Type == gotgbot.ChatTypePrivate {
+		return nil
+	}
+
+	chatID := ctx.EffectiveMessage.Chat.Id
+	userID := ctx.EffectiveMessage.From.Id
+
+	args := ctx.Args()
+	if len(args) != 2 {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"usage: /maxduration (duration, e.g. 10m|default)",
+			nil,
+		)
+		return nil
+	}
+	if !util.IsUserAdmin(bot, chatID, userID) {
+		ctx.EffectiveMessage.Reply(
+			bot,
+			"you don't have permission to change settings",
+			nil,
+		)
+		return nil
+	}
+	userInput := strings.ToLower(args[1])
+	var value time.Duration
+	if userInput != "default" {
+		duration, err := time.ParseDuration(userInput)
+		if err != nil || duration < time.Second {
+			ctx.EffectiveMessage.Reply(
+				bot,
+				fmt.Sprintf("invalid value (%s), use a duration like 10m or default", userInput),
+				nil,
+			)
+			return nil
+		}
+		if duration > config.Env().MaxDuration {
+			ctx.EffectiveMessage.Reply(
+				bot,
+				fmt.Sprintf("max duration can't be higher than the instance limit (%s)", config.Env().MaxDuration),
+				nil,
+			)
+			return nil
+		}
+		value = duration.Truncate(time.Second)
+	}
+	err := database.UpdateGroupMaxDuration(chatID, int(value.Seconds()))
+	if err != nil {
+		return err
+	}
+	message := "max duration set to default"
+	if value > 0 {
+		// see SetGroupLimits
+		message = fmt.Sprintf("max duration set to %s, services with a lower limit keep it", value)
+	}
+	ctx.EffectiveMessage.Reply(
+		bot,
+		message,
+		nil,
+	)
+	return nil
+}
@@ -55,7 +55,7 @@ func getStartKeyboard(bot *gotgbot.Bot) gotgbot.InlineKeyboardMarkup {
 				},
 				{
 					Text: "github",
-					Url:  config.Env.RepoURL,
+					Url:  config.Env().RepoURL,
 				},
 			},
 		},
@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/govdbot/govd/bot/core"
 	"github.com/govdbot/govd/database"
+	"github.com/govdbot/govd/enums"
 	extractors "github.com/govdbot/govd/ext"
+	"github.com/govdbot/govd/models"
+	"github.com/govdbot/govd/util"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
@@ -30,6 +34,22 @@ func URLHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 		return nil
 	}
 	dlCtx.IsSpoiler = isSpoiler(ctx.EffectiveMessage)
+	dlCtx.SubtitlesMode, dlCtx.SubtitlesLanguage = getSubtitlesRequest(ctx.EffectiveMessage)
+	if dlCtx.Extractor.HasTimestamps {
+		dlCtx.Clip = util.GetURLClip(messageURL)
+	}
+	dlCtx.NoteMode = getNoteMode(ctx.EffectiveMessage)
+	return handleDownload(bot, ctx, dlCtx, 10*time.Minute)
+}
+
+// loads the group settings and the user,
+// then runs the download request
+func handleDownload(
+	bot *gotgbot.Bot,
+	ctx *ext.Context,
+	dlCtx *models.DownloadContext,
+	timeout time.Duration,
+) error {
 	userID := ctx.EffectiveMessage.From.Id
 	if ctx.EffectiveMessage.Chat.Type != gotgbot.ChatTypePrivate {
 		settings, err := database.GetGroupSettings(ctx.EffectiveMessage.Chat.Id)
@@ -37,19 +57,23 @@ func URLHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 			return err
 		}
 		dlCtx.GroupSettings = settings
+		dlCtx.SendOriginals = settings.SendOriginals
 	}
 	if userID != 1087968824 {
 		// groupAnonymousBot
-		_, err = database.GetUser(userID)
+		user, err := database.GetUser(userID)
 		if err != nil {
 			return err
 		}
+		if dlCtx.GroupSettings == nil {
+			dlCtx.SendOriginals = user.SendOriginals
+		}
 	}
 
-	taskCtx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	taskCtx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	err = core.HandleDownloadRequest(
+	err := core.HandleDownloadRequest(
 		bot, ctx, taskCtx, dlCtx)
 	if err != nil {
 		if dlCtx.GroupSettings != nil && *dlCtx.GroupSettings.Silent {
@@ -92,6 +116,46 @@ func isSpoiler(msg *gotgbot.Message) bool {
 		hashtagEntity(msg, "nsfw")
 }
 
+// medias are converted to voice messages
+// with #voice, or to video notes with #round
+func getNoteMode(msg *gotgbot.Message) enums.NoteMode {
+	switch {
+	case hashtagEntity(msg, "voice"):
+		return enums.NoteModeVoice
+	case hashtagEntity(msg, "round"):
+		return enums.NoteModeVideo
+	}
+	return enums.NoteModeNone
+}
+
+// subtitles are requested with #subs (embedded in the video)
+// or #srt (sent as a document). a language can be appended,
+// e.g. #subs_es, otherwise the user's language is preferred
+func getSubtitlesRequest(msg *gotgbot.Message) (enums.SubtitlesMode, string) {
+	for _, ent := range msg.Entities {
+		if ent.Type != "hashtag" {
+			continue
+		}
+		parsedEntity := gotgbot.ParseEntity(
+			msg.Text,
+			ent,
+		)
+		tag, language, _ := strings.Cut(
+			strings.TrimPrefix(parsedEntity.Text, "#"), "_",
+		)
+		if language == "" && msg.From != nil {
+			language = msg.From.LanguageCode
+		}
+		switch strings.ToLower(tag) {
+		case "subs":
+			return enums.SubtitlesModeEmbed, language
+		case "srt":
+			return enums.SubtitlesModeDocument, language
+		}
+	}
+	return enums.SubtitlesModeNone, ""
+}
+
 func getMessageURL(msg *gotgbot.Message) string {
 	for _, entity := range msg.Entities {
 		if entity.Type != "url" {
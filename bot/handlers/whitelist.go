@@ -19,8 +19,8 @@ func WhitelistHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 	default:
 		return ext.ContinueGroups
 	}
-	if len(config.Env.Whitelist) > 0 {
-		if !slices.Contains(config.Env.Whitelist, effectiveID) {
+	if len(config.Env().Whitelist) > 0 {
+		if !slices.Contains(config.Env().Whitelist, effectiveID) {
 			if ctx.CallbackQuery != nil {
 				ctx.CallbackQuery.Answer(bot, nil)
 			} else if ctx.InlineQuery != nil {
@@ -25,7 +25,7 @@ var allowedUpdates = []string{
 }
 
 func Start() {
-	b, err := gotgbot.NewBot(config.Env.BotToken, &gotgbot.BotOpts{
+	b, err := gotgbot.NewBot(config.Env().BotToken, &gotgbot.BotOpts{
 		BotClient: NewBotClient(),
 	})
 	if err != nil {
@@ -43,7 +43,7 @@ func Start() {
 				debug.Stack(),
 			)
 		},
-		MaxRoutines: config.Env.ConcurrentUpdates,
+		MaxRoutines: config.Env().ConcurrentUpdates,
 	})
 	updater := ext.NewUpdater(dispatcher, nil)
 	registerHandlers(dispatcher)
@@ -82,6 +82,22 @@ func registerHandlers(dispatcher *ext.Dispatcher) {
 		callbackquery.Equal("help"),
 		botHandlers.HelpHandler,
 	))
+	dispatcher.AddHandler(handlers.NewCommand(
+		"record",
+		botHandlers.RecordHandler,
+	))
+	dispatcher.AddHandler(handlers.NewCommand(
+		"clip",
+		botHandlers.ClipHandler,
+	))
+	dispatcher.AddHandler(handlers.NewCommand(
+		"voice",
+		botHandlers.VoiceHandler,
+	))
+	dispatcher.AddHandler(handlers.NewCommand(
+		"round",
+		botHandlers.RoundHandler,
+	))
 	dispatcher.AddHandler(handlers.NewCommand(
 		"settings",
 		botHandlers.SettingsHandler,
@@ -102,6 +118,34 @@ func registerHandlers(dispatcher *ext.Dispatcher) {
 		"silent",
 		botHandlers.SilentHandler,
 	))
+	dispatcher.AddHandler(handlers.NewCommand(
+		"language",
+		botHandlers.AudioLanguageHandler,
+	))
+	dispatcher.AddHandler(handlers.NewCommand(
+		"slideshow",
+		botHandlers.SlideshowHandler,
+	))
+	dispatcher.AddHandler(handlers.NewCommand(
+		"originals",
+		botHandlers.OriginalsHandler,
+	))
+	dispatcher.AddHandler(handlers.NewCommand(
+		"normalize",
+		botHandlers.NormalizeHandler,
+	))
+	dispatcher.AddHandler(handlers.NewCommand(
+		"audiocodec",
+		botHandlers.AudioCodecHandler,
+	))
+	dispatcher.AddHandler(handlers.NewCommand(
+		"maxsize",
+		botHandlers.MaxFileSizeHandler,
+	))
+	dispatcher.AddHandler(handlers.NewCommand(
+		"maxduration",
+		botHandlers.MaxDurationHandler,
+	))
 	dispatcher.AddHandler(handlers.NewCallback(
 		callbackquery.Equal("stats"),
 		botHandlers.StatsHandler,
@@ -52,7 +52,7 @@ func NewBotClient() Client {
 			UseTestEnvironment: false,
 			DefaultRequestOpts: &gotgbot.RequestOpts{
 				Timeout: 10 * time.Minute,
-				APIURL:  config.Env.BotAPIURL,
+				APIURL:  config.Env().BotAPIURL,
 			},
 		},
 	}
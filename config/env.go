@@ -1,9 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
@@ -12,166 +14,210 @@ import (
 	"go.uber.org/zap"
 )
 
-var Env = GetDefaultConfig()
+// the current options, replaced as a whole on reload
+var currentEnv atomic.Pointer[models.EnvConfig]
 
-func LoadEnv() error {
-	if value := os.Getenv("DB_HOST"); value != "" {
-		Env.DBHost = value
-	} else {
-		zap.S().Fatalf("DB_HOST env is not set")
-	}
-	if value := os.Getenv("DB_PORT"); value != "" {
-		if port, err := strconv.Atoi(value); err == nil {
-			Env.DBPort = port
-		} else {
-			zap.S().Fatal("DB_PORT env is not a valid integer")
+func init() {
+	currentEnv.Store(GetDefaultConfig())
+}
+
+// Env returns the current options. the returned
+// config must not be modified, as it's shared
+func Env() *models.EnvConfig {
+	return currentEnv.Load()
+}
+
+type parseFunc func(cfg *models.EnvConfig, value string) error
+
+// option is set by its env var, by a file named by the env
+// var with the _FILE suffix (e.g. docker secrets), or by its
+// lowercase name under the bot key of config.yaml
+type option struct {
+	name     string
+	required bool
+	// a warning is logged when the default is used
+	warnDefault bool
+	parse       parseFunc
+}
+
+var options = []option{
+	{name: "DB_HOST", required: true, parse: stringVar(func(cfg *models.EnvConfig) *string { return &cfg.DBHost })},
+	{name: "DB_PORT", required: true, parse: intVar(func(cfg *models.EnvConfig) *int { return &cfg.DBPort })},
+	{name: "DB_NAME", required: true, parse: stringVar(func(cfg *models.EnvConfig) *string { return &cfg.DBName })},
+	{name: "DB_USER", required: true, parse: stringVar(func(cfg *models.EnvConfig) *string { return &cfg.DBUser })},
+	{name: "DB_PASSWORD", required: true, parse: stringVar(func(cfg *models.EnvConfig) *string { return &cfg.DBPassword })},
+
+	{name: "BOT_TOKEN", required: true, parse: stringVar(func(cfg *models.EnvConfig) *string { return &cfg.BotToken })},
+	{name: "BOT_API_URL", warnDefault: true, parse: stringVar(func(cfg *models.EnvConfig) *string { return &cfg.BotAPIURL })},
+	{name: "CONCURRENT_UPDATES", warnDefault: true, parse: intVar(func(cfg *models.EnvConfig) *int { return &cfg.ConcurrentUpdates })},
+
+	{name: "DOWNLOADS_DIR", warnDefault: true, parse: stringVar(func(cfg *models.EnvConfig) *string { return &cfg.DownloadsDirectory })},
+	{name: "DOWNLOADS_QUOTA", parse: scaledVar(func(cfg *models.EnvConfig) *int64 { return &cfg.DownloadsQuota }, 1024*1024)},
+	{name: "MIN_FREE_SPACE", parse: scaledVar(func(cfg *models.EnvConfig) *int64 { return &cfg.MinFreeSpace }, 1024*1024)},
+
+	{name: "HTTP_PROXY", parse: stringVar(func(cfg *models.EnvConfig) *string { return &cfg.HTTPProxy })},
+	{name: "HTTPS_PROXY", parse: stringVar(func(cfg *models.EnvConfig) *string { return &cfg.HTTPSProxy })},
+	{name: "NO_PROXY", parse: stringVar(func(cfg *models.EnvConfig) *string { return &cfg.NoProxy })},
+
+	{name: "MAX_DURATION", parse: durationVar(func(cfg *models.EnvConfig) *time.Duration { return &cfg.MaxDuration })},
+	{name: "MAX_FILE_SIZE", parse: scaledVar(func(cfg *models.EnvConfig) *int64 { return &cfg.MaxFileSize }, 1024*1024)},
+	{name: "MAX_IMAGE_SIZE", parse: scaledVar(func(cfg *models.EnvConfig) *int64 { return &cfg.MaxImageSize }, 1024*1024)},
+	{name: "MAX_IMAGE_PIXELS", parse: scaledVar(func(cfg *models.EnvConfig) *int64 { return &cfg.MaxImagePixels }, 1000*1000)},
+	{name: "REPO_URL", parse: stringVar(func(cfg *models.EnvConfig) *string { return &cfg.RepoURL })},
+	{name: "PROFILER_PORT", parse: intVar(func(cfg *models.EnvConfig) *int { return &cfg.ProfilerPort })},
+	{name: "LOG_LEVEL", parse: parseLogLevel},
+	{name: "LOG_FILE", parse: boolVar(func(cfg *models.EnvConfig) *bool { return &cfg.LogFile })},
+	{name: "WHITELIST", parse: parseWhitelist},
+	{name: "CACHING", warnDefault: true, parse: boolVar(func(cfg *models.EnvConfig) *bool { return &cfg.Caching })},
+	{name: "CAPTION_HEADER", parse: stringVar(func(cfg *models.EnvConfig) *string { return &cfg.CaptionHeader })},
+	{name: "CAPTION_DESCRIPTION", parse: stringVar(func(cfg *models.EnvConfig) *string { return &cfg.CaptionDescription })},
+
+	{name: "DEFAULT_ENABLE_CAPTIONS", parse: boolVar(func(cfg *models.EnvConfig) *bool { return &cfg.DefaultCaptions })},
+	{name: "DEFAULT_ENABLE_SILENT", parse: boolVar(func(cfg *models.EnvConfig) *bool { return &cfg.DefaultSilent })},
+	{name: "DEFAULT_ENABLE_NSFW", parse: boolVar(func(cfg *models.EnvConfig) *bool { return &cfg.DefaultNSFW })},
+	{name: "DEFAULT_MEDIA_LIMIT", parse: parseMediaLimit},
+}
+
+// loadEnv parses every option over the defaults, with the values
+// of the bot key of config.yaml. all the errors are returned,
+// so that they can be fixed at once
+func loadEnv(fileValues map[string]string) (*models.EnvConfig, []error) {
+	cfg := GetDefaultConfig()
+	var errs []error
+	for _, opt := range options {
+		value, err := lookupOption(opt.name, fileValues)
+		if err != nil {
+			errs = append(errs, err)
+			continue
 		}
-	} else {
-		zap.S().Fatalf("DB_PORT env is not set")
-	}
-	if value := os.Getenv("DB_NAME"); value != "" {
-		Env.DBName = value
-	} else {
-		zap.S().Fatal("DB_NAME env is not set")
-	}
-	if value := os.Getenv("DB_USER"); value != "" {
-		Env.DBUser = value
-	} else {
-		zap.S().Fatalf("DB_USER env is not set")
-	}
-	if value := os.Getenv("DB_PASSWORD"); value != "" {
-		Env.DBPassword = value
-	} else {
-		zap.S().Fatalf("DB_PASSWORD env is not set")
-	}
-	if value := os.Getenv("BOT_TOKEN"); value != "" {
-		Env.BotToken = value
-	} else {
-		zap.S().Fatalf("BOT_TOKEN env is not set")
-	}
-	if value := os.Getenv("BOT_API_URL"); value != "" {
-		Env.BotAPIURL = value
-	} else {
-		zap.S().Warnf("BOT_API_URL is not set, using default %s", Env.BotAPIURL)
-	}
-	if value := os.Getenv("CONCURRENT_UPDATES"); value != "" {
-		if updates, err := strconv.Atoi(value); err == nil {
-			Env.ConcurrentUpdates = updates
-		} else {
-			zap.S().Fatal("CONCURRENT_UPDATES env is not a valid integer")
+		if value == "" {
+			if opt.required {
+				errs = append(errs, fmt.Errorf("%s is not set", opt.name))
+			} else if opt.warnDefault {
+				zap.S().Warnf("%s is not set, using the default value", opt.name)
+			}
+			continue
 		}
-	} else {
-		zap.S().Warnf("CONCURRENT_UPDATES is not set, using default %d", Env.ConcurrentUpdates)
-	}
-	if value := os.Getenv("DOWNLOADS_DIR"); value != "" {
-		Env.DownloadsDirectory = value
-	} else {
-		zap.S().Warnf("DOWNLOADS_DIR is not set, using default %s", Env.DownloadsDirectory)
-	}
-	if value := os.Getenv("HTTP_PROXY"); value != "" {
-		Env.HTTPProxy = value
-	}
-	if value := os.Getenv("HTTPS_PROXY"); value != "" {
-		Env.HTTPSProxy = value
-	}
-	if value := os.Getenv("NO_PROXY"); value != "" {
-		Env.NoProxy = value
-	}
-	if value := os.Getenv("MAX_DURATION"); value != "" {
-		if duration, err := time.ParseDuration(value); err == nil {
-			Env.MaxDuration = duration
-		} else {
-			zap.S().Fatalf("MAX_DURATION env is not a valid duration: %v", err)
+		if err := opt.parse(cfg, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s %w", opt.name, err))
 		}
 	}
-	if value := os.Getenv("MAX_FILE_SIZE"); value != "" {
-		if size, err := strconv.Atoi(value); err == nil {
-			Env.MaxFileSize = int64(size) * 1024 * 1024
+	return cfg, errs
+}
+
+// the env var takes precedence over its _FILE
+// variant, which takes precedence over config.yaml
+func lookupOption(name string, fileValues map[string]string) (string, error) {
+	if value := os.Getenv(name); value != "" {
+		return value, nil
+	}
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed reading %s_FILE: %w", name, err)
 		}
+		return strings.TrimSpace(string(data)), nil
 	}
-	if value := os.Getenv("REPO_URL"); value != "" {
-		Env.RepoURL = value
-	}
-	if value := os.Getenv("PROFILER_PORT"); value != "" {
-		if port, err := strconv.Atoi(value); err == nil {
-			Env.ProfilerPort = port
-		} else {
-			zap.S().Fatal("PROFILER_PORT env is not a valid integer")
+	return fileValues[strings.ToLower(name)], nil
+}
+
+func isOption(key string) bool {
+	for _, opt := range options {
+		if strings.ToLower(opt.name) == key {
+			return true
 		}
 	}
-	if value := os.Getenv("LOG_LEVEL"); value != "" {
-		Env.LogLevel = value
+	return false
+}
+
+func stringVar(field func(*models.EnvConfig) *string) parseFunc {
+	return func(cfg *models.EnvConfig, value string) error {
+		*field(cfg) = value
+		return nil
 	}
-	if value := os.Getenv("LOG_FILE"); value != "" {
-		if logFile, err := strconv.ParseBool(value); err == nil {
-			Env.LogFile = logFile
-		} else {
-			zap.S().Fatal("LOG_FILE env is not a valid boolean")
+}
+
+func intVar(field func(*models.EnvConfig) *int) parseFunc {
+	return func(cfg *models.EnvConfig, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("is not a valid integer: %s", value)
 		}
+		*field(cfg) = parsed
+		return nil
 	}
-	if value := os.Getenv("WHITELIST"); value != "" {
-		parts := strings.Split(value, ",")
-		for _, part := range parts {
-			part = strings.TrimSpace(part)
-			if part == "" {
-				continue
-			}
-			id, err := strconv.ParseInt(part, 10, 64)
-			if err != nil {
-				zap.S().Fatalf("WHITELIST env contains an invalid ID: %s", part)
-			}
-			if part != "" {
-				Env.Whitelist = append(Env.Whitelist, id)
-			}
+}
+
+// scaledVar parses an integer in a larger
+// unit, like MB, into its base unit
+func scaledVar(field func(*models.EnvConfig) *int64, unit int64) parseFunc {
+	return func(cfg *models.EnvConfig, value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("is not a valid integer: %s", value)
+		}
+		if parsed < 0 {
+			return fmt.Errorf("can't be negative: %s", value)
 		}
+		*field(cfg) = parsed * unit
+		return nil
 	}
-	if value := os.Getenv("CACHING"); value != "" {
-		if caching, err := strconv.ParseBool(value); err == nil {
-			Env.Caching = caching
-		} else {
-			zap.S().Fatal("CACHING env is not a valid boolean")
+}
+
+func boolVar(field func(*models.EnvConfig) *bool) parseFunc {
+	return func(cfg *models.EnvConfig, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("is not a valid boolean: %s", value)
 		}
-	} else {
-		zap.S().Warnf("CACHING is not set, using default %t", Env.Caching)
+		*field(cfg) = parsed
+		return nil
 	}
-	if value := os.Getenv("CAPTION_HEADER"); value != "" {
-		Env.CaptionHeader = value
+}
+
+func durationVar(field func(*models.EnvConfig) *time.Duration) parseFunc {
+	return func(cfg *models.EnvConfig, value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("is not a valid duration: %s", value)
+		}
+		*field(cfg) = parsed
+		return nil
 	}
-	if value := os.Getenv("CAPTION_DESCRIPTION"); value != "" {
-		Env.CaptionDescription = value
+}
+
+func parseLogLevel(cfg *models.EnvConfig, value string) error {
+	if _, err := zap.ParseAtomicLevel(value); err != nil {
+		return fmt.Errorf("is not a valid log level: %s", value)
 	}
-	if value := os.Getenv("DEFAULT_ENABLE_CAPTIONS"); value != "" {
-		if defaultCaptions, err := strconv.ParseBool(value); err == nil {
-			Env.DefaultCaptions = defaultCaptions
-		} else {
-			zap.S().Fatal("DEFAULT_ENABLE_CAPTIONS env is not a valid boolean")
+	cfg.LogLevel = value
+	return nil
+}
+
+func parseWhitelist(cfg *models.EnvConfig, value string) error {
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
 		}
-	}
-	if value := os.Getenv("DEFAULT_ENABLE_SILENT"); value != "" {
-		if defaultSilent, err := strconv.ParseBool(value); err == nil {
-			Env.DefaultSilent = defaultSilent
-		} else {
-			zap.S().Fatal("DEFAULT_ENABLE_SILENT env is not a valid boolean")
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return fmt.Errorf("contains an invalid ID: %s", part)
 		}
+		cfg.Whitelist = append(cfg.Whitelist, id)
 	}
-	if value := os.Getenv("DEFAULT_ENABLE_NSFW"); value != "" {
-		if defaultNSFW, err := strconv.ParseBool(value); err == nil {
-			Env.DefaultNSFW = defaultNSFW
-		} else {
-			zap.S().Fatal("DEFAULT_ENABLE_NSFW env is not a valid boolean")
-		}
+	return nil
+}
+
+func parseMediaLimit(cfg *models.EnvConfig, value string) error {
+	limit, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("is not a valid integer: %s", value)
 	}
-	if value := os.Getenv("DEFAULT_MEDIA_LIMIT"); value != "" {
-		if defaultMediaLimit, err := strconv.Atoi(value); err == nil {
-			if defaultMediaLimit >= 1 && defaultMediaLimit <= 20 {
-				Env.DefaultMediaGroupLimit = defaultMediaLimit
-			} else {
-				zap.S().Fatal("DEFAULT_MEDIA_LIMIT must be between 1 and 20")
-			}
-		} else {
-			zap.S().Fatal("DEFAULT_MEDIA_LIMIT env is not a valid integer")
-		}
+	if limit < 1 || limit > 20 {
+		return fmt.Errorf("must be between 1 and 20: %d", limit)
 	}
+	cfg.DefaultMediaGroupLimit = limit
 	return nil
 }
 
@@ -193,6 +239,9 @@ func GetDefaultConfig() *models.EnvConfig {
 		LogLevel:    "info",
 		Caching:     true,
 
+		MaxImageSize:   50 * 1024 * 1024,  // 50MB
+		MaxImagePixels: 100 * 1000 * 1000, // 100MP
+
 		CaptionHeader:      "<a href='{{url}}'>source</a> - @govd_bot",
 		CaptionDescription: "<blockquote expandable>{{text}}</blockquote>",
 
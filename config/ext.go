@@ -1,44 +1,262 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"maps"
+	"net/url"
 	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/govdbot/govd/models"
 
 	"gopkg.in/yaml.v3"
 )
 
-const configPath = "config.yaml"
+const (
+	configPath = "config.yaml"
+	// top-level key holding external plugins
+	pluginsKey = "plugins"
+	// top-level key holding the options of the
+	// .env file, every other key is an extractor
+	botKey = "bot"
+)
+
+var (
+	extractorConfigs   map[string]*models.ExtractorConfig
+	extractorConfigsMu sync.RWMutex
+	externalPlugins    []*models.ExternalPluginConfig
+)
 
-var extractorConfigs map[string]*models.ExtractorConfig
+// contents of config.yaml
+type fileConfig struct {
+	botValues        map[string]string
+	extractorConfigs map[string]*models.ExtractorConfig
+	externalPlugins  []*models.ExternalPluginConfig
+}
 
-func LoadExtractorConfigs() error {
-	extractorConfigs = make(map[string]*models.ExtractorConfig)
+// readConfigFile parses config.yaml, which is optional. every
+// error is returned, so that they can be fixed at once. unknown
+// options are returned as unknownOptionError
+func readConfigFile() (*fileConfig, []error) {
+	cfg := &fileConfig{
+		botValues:        make(map[string]string),
+		extractorConfigs: make(map[string]*models.ExtractorConfig),
+	}
 
 	_, err := os.Stat(configPath)
 	if os.IsNotExist(err) {
-		return nil
+		return cfg, nil
 	}
 	data, err := os.ReadFile(configPath)
 	if err != nil {
-		return fmt.Errorf("failed reading config file: %w", err)
+		return nil, []error{fmt.Errorf("failed reading config file: %w", err)}
 	}
 
-	var rawConfig map[string]*models.ExtractorConfig
+	var rawConfig map[string]yaml.Node
 
 	if err := yaml.Unmarshal(data, &rawConfig); err != nil {
-		return fmt.Errorf("failed parsing config file: %w", err)
+		return nil, []error{fmt.Errorf("failed parsing config file: %w", err)}
 	}
-	maps.Copy(extractorConfigs, rawConfig)
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(rawConfig)) {
+		node := rawConfig[key]
+		switch key {
+		case botKey:
+			values, botErrs := decodeBotValues(&node)
+			for _, err := range botErrs {
+				errs = append(errs, fmt.Errorf("failed parsing %s: %w", botKey, err))
+			}
+			cfg.botValues = values
+		case pluginsKey:
+			for _, err := range decodeStrict(&node, &cfg.externalPlugins) {
+				errs = append(errs, fmt.Errorf("failed parsing plugins: %w", err))
+			}
+		default:
+			var extractorConfig *models.ExtractorConfig
+			if err := node.Decode(&extractorConfig); err != nil {
+				errs = append(errs, fmt.Errorf("failed parsing %s config: %w", key, err))
+				continue
+			}
+			for _, err := range unknownFields(&node, reflect.TypeOf(extractorConfig)) {
+				errs = append(errs, fmt.Errorf("failed parsing %s config: %w", key, err))
+			}
+			for _, err := range validateExtractorConfig(extractorConfig) {
+				errs = append(errs, fmt.Errorf("invalid %s config: %w", key, err))
+			}
+			cfg.extractorConfigs[key] = extractorConfig
+		}
+	}
+	return cfg, errs
+}
 
-	return nil
+// unknown options are often typos. they fail
+// config check, but are only logged when loading
+type unknownOptionError struct {
+	line int // zero when unknown
+	name string
+}
+
+func (err *unknownOptionError) Error() string {
+	if err.line == 0 {
+		return "unknown option: " + err.name
+	}
+	return fmt.Sprintf("line %d: unknown option %s", err.line, err.name)
+}
+
+// decodeStrict decodes the node, reporting unknown options
+func decodeStrict(node *yaml.Node, out any) []error {
+	if err := node.Decode(out); err != nil {
+		return []error{err}
+	}
+	return unknownFields(node, reflect.TypeOf(out))
+}
+
+// unknownFields returns the keys of the node that aren't fields of
+// the type, following nested structs, lists and maps. node.Decode
+// can't reject them like a decoder with KnownFields
+func unknownFields(node *yaml.Node, typ reflect.Type) []error {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	var errs []error
+	switch {
+	case typ.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := make(map[string]reflect.Type)
+		for i := range typ.NumField() {
+			field := typ.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if name != "" && name != "-" {
+				fields[name] = field.Type
+			}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				errs = append(errs, &unknownOptionError{line: key.Line, name: key.Value})
+				continue
+			}
+			errs = append(errs, unknownFields(value, fieldType)...)
+		}
+	case typ.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			errs = append(errs, unknownFields(node.Content[i], typ.Elem())...)
+		}
+	case typ.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for _, item := range node.Content {
+			errs = append(errs, unknownFields(item, typ.Elem())...)
+		}
+	}
+	return errs
+}
+
+// the options are parsed as the env vars are,
+// lists are joined with commas, like the whitelist
+func decodeBotValues(node *yaml.Node) (map[string]string, []error) {
+	var rawValues map[string]yaml.Node
+	if err := node.Decode(&rawValues); err != nil {
+		return nil, []error{err}
+	}
+	values := make(map[string]string, len(rawValues))
+	var errs []error
+	for _, key := range slices.Sorted(maps.Keys(rawValues)) {
+		value := rawValues[key]
+		if !isOption(key) {
+			errs = append(errs, &unknownOptionError{name: key})
+			continue
+		}
+		switch value.Kind {
+		case yaml.ScalarNode:
+			values[key] = value.Value
+		case yaml.SequenceNode:
+			items := make([]string, 0, len(value.Content))
+			for _, item := range value.Content {
+				items = append(items, item.Value)
+			}
+			values[key] = strings.Join(items, ",")
+		default:
+			errs = append(errs, fmt.Errorf("%s must be a value or a list", key))
+		}
+	}
+	return values, errs
+}
+
+func validateExtractorConfig(cfg *models.ExtractorConfig) []error {
+	if cfg == nil {
+		return nil
+	}
+	var errs []error
+	if cfg.EdgeProxyURL != "" {
+		parsedURL, err := url.Parse(cfg.EdgeProxyURL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+			errs = append(errs, fmt.Errorf("edge_proxy_url is not a valid url: %s", cfg.EdgeProxyURL))
+		}
+	}
+	download := cfg.Download
+	if download == nil {
+		return errs
+	}
+	if download.ChunkSize < 0 || download.Concurrency < 0 || download.Retries < 0 ||
+		download.MaxFileSize < 0 {
+		errs = append(errs, errors.New("download values can't be negative"))
+	}
+	if download.Timeout < 0 || download.MaxDuration < 0 {
+		errs = append(errs, errors.New("download durations can't be negative"))
+	}
+	return errs
+}
+
+func setExtractorConfigs(configs map[string]*models.ExtractorConfig) {
+	extractorConfigsMu.Lock()
+	defer extractorConfigsMu.Unlock()
+	extractorConfigs = configs
 }
 
 func GetExtractorConfig(extractor *models.Extractor) *models.ExtractorConfig {
+	extractorConfigsMu.RLock()
+	defer extractorConfigsMu.RUnlock()
 	if config, exists := extractorConfigs[extractor.CodeName]; exists {
 		return config
 	}
 	return nil
 }
+
+// GetExtractorConfigNames returns the
+// extractors configured in config.yaml
+func GetExtractorConfigNames() []string {
+	extractorConfigsMu.RLock()
+	defer extractorConfigsMu.RUnlock()
+	names := make([]string, 0, len(extractorConfigs))
+	for name := range extractorConfigs {
+		names = append(names, name)
+	}
+	return names
+}
+
+func GetExternalPlugins() []*models.ExternalPluginConfig {
+	return externalPlugins
+}
+
+func GetPluginConfig(extractorCodeName string, pluginName string) *models.PluginConfig {
+	extractorConfigsMu.RLock()
+	defer extractorConfigsMu.RUnlock()
+	config, exists := extractorConfigs[extractorCodeName]
+	if !exists || config == nil {
+		return nil
+	}
+	return config.Plugins[pluginName]
+}
+
+// GetExtractorDownloadConfig returns the download block
+// of the extractor config, nil if it has none
+func GetExtractorDownloadConfig(extractor *models.Extractor) *models.ExtractorDownloadConfig {
+	config := GetExtractorConfig(extractor)
+	if config == nil {
+		return nil
+	}
+	return config.Download
+}
@@ -1,20 +1,180 @@
 package config
 
 import (
+	"errors"
+	"io/fs"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/govdbot/govd/models"
+
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 )
 
+const (
+	envPath = ".env"
+	// netscape cookie files, named after the extractors
+	CookiesDirectory = "cookies"
+)
+
+var (
+	// env vars set before the .env file was loaded,
+	// which its values never override
+	processEnv     = make(map[string]bool)
+	processEnvOnce sync.Once
+	// env vars set from the .env file
+	envFileKeys = make(map[string]bool)
+
+	reloadHooks []func()
+	reloadMu    sync.Mutex
+)
+
 func Load() error {
-	err := godotenv.Load()
-	if err != nil {
+	recordProcessEnv()
+	if err := loadEnvFile(); err != nil {
 		zap.S().Warn("failed to load .env file. using system env")
 	}
-	if err := LoadEnv(); err != nil {
-		return err
+	env, fileCfg, errs := load()
+	errs = warnUnknownOptions(errs)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
 	}
-	if err := LoadExtractorConfigs(); err != nil {
-		return err
+	apply(env, fileCfg)
+	return nil
+}
+
+// Check loads the configuration, returning every error found,
+// unknown options included. it's applied when it has none, so
+// that what depends on it can be checked too
+func Check() []error {
+	recordProcessEnv()
+	loadEnvFile()
+	env, fileCfg, errs := load()
+	if len(errs) == 0 {
+		apply(env, fileCfg)
+	}
+	return errs
+}
+
+func apply(env *models.EnvConfig, fileCfg *fileConfig) {
+	currentEnv.Store(env)
+	setExtractorConfigs(fileCfg.extractorConfigs)
+	externalPlugins = fileCfg.externalPlugins
+}
+
+func load() (*models.EnvConfig, *fileConfig, []error) {
+	fileCfg, errs := readConfigFile()
+	if fileCfg == nil {
+		return nil, nil, errs
 	}
+	env, envErrs := loadEnv(fileCfg.botValues)
+	return env, fileCfg, append(errs, envErrs...)
+}
+
+// OnReload registers a function called after the configuration
+// is reloaded, to drop what was built from the previous one
+func OnReload(hook func()) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadHooks = append(reloadHooks, hook)
+}
+
+// Reload reads the configuration again and applies the extractor
+// configs and the limits. if it has errors, the current one is kept.
+// the other options need a restart
+func Reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	if err := loadEnvFile(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		zap.S().Warnf("failed to reload .env file: %v", err)
+	}
+	env, fileCfg, errs := load()
+	errs = warnUnknownOptions(errs)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	// readers keep the config they loaded,
+	// a new one is published with the changes
+	current := Env()
+	next := *current
+	applyReloadable(&next, env)
+	if !reflect.DeepEqual(next, *env) {
+		zap.S().Warn("some changed options are only applied after a restart")
+	}
+	currentEnv.Store(&next)
+	if !reflect.DeepEqual(externalPlugins, fileCfg.externalPlugins) {
+		zap.S().Warn("external plugins are only reloaded after a restart")
+	}
+	setExtractorConfigs(fileCfg.extractorConfigs)
+
+	for _, hook := range reloadHooks {
+		hook()
+	}
+	zap.S().Info("configuration reloaded")
 	return nil
 }
+
+// logs the unknown options, which only fail config
+// check, and returns the other errors
+func warnUnknownOptions(errs []error) []error {
+	var fatal []error
+	for _, err := range errs {
+		var unknownErr *unknownOptionError
+		if errors.As(err, &unknownErr) {
+			zap.S().Warn(err)
+			continue
+		}
+		fatal = append(fatal, err)
+	}
+	return fatal
+}
+
+// options applied without restarting the bot
+func applyReloadable(current *models.EnvConfig, next *models.EnvConfig) {
+	current.DownloadsQuota = next.DownloadsQuota
+	current.MinFreeSpace = next.MinFreeSpace
+	current.MaxDuration = next.MaxDuration
+	current.MaxFileSize = next.MaxFileSize
+	current.MaxImageSize = next.MaxImageSize
+	current.MaxImagePixels = next.MaxImagePixels
+	current.LogLevel = next.LogLevel
+}
+
+func recordProcessEnv() {
+	processEnvOnce.Do(func() {
+		for _, name := range os.Environ() {
+			key, _, _ := strings.Cut(name, "=")
+			processEnv[key] = true
+		}
+	})
+}
+
+// sets the values of the .env file, unless they come from the
+// environment of the process. godotenv doesn't override env vars,
+// so they are set again when reloading, and the ones removed
+// from the file are unset
+func loadEnvFile() error {
+	values, err := godotenv.Read(envPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		values = nil
+	} else if err != nil {
+		return err
+	}
+	for key := range envFileKeys {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+			delete(envFileKeys, key)
+		}
+	}
+	for key, value := range values {
+		if !processEnv[key] {
+			os.Setenv(key, value)
+			envFileKeys[key] = true
+		}
+	}
+	return err
+}
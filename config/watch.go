@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// how often the files are checked for changes
+const watchInterval = 5 * time.Second
+
+// Watch reloads the configuration on SIGHUP, and when
+// config.yaml, the .env file or the cookies change
+func Watch() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	ticker := time.NewTicker(watchInterval)
+
+	go func() {
+		fingerprint := getFilesFingerprint()
+		for {
+			select {
+			case <-signals:
+				zap.S().Info("received SIGHUP, reloading configuration")
+			case <-ticker.C:
+				current := getFilesFingerprint()
+				if current == fingerprint {
+					continue
+				}
+				zap.S().Info("configuration files changed, reloading")
+			}
+			fingerprint = getFilesFingerprint()
+			if err := Reload(); err != nil {
+				zap.S().Errorf("failed to reload configuration, keeping the current one:\n%v", err)
+			}
+		}
+	}()
+}
+
+// size and modification time of the watched
+// files, which change when they are written
+func getFilesFingerprint() string {
+	paths := []string{configPath, envPath}
+	entries, err := os.ReadDir(CookiesDirectory)
+	if err == nil {
+		for _, entry := range entries {
+			paths = append(paths, filepath.Join(CookiesDirectory, entry.Name()))
+		}
+	}
+	var fingerprint strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(&fingerprint, "%s:-;", path)
+			continue
+		}
+		fmt.Fprintf(
+			&fingerprint, "%s:%d:%d;",
+			path, info.Size(), info.ModTime().UnixNano(),
+		)
+	}
+	return fingerprint.String()
+}
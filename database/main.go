@@ -37,9 +37,9 @@ func Start() {
 func connect() *gorm.DB {
 	connectionString := fmt.Sprintf(
 		"%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True",
-		config.Env.DBUser, config.Env.DBPassword,
-		config.Env.DBHost, config.Env.DBPort,
-		config.Env.DBName,
+		config.Env().DBUser, config.Env().DBPassword,
+		config.Env().DBHost, config.Env().DBPort,
+		config.Env().DBName,
 	)
 	zap.S().Debug("connecting to database")
 
@@ -23,10 +23,10 @@ func GetGroupSettings(
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			groupSettings = models.GroupSettings{
 				ChatID:          chatID,
-				Captions:        &config.Env.DefaultCaptions,
-				Silent:          &config.Env.DefaultSilent,
-				NSFW:            &config.Env.DefaultNSFW,
-				MediaGroupLimit: config.Env.DefaultMediaGroupLimit,
+				Captions:        &config.Env().DefaultCaptions,
+				Silent:          &config.Env().DefaultSilent,
+				NSFW:            &config.Env().DefaultNSFW,
+				MediaGroupLimit: config.Env().DefaultMediaGroupLimit,
 			}
 			err = DB.Create(&groupSettings).Error
 			if err != nil {
@@ -54,3 +54,103 @@ func UpdateGroupSettings(
 	}
 	return nil
 }
+
+// the language is updated on its own, as
+// updates from structs skip empty values
+func UpdateGroupAudioLanguage(
+	chatID int64,
+	language string,
+) error {
+	return DB.
+		Model(&models.GroupSettings{}).
+		Where(&models.GroupSettings{
+			ChatID: chatID,
+		}).
+		Update("audio_language", language).
+		Error
+}
+
+func UpdateGroupSendOriginals(
+	chatID int64,
+	value bool,
+) error {
+	return DB.
+		Model(&models.GroupSettings{}).
+		Where(&models.GroupSettings{
+			ChatID: chatID,
+		}).
+		Update("send_originals", value).
+		Error
+}
+
+// zero disables slideshows, so
+// it is updated on its own too
+func UpdateGroupSlideshowDelay(
+	chatID int64,
+	delay int,
+) error {
+	return DB.
+		Model(&models.GroupSettings{}).
+		Where(&models.GroupSettings{
+			ChatID: chatID,
+		}).
+		Update("slideshow_delay", delay).
+		Error
+}
+
+func UpdateGroupNormalizeAudio(
+	chatID int64,
+	value bool,
+) error {
+	return DB.
+		Model(&models.GroupSettings{}).
+		Where(&models.GroupSettings{
+			ChatID: chatID,
+		}).
+		Update("normalize_audio", value).
+		Error
+}
+
+// empty keeps the codec of each file
+func UpdateGroupAudioCodec(
+	chatID int64,
+	codec string,
+) error {
+	return DB.
+		Model(&models.GroupSettings{}).
+		Where(&models.GroupSettings{
+			ChatID: chatID,
+		}).
+		Update("audio_codec", codec).
+		Error
+}
+
+// zero removes the group limit, so
+// it is updated on its own too
+func UpdateGroupMaxFileSize(
+	chatID int64,
+	size int,
+) error {
+	return DB.
+		Model(&models.GroupSettings{}).
+		Where(&models.GroupSettings{
+			ChatID: chatID,
+		}).
+		Update("max_file_size", size).
+		Error
+}
+
+// zero removes the group limit, so
+// it is updated on its own too
+func UpdateGroupMaxDuration(
+	chatID int64,
+	seconds int,
+) error {
+	return DB.
+		Model(&models.GroupSettings{}).
+		Where(&models.GroupSettings{
+			ChatID: chatID,
+		}).
+		Update("max_duration", seconds).
+		Error
+}
@@ -19,6 +19,21 @@ func GetUser(
 	return &user, nil
 }
 
+// false is a zero value, so the
+// field is updated on its own
+func UpdateUserSendOriginals(
+	userID int64,
+	value bool,
+) error {
+	return DB.
+		Model(&models.User{}).
+		Where(&models.User{
+			UserID: userID,
+		}).
+		Update("send_originals", value).
+		Error
+}
+
 func UpdateUserStatus(
 	userID int64,
 ) error {
@@ -0,0 +1,9 @@
+package enums
+
+type NoteMode string
+
+const (
+	NoteModeNone  NoteMode = ""
+	NoteModeVoice NoteMode = "voice" // opus voice message
+	NoteModeVideo NoteMode = "round" // square video note
+)
@@ -0,0 +1,9 @@
+package enums
+
+type PluginStage string
+
+const (
+	PluginStagePreDownload  PluginStage = "pre-download"  // before the media is downloaded, with no file yet
+	PluginStagePostDownload PluginStage = "post-download" // right after the media is downloaded
+	PluginStagePreSend      PluginStage = "pre-send"      // after every other processing step, before sending
+)
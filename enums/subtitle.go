@@ -0,0 +1,17 @@
+package enums
+
+type SubtitleFormat string
+
+const (
+	SubtitleFormatWebVTT SubtitleFormat = "vtt"
+	SubtitleFormatTTML   SubtitleFormat = "ttml"
+	SubtitleFormatSRT    SubtitleFormat = "srt"
+)
+
+type SubtitlesMode string
+
+const (
+	SubtitlesModeNone     SubtitlesMode = ""
+	SubtitlesModeEmbed    SubtitlesMode = "embed"    // soft-muxed into the video
+	SubtitlesModeDocument SubtitlesMode = "document" // sent as a separate srt file
+)
@@ -82,6 +82,10 @@ func ParseVideoFormats(
 		if thumbnailURL != "" {
 			format.Thumbnail = []string{thumbnailURL}
 		}
+		if video.HasAudio == 0 {
+			format.AudioCodec = ""
+			format.IsAnimation = true
+		}
 
 		formats = append(formats, format)
 	}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"strings"
 
 	"github.com/govdbot/govd/enums"
 	"github.com/govdbot/govd/logger"
@@ -96,6 +97,11 @@ func MediaListFromAPI(ctx *models.DownloadContext) ([]*models.Media, error) {
 	title := data.Title
 	isNsfw := data.Over18
 
+	// posts linking to redgifs are handled by its extractor
+	if strings.HasSuffix(data.Domain, "redgifs.com") {
+		return GetRedgifsMediaList(ctx, data)
+	}
+
 	if !data.IsVideo {
 		// check for single photo
 		if data.Preview != nil && len(data.Preview.Images) > 0 {
@@ -125,11 +131,11 @@ func MediaListFromAPI(ctx *models.DownloadContext) ([]*models.Media, error) {
 			// check for MP4 variant (animated GIF)
 			if image.Variants.MP4 != nil {
 				media.AddFormat(&models.MediaFormat{
-					FormatID:   "gif",
-					Type:       enums.MediaTypeVideo,
-					VideoCodec: enums.MediaCodecAVC,
-					AudioCodec: enums.MediaCodecAAC,
-					URL:        []string{util.FixURL(image.Variants.MP4.Source.URL)},
+					FormatID:    "gif",
+					Type:        enums.MediaTypeVideo,
+					VideoCodec:  enums.MediaCodecAVC,
+					URL:         []string{util.FixURL(image.Variants.MP4.Source.URL)},
+					IsAnimation: true,
 				})
 
 				return []*models.Media{media}, nil
@@ -165,11 +171,11 @@ func MediaListFromAPI(ctx *models.DownloadContext) ([]*models.Media, error) {
 					})
 				case "AnimatedImage":
 					media.AddFormat(&models.MediaFormat{
-						FormatID:   "video",
-						Type:       enums.MediaTypeVideo,
-						VideoCodec: enums.MediaCodecAVC,
-						AudioCodec: enums.MediaCodecAAC,
-						URL:        []string{util.FixURL(obj.Media.MP4)},
+						FormatID:    "video",
+						Type:        enums.MediaTypeVideo,
+						VideoCodec:  enums.MediaCodecAVC,
+						URL:         []string{util.FixURL(obj.Media.MP4)},
+						IsAnimation: true,
 					})
 				}
 				mediaList = append(mediaList, media)
@@ -24,6 +24,8 @@ type PostData struct {
 	MediaMetadata map[string]MediaMetadata `json:"media_metadata"`
 	SecureMedia   *Media                   `json:"secure_media"`
 	Over18        bool                     `json:"over_18"`
+	URL           string                   `json:"url"`
+	Domain        string                   `json:"domain"`
 }
 
 type Media struct {
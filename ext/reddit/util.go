@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 
+	"github.com/govdbot/govd/ext/redgifs"
 	"github.com/govdbot/govd/models"
 	"github.com/govdbot/govd/util/parser"
 )
@@ -37,3 +38,36 @@ func GetHLSFormats(
 
 	return formats, nil
 }
+
+// runs the redgifs extractor for a post linking to redgifs,
+// keeping the title and nsfw flag of the post
+func GetRedgifsMediaList(
+	ctx *models.DownloadContext,
+	data *PostData,
+) ([]*models.Media, error) {
+	pattern := redgifs.Extractor.URLPattern
+	matches := pattern.FindStringSubmatch(data.URL)
+	if matches == nil {
+		return nil, ErrNoDataFound
+	}
+	redgifsCtx := *ctx
+	redgifsCtx.Extractor = redgifs.Extractor
+	redgifsCtx.MatchedContentURL = matches[0]
+	redgifsCtx.MatchedContentID = matches[pattern.SubexpIndex("id")]
+	redgifsCtx.MatchedGroups = map[string]string{
+		"id":    redgifsCtx.MatchedContentID,
+		"match": matches[0],
+	}
+
+	response, err := redgifs.Extractor.Run(&redgifsCtx)
+	if err != nil {
+		return nil, err
+	}
+	for _, media := range response.MediaList {
+		if media.Caption.String == "" {
+			media.SetCaption(data.Title)
+		}
+		media.NSFW = media.NSFW || data.Over18
+	}
+	return response.MediaList, nil
+}
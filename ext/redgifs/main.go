@@ -73,6 +73,8 @@ func MediaListFromAPI(ctx *models.DownloadContext) ([]*models.Media, error) {
 		}
 		if gif.HasAudio {
 			format.AudioCodec = enums.MediaCodecAAC
+		} else {
+			format.IsAnimation = true
 		}
 		media.AddFormat(format)
 	}
@@ -88,6 +90,8 @@ func MediaListFromAPI(ctx *models.DownloadContext) ([]*models.Media, error) {
 		}
 		if gif.HasAudio {
 			format.AudioCodec = enums.MediaCodecAAC
+		} else {
+			format.IsAnimation = true
 		}
 		media.AddFormat(format)
 	}
@@ -10,7 +10,6 @@ import (
 	"github.com/govdbot/govd/enums"
 	"github.com/govdbot/govd/logger"
 	"github.com/govdbot/govd/models"
-	"github.com/govdbot/govd/plugins"
 	"github.com/govdbot/govd/util"
 	"github.com/govdbot/govd/util/networking"
 
@@ -54,12 +53,13 @@ var ShortExtractor = &models.Extractor{
 }
 
 var Extractor = &models.Extractor{
-	Name:       "SoundCloud",
-	CodeName:   "soundcloud",
-	Type:       enums.ExtractorTypeSingle,
-	Category:   enums.ExtractorCategoryMusic,
-	URLPattern: regexp.MustCompile(`(?i)^(?:https?://)?(?:(?:www\.|m\.)?soundcloud\.com/(?P<uploader>[\w\d-]+)/(?P<id>[\w\d-]+)(?:/(?P<token>[^/?#]+))?(?:[?].*)?$|api(?:-v2)?\.soundcloud\.com/tracks/(?P<track_id>\d+)(?:/?\?secret_token=(?P<secret_token>[^&]+))?)`),
-	Host:       []string{"soundcloud"},
+	Name:          "SoundCloud",
+	CodeName:      "soundcloud",
+	Type:          enums.ExtractorTypeSingle,
+	Category:      enums.ExtractorCategoryMusic,
+	URLPattern:    regexp.MustCompile(`(?i)^(?:https?://)?(?:(?:www\.|m\.)?soundcloud\.com/(?P<uploader>[\w\d-]+)/(?P<id>[\w\d-]+)(?:/(?P<token>[^/?#]+))?(?:[?].*)?$|api(?:-v2)?\.soundcloud\.com/tracks/(?P<track_id>\d+)(?:/?\?secret_token=(?P<secret_token>[^&]+))?)`),
+	Host:          []string{"soundcloud"},
+	HasTimestamps: true,
 
 	Run: func(ctx *models.DownloadContext) (*models.ExtractorResponse, error) {
 		mediaList, err := GetTrackMediaList(ctx)
@@ -140,9 +140,6 @@ func GetTrackMediaList(ctx *models.DownloadContext) ([]*models.Media, error) {
 		Thumbnail:  []string{thumbnail},
 		Title:      title,
 		Artist:     artist,
-		Plugins: []models.Plugin{
-			plugins.SetID3,
-		},
 		DownloadConfig: &models.DownloadConfig{
 			Remux: false,
 		},
@@ -145,6 +145,7 @@ func MediaListFromAPI(ctx *models.DownloadContext) ([]*models.Media, error) {
 		return []*models.Media{media}, nil
 	} else {
 		images := details.ImagePostInfo.Images
+		musicFormat := ParseMusic(details.Music)
 		mediaList := make([]*models.Media, 0, len(images))
 		for i := range images {
 			image := images[i]
@@ -158,6 +159,8 @@ func MediaListFromAPI(ctx *models.DownloadContext) ([]*models.Media, error) {
 				Type:     enums.MediaTypePhoto,
 				URL:      image.DisplayImage.URLList,
 			})
+			// used when rendering the post as a slideshow
+			media.AudioFormat = musicFormat
 			mediaList = append(mediaList, media)
 		}
 		return mediaList, nil
@@ -212,6 +215,7 @@ func MediaListFromWeb(ctx *models.DownloadContext) ([]*models.Media, error) {
 		return nil, ErrVideoNotFound
 	} else {
 		images := details.ImagePost.Images
+		musicFormat := ParseWebMusic(details.Music, cookies)
 		mediaList := make([]*models.Media, 0, len(images))
 		for i := range images {
 			image := images[i]
@@ -225,6 +229,8 @@ func MediaListFromWeb(ctx *models.DownloadContext) ([]*models.Media, error) {
 				FormatID: "image",
 				URL:      image.URL.URLList,
 			})
+			// used when rendering the post as a slideshow
+			media.AudioFormat = musicFormat
 			mediaList = append(mediaList, media)
 		}
 		return mediaList, nil
@@ -44,6 +44,18 @@ type ImagePostInfo struct {
 	Title       string  `json:"title"`
 }
 
+type Music struct {
+	Title    string    `json:"title"`
+	Author   string    `json:"author"`
+	Duration int64     `json:"duration"`
+	PlayURL  *MusicURL `json:"play_url"`
+}
+
+type MusicURL struct {
+	URI     string   `json:"uri"`
+	URLList []string `json:"url_list"`
+}
+
 type Video struct {
 	Cover           Cover     `json:"cover"`
 	Duration        int64     `json:"duration"`
@@ -61,6 +73,7 @@ type AwemeDetail struct {
 	Desc          string         `json:"desc"`
 	Video         *Video         `json:"video"`
 	ImagePostInfo *ImagePostInfo `json:"image_post_info"`
+	Music         *Music         `json:"music"`
 }
 
 type WebItemStruct struct {
@@ -68,6 +81,14 @@ type WebItemStruct struct {
 	Desc      string        `json:"desc"`
 	Video     *WebVideo     `json:"video"`
 	ImagePost *WebImagePost `json:"imagePost"`
+	Music     *WebMusic     `json:"music"`
+}
+
+type WebMusic struct {
+	Title      string `json:"title"`
+	AuthorName string `json:"authorName"`
+	Duration   int64  `json:"duration"`
+	PlayURL    string `json:"playUrl"`
 }
 
 type WebImagePost struct {
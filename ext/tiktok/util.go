@@ -235,6 +235,41 @@ func ParsePlayAddr(
 	}, nil
 }
 
+// ParseMusic returns the background music of a photo post,
+// or nil if the post has none
+func ParseMusic(music *Music) *models.MediaFormat {
+	if music == nil || music.PlayURL == nil || len(music.PlayURL.URLList) == 0 {
+		return nil
+	}
+	return &models.MediaFormat{
+		Type:       enums.MediaTypeAudio,
+		FormatID:   "music",
+		URL:        music.PlayURL.URLList,
+		AudioCodec: enums.MediaCodecMP3,
+		Duration:   music.Duration,
+		Title:      music.Title,
+		Artist:     music.Author,
+	}
+}
+
+func ParseWebMusic(music *WebMusic, cookies []*http.Cookie) *models.MediaFormat {
+	if music == nil || music.PlayURL == "" {
+		return nil
+	}
+	return &models.MediaFormat{
+		Type:       enums.MediaTypeAudio,
+		FormatID:   "music",
+		URL:        []string{music.PlayURL},
+		AudioCodec: enums.MediaCodecMP3,
+		Duration:   music.Duration,
+		Title:      music.Title,
+		Artist:     music.AuthorName,
+		DownloadConfig: &models.DownloadConfig{
+			Cookies: cookies,
+		},
+	}
+}
+
 func GetRandomInstallTime() string {
 	currentTime := int(time.Now().Unix())
 	minOffset := big.NewInt(86400)
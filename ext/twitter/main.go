@@ -119,6 +119,11 @@ func MediaListFromAPI(ctx *models.DownloadContext) ([]*models.Media, error) {
 				return nil, err
 			}
 			for _, format := range formats {
+				if mediaEntity.Type == "animated_gif" {
+					// gifs are served as silent mp4s
+					format.AudioCodec = ""
+					format.IsAnimation = true
+				}
 				media.AddFormat(format)
 			}
 		case "photo":
@@ -27,6 +27,7 @@ var Extractor = &models.Extractor{
 		"youtu",
 		"youtube-nocookie",
 	},
+	HasTimestamps: true,
 
 	Run: func(ctx *models.DownloadContext) (*models.ExtractorResponse, error) {
 		video, err := GetVideoFromInv(ctx)
@@ -106,5 +107,8 @@ func GetVideoFromInv(ctx *models.DownloadContext) (*models.Media, error) {
 	for _, format := range formats {
 		media.AddFormat(format)
 	}
+	for _, subtitle := range ParseInvCaptions(data) {
+		media.AddSubtitle(subtitle)
+	}
 	return media, nil
 }
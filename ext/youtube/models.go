@@ -31,6 +31,7 @@ type InvResponse struct {
 	DashURL          string            `json:"dashUrl"`
 	AdaptiveFormats  []*AdaptiveFormat `json:"adaptiveFormats"`
 	FormatStreams    []*FormatStream   `json:"formatStreams"`
+	Captions         []*Caption        `json:"captions"`
 	Error            string            `json:"error,omitempty"`
 }
 
@@ -75,3 +76,9 @@ type FormatStream struct {
 	Container    string `json:"container"`
 	Encoding     string `json:"encoding"`
 }
+
+type Caption struct {
+	Label        string `json:"label"`
+	LanguageCode string `json:"language_code"`
+	URL          string `json:"url"`
+}
@@ -62,6 +62,24 @@ func ParseInvFormats(data *InvResponse) []*models.MediaFormat {
 	return formats
 }
 
+// captions are served by the instance as webvtt
+func ParseInvCaptions(data *InvResponse) []*models.Subtitle {
+	subtitles := make([]*models.Subtitle, 0, len(data.Captions))
+	for _, caption := range data.Captions {
+		if caption.URL == "" {
+			continue
+		}
+		subtitles = append(subtitles, &models.Subtitle{
+			Language:    caption.LanguageCode,
+			Name:        caption.Label,
+			Format:      enums.SubtitleFormatWebVTT,
+			URL:         []string{ParseInvURL(caption.URL)},
+			IsAutomatic: strings.Contains(caption.Label, "auto-generated"),
+		})
+	}
+	return subtitles
+}
+
 func ParseStreamType(
 	streamType string,
 ) (enums.MediaType, enums.MediaCodec, enums.MediaCodec) {
@@ -51,7 +51,7 @@ require (
 	github.com/titanous/json5 v1.0.0
 	github.com/u2takey/go-utils v0.3.1 // indirect
 	go.uber.org/zap v1.27.0
-	golang.org/x/text v0.25.0 // indirect
+	golang.org/x/text v0.25.0
 	gorm.io/driver/mysql v1.5.7
 )
 
@@ -25,16 +25,29 @@ func main() {
 	logger.Init()
 	defer logger.Sync()
 
+	if len(os.Args) == 3 && os.Args[1] == "config" && os.Args[2] == "check" {
+		os.Exit(checkConfig())
+	}
+
 	// load environment variables and configurations
-	config.Load()
+	if err := config.Load(); err != nil {
+		zap.S().Fatalf("invalid configuration:\n%v", err)
+	}
 
-	logger.SetLevel(config.Env.LogLevel)
-	logger.SetLogFile(config.Env.LogFile)
+	logger.SetLevel(config.Env().LogLevel)
+	logger.SetLogFile(config.Env().LogFile)
+	config.OnReload(func() {
+		logger.SetLevel(config.Env().LogLevel)
+	})
+
+	if err := plugins.LoadExternal(); err != nil {
+		zap.S().Fatalf("failed to load external plugins: %v", err)
+	}
 
 	zap.S().Debugf("loaded %d extractors", len(ext.List))
 	zap.S().Debugf("loaded %d plugins", len(plugins.List))
-	if len(config.Env.Whitelist) > 0 {
-		zap.S().Infof("whitelist is enabled: %v", config.Env.Whitelist)
+	if len(config.Env().Whitelist) > 0 {
+		zap.S().Infof("whitelist is enabled: %v", config.Env().Whitelist)
 	}
 
 	// check for ffmpeg binary
@@ -44,10 +57,10 @@ func main() {
 	}
 
 	// setup pprof profiler
-	if config.Env.ProfilerPort > 0 {
+	if config.Env().ProfilerPort > 0 {
 		go func() {
-			zap.S().Infof("starting profiler on port %d", config.Env.ProfilerPort)
-			if err := http.ListenAndServe(fmt.Sprintf(":%d", config.Env.ProfilerPort), nil); err != nil {
+			zap.S().Infof("starting profiler on port %d", config.Env().ProfilerPort)
+			if err := http.ListenAndServe(fmt.Sprintf(":%d", config.Env().ProfilerPort), nil); err != nil {
 				zap.S().Fatalf("failed to start profiler: %v", err)
 			}
 		}()
@@ -62,6 +75,9 @@ func main() {
 	// setup bot client
 	go bot.Start()
 
+	// reload extractor configs, cookies and limits
+	config.Watch()
+
 	// setup signal handler for graceful shutdown
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -75,3 +91,30 @@ func main() {
 
 	select {}
 }
+
+// checkConfig validates the configuration without starting
+// the bot, printing every error found. returns the exit code
+func checkConfig() int {
+	errs := config.Check()
+	if len(errs) == 0 {
+		// extractors and external plugins are
+		// checked with the loaded config
+		for _, name := range config.GetExtractorConfigNames() {
+			if ext.ByCodeName(name) == nil {
+				errs = append(errs, fmt.Errorf("unknown extractor in config file: %s", name))
+			}
+		}
+		if err := plugins.LoadExternal(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "found %d errors in the configuration:\n", len(errs))
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "- %v\n", err)
+		}
+		return 1
+	}
+	fmt.Println("configuration is valid")
+	return 0
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Clip is the part of a media to download, requested
+// with a timestamp in the url or with /clip
+type Clip struct {
+	Start time.Duration
+	End   time.Duration // zero for the end of the media
+}
+
+// Duration returns the length of the clip, given the
+// duration in seconds of the whole media, if known
+func (clip *Clip) Duration(mediaDuration int64) time.Duration {
+	end := clip.End
+	total := time.Duration(mediaDuration) * time.Second
+	if total > 0 && (end == 0 || end > total) {
+		end = total
+	}
+	if end <= clip.Start {
+		return 0
+	}
+	return end - clip.Start
+}
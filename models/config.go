@@ -14,6 +14,8 @@ type EnvConfig struct {
 	ConcurrentUpdates int
 
 	DownloadsDirectory string
+	DownloadsQuota     int64
+	MinFreeSpace       int64
 
 	HTTPSProxy string
 	HTTPProxy  string
@@ -28,6 +30,10 @@ type EnvConfig struct {
 	Whitelist    []int64
 	Caching      bool
 
+	// limits of the images decoded
+	MaxImageSize   int64
+	MaxImagePixels int64
+
 	CaptionHeader      string
 	CaptionDescription string
 
@@ -48,4 +54,23 @@ type ExtractorConfig struct {
 	IsDisabled bool `yaml:"disabled"`
 
 	Instance string `yaml:"instance"`
+
+	Download *ExtractorDownloadConfig `yaml:"download"`
+
+	Plugins map[string]*PluginConfig `yaml:"plugins"`
+}
+
+// ExtractorDownloadConfig overrides the download config
+// set by the extractor. sizes are in MB, like the env limits
+type ExtractorDownloadConfig struct {
+	ChunkSize   int               `yaml:"chunk_size"`
+	Concurrency int               `yaml:"concurrency"`
+	Timeout     time.Duration     `yaml:"timeout"`
+	Retries     int               `yaml:"retries"`
+	Headers     map[string]string `yaml:"headers"`
+	MaxFileSize int64             `yaml:"max_file_size"`
+	MaxDuration time.Duration     `yaml:"max_duration"`
+	// groups can raise the limits of the
+	// extractor, up to the instance limits
+	AllowGroupLimits bool `yaml:"allow_group_limits"`
 }
@@ -1,6 +1,11 @@
 package models
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/govdbot/govd/enums"
+)
 
 type DownloadContext struct {
 	Context           context.Context
@@ -10,4 +15,10 @@ type DownloadContext struct {
 	GroupSettings     *GroupSettings
 	Extractor         *Extractor
 	IsSpoiler         bool
+	SubtitlesMode     enums.SubtitlesMode
+	SubtitlesLanguage string        // preferred subtitle language, if requested
+	RecordDuration    time.Duration // user-given limit for live recordings
+	SendOriginals     bool          // photos are sent as documents, from the group or user settings
+	Clip              *Clip         // part of the media to download, nil for all of it
+	NoteMode          enums.NoteMode
 }
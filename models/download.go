@@ -17,6 +17,10 @@ type DownloadConfig struct {
 	Headers         map[string]string // custom HTTP headers for the request
 	DecryptionKey   *DecryptionKey    // decryption key for encrypted streams
 	Cookies         []*http.Cookie    // cookies to send with the request
+	MinThroughput   int               // minimum bytes per second before switching to another mirror
+	MaxDuration     time.Duration     // duration limit, and recording limit for live streams, capped by the instance limit
+	MaxFileSize     int64             // file size limit, capped by the instance limit
+	Clip            *Clip             // part of the media to download, nil for all of it
 }
 
 func DefaultDownloadConfig() *DownloadConfig {
@@ -30,6 +34,7 @@ func DefaultDownloadConfig() *DownloadConfig {
 		MaxInMemory:   50 * 1024 * 1024, // 50MB
 		Headers:       make(map[string]string),
 		Cookies:       make([]*http.Cookie, 0),
+		MinThroughput: 64 * 1024, // 64KB/s
 	}
 }
 
@@ -71,4 +76,42 @@ func (cfg *DownloadConfig) Ensure() {
 	if cfg.Cookies == nil {
 		cfg.Cookies = make([]*http.Cookie, 0)
 	}
+	if cfg.MinThroughput <= 0 {
+		cfg.MinThroughput = defaultConfig.MinThroughput
+	}
+}
+
+// Merge overrides the values set by the extractor with
+// the ones of its download block in config.yaml, then
+// ensures the missing ones have their default value
+func (cfg *DownloadConfig) Merge(override *ExtractorDownloadConfig) {
+	if override != nil {
+		if override.ChunkSize > 0 {
+			cfg.ChunkSize = override.ChunkSize * 1024 * 1024
+		}
+		if override.Concurrency > 0 {
+			cfg.Concurrency = override.Concurrency
+		}
+		if override.Timeout > 0 {
+			cfg.Timeout = override.Timeout
+		}
+		if override.Retries > 0 {
+			cfg.RetryAttempts = override.Retries
+		}
+		if len(override.Headers) > 0 {
+			if cfg.Headers == nil {
+				cfg.Headers = make(map[string]string)
+			}
+			for key, value := range override.Headers {
+				cfg.Headers[key] = value
+			}
+		}
+		if override.MaxFileSize > 0 {
+			cfg.MaxFileSize = override.MaxFileSize * 1024 * 1024
+		}
+		if override.MaxDuration > 0 {
+			cfg.MaxDuration = override.MaxDuration
+		}
+	}
+	cfg.Ensure()
 }
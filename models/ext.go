@@ -16,6 +16,9 @@ type Extractor struct {
 	IsDRM      bool
 	IsRedirect bool
 	IsHidden   bool
+	// urls may have a start time, like ?t=80,
+	// which is downloaded as a clip
+	HasTimestamps bool
 
 	Run func(*DownloadContext) (*ExtractorResponse, error)
 }
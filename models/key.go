@@ -1,8 +1,17 @@
 package models
 
+// method of keys for common encryption (cenc and cbcs),
+// which protects the samples inside fragmented mp4 files
+const DecryptionMethodCENC = "CENC"
+
 type DecryptionKey struct {
 	Key           []byte `json:"key"`            // encoded key for AES decryption
 	IV            []byte `json:"iv"`             // initialization vector for AES decryption
 	Method        string `json:"method"`         // e.g., "AES-128-CBC"
 	MediaSequence int    `json:"media_sequence"` // sequence number for HLS segments
+	KeyID         []byte `json:"key_id"`         // key id for common encryption
+}
+
+func (key *DecryptionKey) IsCENC() bool {
+	return key != nil && key.Method == DecryptionMethodCENC
 }
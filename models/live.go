@@ -0,0 +1,18 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// LivePlaylist is a snapshot of a live media playlist
+type LivePlaylist struct {
+	InitSegment    *Segment
+	Segments       []*Segment
+	TargetDuration time.Duration // maximum segment duration, used as reload interval
+	IsEvent        bool          // the playlist keeps every segment since the start (dvr)
+	Ended          bool          // the stream has ended, no more segments will be added
+}
+
+// LivePlaylistFunc fetches the current snapshot of a live playlist
+type LivePlaylistFunc func(ctx context.Context) (*LivePlaylist, error)
@@ -20,10 +20,13 @@ import (
 )
 
 const (
-	fileTypeDocument = "document"
-	fileTypePhoto    = "photo"
-	fileTypeVideo    = "video"
-	fileTypeAudio    = "audio"
+	fileTypeDocument  = "document"
+	fileTypePhoto     = "photo"
+	fileTypeVideo     = "video"
+	fileTypeAudio     = "audio"
+	fileTypeAnimation = "animation"
+	fileTypeVoice     = "voice"
+	fileTypeVideoNote = "video_note"
 
 	fileExtMP4  = "mp4"
 	fileExtWebM = "webm"
@@ -52,9 +55,11 @@ type Media struct {
 	UpdatedAt         time.Time      `json:"-"`
 	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
 
-	Format *MediaFormat `json:"-"`
+	Format      *MediaFormat `json:"-"`
+	AudioFormat *MediaFormat `gorm:"-" json:"-"` // audio track merged into the video format, or music of a slideshow
 
-	Formats []*MediaFormat `gorm:"-" json:"formats"`
+	Formats   []*MediaFormat `gorm:"-" json:"formats"`
+	Subtitles []*Subtitle    `gorm:"-" json:"subtitles"`
 }
 
 type MediaFormat struct {
@@ -71,12 +76,20 @@ type MediaFormat struct {
 	Bitrate       int64            `json:"bitrate"`
 	Title         string           `json:"title"`
 	Artist        string           `json:"artist"`
+	Language      string           `gorm:"-" json:"language"` // bcp-47 tag of the audio track, if known
 	IsDefault     bool             `gorm:"default:false;index" json:"is_default"`
-	Segments      []string         `gorm:"-" json:"segments"`
-	InitSegment   string           `gorm:"-" json:"init_segment"`
+	IsAnimation   bool             `gorm:"default:false" json:"is_animation"` // silent loop, like a gif
+	IsDocument    bool             `gorm:"default:false" json:"is_document"`  // photo sent as a file, in original quality
+	FileExt       string           `gorm:"-" json:"file_ext"`                 // extension of the original image, if known
+	IsVoice       bool             `gorm:"-" json:"-"`                        // converted to an opus voice message
+	IsVideoNote   bool             `gorm:"-" json:"-"`                        // converted to a round video note
+	Segments      []*Segment       `gorm:"-" json:"segments"`
+	InitSegment   *Segment         `gorm:"-" json:"init_segment"`
 	FileSize      int64            `json:"-"`
-	Plugins       []Plugin         `gorm:"-" json:"-"`
 	DecryptionKey *DecryptionKey   `gorm:"-" json:"decryption_key"`
+	Subtitles     []*Subtitle      `gorm:"-" json:"-"` // tracks available with this format
+	IsLive        bool             `gorm:"-" json:"is_live"`
+	LivePlaylist  LivePlaylistFunc `gorm:"-" json:"-"` // set for live streams, see RecordLiveStream
 
 	CreatedAt time.Time      `json:"-"`
 	UpdatedAt time.Time      `json:"-"`
@@ -96,6 +109,7 @@ type DownloadedMedia struct {
 	ThumbnailFilePath string
 	Media             *Media
 	Index             int
+	GroupSettings     *GroupSettings // settings of the group, nil in private chats
 }
 
 func (media *Media) GetFormat(formatID string) *MediaFormat {
@@ -155,13 +169,39 @@ func (media *Media) GetDefaultVideoFormat() *MediaFormat {
 }
 
 func (media *Media) GetDefaultAudioFormat() *MediaFormat {
-	filtered := filterFormats(media.Formats, func(format *MediaFormat) bool {
+	return getBestAudioFormat(media.Formats)
+}
+
+// GetLanguageAudioFormat returns the best audio format in the
+// given language, matching the base language when there is
+// no exact match. returns nil if no format matches
+func (media *Media) GetLanguageAudioFormat(language string) *MediaFormat {
+	if language == "" {
+		return nil
+	}
+	language = strings.ToLower(language)
+	base, _, _ := strings.Cut(language, "-")
+
+	format := getBestAudioFormat(filterFormats(media.Formats, func(format *MediaFormat) bool {
+		return strings.ToLower(format.Language) == language
+	}))
+	if format != nil {
+		return format
+	}
+	return getBestAudioFormat(filterFormats(media.Formats, func(format *MediaFormat) bool {
+		formatBase, _, _ := strings.Cut(strings.ToLower(format.Language), "-")
+		return formatBase == base
+	}))
+}
+
+func getBestAudioFormat(formats []*MediaFormat) *MediaFormat {
+	filtered := filterFormats(formats, func(format *MediaFormat) bool {
 		return format.VideoCodec == "" &&
 			(format.AudioCodec == enums.MediaCodecAAC ||
 				format.AudioCodec == enums.MediaCodecMP3)
 	})
 	if len(filtered) == 0 {
-		filtered = filterFormats(media.Formats, func(format *MediaFormat) bool {
+		filtered = filterFormats(formats, func(format *MediaFormat) bool {
 			return format.VideoCodec == "" && format.AudioCodec != ""
 		})
 	}
@@ -217,6 +257,9 @@ func (media *Media) SetCaption(caption string) {
 
 func (media *Media) AddFormat(fmt *MediaFormat) {
 	media.Formats = append(media.Formats, fmt)
+	for _, subtitle := range fmt.Subtitles {
+		media.AddSubtitle(subtitle)
+	}
 }
 
 func (media *Media) GetSortedFormats() []*MediaFormat {
@@ -333,12 +376,29 @@ func getTypePriority(mediaType enums.MediaType) int64 {
 // getFormatInfo returns the file extension and the InputMedia type.
 func (format *MediaFormat) GetFormatInfo() (string, string) {
 	if format.Type == enums.MediaTypePhoto {
+		if format.IsDocument && format.FileExt != "" {
+			return format.FileExt, fileTypeDocument
+		}
+		if format.IsDocument {
+			return fileExtJPEG, fileTypeDocument
+		}
 		return fileExtJPEG, fileTypePhoto
 	}
 
+	if format.IsVoice {
+		return fileExtOGG, fileTypeVoice
+	}
+	if format.IsVideoNote {
+		return fileExtMP4, fileTypeVideoNote
+	}
+
 	videoCodec := format.VideoCodec
 	audioCodec := format.AudioCodec
 
+	if format.IsAnimation && videoCodec == enums.MediaCodecAVC {
+		return fileExtMP4, fileTypeAnimation
+	}
+
 	switch {
 	case videoCodec == enums.MediaCodecAVC && audioCodec == enums.MediaCodecAAC:
 		return fileExtMP4, fileTypeVideo
@@ -362,6 +422,8 @@ func (format *MediaFormat) GetFormatInfo() (string, string) {
 		return fileExtFLAC, fileTypeDocument
 	case videoCodec == "" && audioCodec == enums.MediaCodecVorbis:
 		return fileExtOGG, fileTypeDocument
+	case videoCodec == "" && audioCodec == enums.MediaCodecOpus:
+		return fileExtOGG, fileTypeDocument
 	default:
 		// all other cases, we return webm as document
 		return fileExtWebM, fileTypeDocument
@@ -422,6 +484,17 @@ func (format *MediaFormat) GetInputMedia(
 			ParseMode:         gotgbot.ParseModeHTML,
 			HasSpoiler:        spoiler,
 		}, nil
+	case fileTypeAnimation:
+		return &gotgbot.InputMediaAnimation{
+			Media:      fileInputMedia,
+			Thumbnail:  thumbnailFileInputMedia,
+			Width:      format.Width,
+			Height:     format.Height,
+			Duration:   format.Duration,
+			Caption:    messageCaption,
+			ParseMode:  gotgbot.ParseModeHTML,
+			HasSpoiler: spoiler,
+		}, nil
 	case fileTypeAudio:
 		return &gotgbot.InputMediaAudio{
 			Media:     fileInputMedia,
@@ -465,6 +538,13 @@ func (format *MediaFormat) GetInputMediaWithFileID(
 			ParseMode:  gotgbot.ParseModeHTML,
 			HasSpoiler: spoiler,
 		}, nil
+	case fileTypeAnimation:
+		return &gotgbot.InputMediaAnimation{
+			Media:      fileInputMedia,
+			Caption:    messageCaption,
+			ParseMode:  gotgbot.ParseModeHTML,
+			HasSpoiler: spoiler,
+		}, nil
 	case fileTypeAudio:
 		return &gotgbot.InputMediaAudio{
 			Media:     fileInputMedia,
@@ -489,6 +569,24 @@ func (format *MediaFormat) GetInputMediaWithFileID(
 	}
 }
 
+// IsNote reports whether the format is sent as a voice
+// message or a video note, which can't be in media groups
+func (format *MediaFormat) IsNote() bool {
+	return format.IsVoice || format.IsVideoNote
+}
+
+// GetEstimatedFileSize returns the known file size, or an
+// estimate based on bitrate and duration. returns 0 if unknown
+func (format *MediaFormat) GetEstimatedFileSize() int64 {
+	if format.FileSize > 0 {
+		return format.FileSize
+	}
+	if format.Bitrate > 0 && format.Duration > 0 {
+		return format.Bitrate / 8 * format.Duration
+	}
+	return 0
+}
+
 func (format *MediaFormat) GetFileName() string {
 	extension, _ := format.GetFormatInfo()
 	if format.Type == enums.MediaTypeAudio && format.Title != "" && format.Artist != "" {
@@ -1,8 +1,11 @@
 package models
 
 type SendMediaFormatsOptions struct {
+	// medias were sent from the database
 	IsStored bool
-	Caption  string
+	// medias are not stored as the default format
+	SkipStore bool
+	Caption   string
 }
 
 type Chunk struct {
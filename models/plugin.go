@@ -1,3 +1,37 @@
 package models
 
-type Plugin = func(*DownloadedMedia, *DownloadConfig) error
+import (
+	"context"
+	"time"
+
+	"github.com/govdbot/govd/enums"
+)
+
+type Plugin = func(context.Context, *DownloadedMedia, *DownloadConfig) error
+
+// PluginConfig holds the per-extractor
+// settings of a plugin, from config.yaml
+type PluginConfig struct {
+	// forces the plugin on or off for the
+	// extractor, regardless of its match rule
+	Enabled *bool          `yaml:"enabled"`
+	Options map[string]any `yaml:"options"`
+}
+
+// ExternalPluginConfig declares a plugin run as an external
+// process, under the top-level plugins key of config.yaml
+type ExternalPluginConfig struct {
+	Name    string            `yaml:"name"`
+	Command string            `yaml:"command"`
+	Args    []string          `yaml:"args"`
+	Env     map[string]string `yaml:"env"`
+	Stage   enums.PluginStage `yaml:"stage"`
+	Order   int               `yaml:"order"`
+	Timeout time.Duration     `yaml:"timeout"`
+
+	// match rule, empty fields match anything
+	Extractors  []string           `yaml:"extractors"`
+	MediaTypes  []enums.MediaType  `yaml:"media_types"`
+	VideoCodecs []enums.MediaCodec `yaml:"video_codecs"`
+	AudioCodecs []enums.MediaCodec `yaml:"audio_codecs"`
+}
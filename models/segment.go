@@ -0,0 +1,44 @@
+package models
+
+import "fmt"
+
+type Segment struct {
+	URL           string         `json:"url"`
+	Offset        int64          `json:"offset,omitempty"`        // start of the byte range
+	Length        int64          `json:"length,omitempty"`        // length of the byte range, 0 for the whole resource
+	Duration      float64        `json:"duration,omitempty"`      // duration in seconds, if known
+	Discontinuity bool           `json:"discontinuity,omitempty"` // segment starts a new timeline
+	Init          *Segment       `json:"init,omitempty"`          // init segment, only set where it changes
+	Key           *DecryptionKey `json:"key,omitempty"`           // key for this segment, nil when clear
+}
+
+// NewSegmentsFromURLs returns segments covering each URL entirely
+func NewSegmentsFromURLs(urls []string) []*Segment {
+	segments := make([]*Segment, 0, len(urls))
+	for _, url := range urls {
+		segments = append(segments, &Segment{URL: url})
+	}
+	return segments
+}
+
+func (segment *Segment) HasRange() bool {
+	return segment.Length > 0
+}
+
+// GetRange returns the value of the Range header
+// for this segment, or an empty string
+func (segment *Segment) GetRange() string {
+	if !segment.HasRange() {
+		return ""
+	}
+	return fmt.Sprintf("bytes=%d-%d", segment.Offset, segment.Offset+segment.Length-1)
+}
+
+func (segment *Segment) Equals(other *Segment) bool {
+	if segment == nil || other == nil {
+		return segment == other
+	}
+	return segment.URL == other.URL &&
+		segment.Offset == other.Offset &&
+		segment.Length == other.Length
+}
@@ -10,4 +10,11 @@ type GroupSettings struct {
 	Captions        *bool
 	MediaGroupLimit int
 	Silent          *bool
+	AudioLanguage   string // preferred audio track language, empty for any
+	SlideshowDelay  int    // seconds each image of a slideshow is shown, zero to send an album
+	SendOriginals   bool   // photos are sent as documents, keeping their quality
+	NormalizeAudio  bool   // loudness of audio files is normalized
+	AudioCodec      string // codec audio files are re-encoded to, empty to keep theirs
+	MaxFileSize     int    // file size limit in MB, zero for the extractor or instance one
+	MaxDuration     int    // duration limit in seconds, zero for the extractor or instance one
 }
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	"github.com/govdbot/govd/enums"
+)
+
+type Subtitle struct {
+	Language    string               `json:"language"` // bcp-47 tag, e.g. "en" or "pt-BR"
+	Name        string               `json:"name"`
+	Format      enums.SubtitleFormat `json:"format"`
+	URL         []string             `json:"url"`
+	Segments    []*Segment           `json:"segments"` // segmented webvtt, for hls and dash
+	IsDefault   bool                 `json:"is_default"`
+	IsAutomatic bool                 `json:"is_automatic"` // auto-generated captions
+	// fetches the segments when they are not known
+	// yet, set for hls tracks, see LoadSegments
+	SegmentsFunc SubtitleSegmentsFunc `json:"-"`
+}
+
+// SubtitleSegmentsFunc fetches the segments of a subtitle track
+type SubtitleSegmentsFunc func(ctx context.Context) ([]*Segment, error)
+
+// LoadSegments fetches the segments of the
+// track, if they are fetched only when needed
+func (subtitle *Subtitle) LoadSegments(ctx context.Context) error {
+	if subtitle.SegmentsFunc == nil || len(subtitle.Segments) > 0 {
+		return nil
+	}
+	segments, err := subtitle.SegmentsFunc(ctx)
+	if err != nil {
+		return err
+	}
+	subtitle.Segments = segments
+	return nil
+}
+
+func (media *Media) AddSubtitle(subtitle *Subtitle) {
+	for _, existing := range media.Subtitles {
+		if existing.Language == subtitle.Language &&
+			existing.Name == subtitle.Name {
+			return
+		}
+	}
+	media.Subtitles = append(media.Subtitles, subtitle)
+}
+
+// GetSubtitle returns the subtitle matching the given language,
+// falling back to the same base language, then to the default
+// track. returns nil when the media has no subtitles
+func (media *Media) GetSubtitle(language string) *Subtitle {
+	if len(media.Subtitles) == 0 {
+		return nil
+	}
+	language = strings.ToLower(language)
+	base, _, _ := strings.Cut(language, "-")
+
+	var baseMatch, defaultMatch *Subtitle
+	for _, subtitle := range media.Subtitles {
+		subtitleLanguage := strings.ToLower(subtitle.Language)
+		if language != "" && subtitleLanguage == language && !subtitle.IsAutomatic {
+			return subtitle
+		}
+		subtitleBase, _, _ := strings.Cut(subtitleLanguage, "-")
+		if base != "" && subtitleBase == base &&
+			(baseMatch == nil || baseMatch.IsAutomatic && !subtitle.IsAutomatic) {
+			baseMatch = subtitle
+		}
+		if subtitle.IsDefault && defaultMatch == nil {
+			defaultMatch = subtitle
+		}
+	}
+	switch {
+	case baseMatch != nil:
+		return baseMatch
+	case defaultMatch != nil:
+		return defaultMatch
+	default:
+		return media.Subtitles[0]
+	}
+}
@@ -0,0 +1,11 @@
+package models
+
+// MediaTags are the metadata written into
+// downloaded files by the metadata plugin
+type MediaTags struct {
+	Title     string
+	Artist    string
+	Comment   string
+	SourceURL string
+	Cover     []byte // jpeg or png front cover
+}
@@ -9,6 +9,7 @@ import (
 type User struct {
 	gorm.Model
 
-	UserID   int64     `gorm:"primaryKey"`
-	LastUsed time.Time `gorm:"autoCreateTime"`
+	UserID        int64     `gorm:"primaryKey"`
+	LastUsed      time.Time `gorm:"autoCreateTime"`
+	SendOriginals bool      // photos are sent as documents in private chats
 }
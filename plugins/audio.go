@@ -0,0 +1,122 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/govdbot/govd/enums"
+	"github.com/govdbot/govd/models"
+	"github.com/govdbot/govd/util/libav"
+
+	"go.uber.org/zap"
+)
+
+// encoders of the codecs audio files can be
+// re-encoded to, and normalized in
+var audioEncoders = map[enums.MediaCodec]*libav.AudioEncoder{
+	enums.MediaCodecMP3:    {Codec: "libmp3lame", Bitrate: "320k"},
+	enums.MediaCodecAAC:    {Codec: "aac", Bitrate: "256k"},
+	enums.MediaCodecOpus:   {Codec: "libopus", Bitrate: "192k"},
+	enums.MediaCodecVorbis: {Codec: "libvorbis", Bitrate: "256k"},
+	enums.MediaCodecFLAC:   {Codec: "flac"},
+}
+
+// used to normalize audio files whose codec
+// is unknown or has no encoder
+const fallbackAudioCodec = enums.MediaCodecMP3
+
+// AudioCodecs are the codecs groups can
+// choose to re-encode audio files to
+var AudioCodecs = []enums.MediaCodec{
+	enums.MediaCodecMP3,
+	enums.MediaCodecAAC,
+	enums.MediaCodecOpus,
+}
+
+// ProcessAudio normalizes the loudness of audio files and
+// re-encodes them to the codec chosen by the group. the
+// loudness target can be set with the plugin options
+func ProcessAudio(
+	ctx context.Context,
+	media *models.DownloadedMedia,
+	downloadConfig *models.DownloadConfig,
+) error {
+	settings := media.GroupSettings
+	format := media.Media.Format
+
+	codec := format.AudioCodec
+	if settings.AudioCodec != "" {
+		codec = enums.MediaCodec(settings.AudioCodec)
+	}
+	encoder, ok := audioEncoders[codec]
+	if !ok {
+		// only the codec of the source can be unknown,
+		// groups choose from the supported ones
+		zap.S().Debugf(
+			"no encoder for audio codec %q, using %s",
+			codec, fallbackAudioCodec,
+		)
+		codec = fallbackAudioCodec
+		encoder = audioEncoders[codec]
+	}
+	var target *libav.LoudnessTarget
+	if settings.NormalizeAudio {
+		target = &libav.LoudnessTarget{
+			Integrated: getFloatOption(media, "process_audio", "loudness", -14),
+			TruePeak:   getFloatOption(media, "process_audio", "true_peak", -1),
+			Range:      getFloatOption(media, "process_audio", "range", 11),
+		}
+	}
+
+	inputPath := media.FilePath + ".temp"
+	if err := os.Rename(media.FilePath, inputPath); err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+	defer os.Remove(inputPath)
+
+	originalCodec := format.AudioCodec
+	format.AudioCodec = codec
+	extension, _ := format.GetFormatInfo()
+	outputPath := strings.TrimSuffix(
+		media.FilePath,
+		filepath.Ext(media.FilePath),
+	) + "." + extension
+
+	zap.S().Debugf(
+		"processing audio to %s (normalize: %t)",
+		codec, target != nil,
+	)
+	err := libav.ProcessAudio(ctx, inputPath, outputPath, encoder, target)
+	if err != nil {
+		format.AudioCodec = originalCodec
+		os.Rename(inputPath, media.FilePath)
+		return err
+	}
+	media.FilePath = outputPath
+	return nil
+}
+
+// IsAudioProcessingEnabled reports whether the group
+// normalizes or re-encodes audio files
+func IsAudioProcessingEnabled(settings *models.GroupSettings) bool {
+	return settings != nil && (settings.NormalizeAudio || settings.AudioCodec != "")
+}
+
+// numbers in config.yaml are decoded as int
+// or float64, depending on how they are written
+func getFloatOption(media *models.DownloadedMedia, plugin string, key string, fallback float64) float64 {
+	switch value := GetOption[any](media, plugin, key, nil).(type) {
+	case float64:
+		return value
+	case int:
+		return float64(value)
+	case nil:
+		return fallback
+	default:
+		zap.S().Warnf("invalid value for %s option %s: %v", plugin, key, value)
+		return fallback
+	}
+}
@@ -0,0 +1,357 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/govdbot/govd/config"
+	"github.com/govdbot/govd/enums"
+	"github.com/govdbot/govd/models"
+	"github.com/govdbot/govd/util"
+
+	"github.com/bytedance/sonic"
+	"github.com/guregu/null/v6/zero"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultExternalTimeout = 2 * time.Minute
+	// time given to the process to exit once killed
+	externalWaitDelay = 5 * time.Second
+
+	externalActionContinue = "continue"
+	externalActionSkip     = "skip"
+	externalActionAbort    = "abort"
+)
+
+// ErrSkipMedia is returned by plugins to drop
+// a media, which is then no longer processed or sent
+var ErrSkipMedia = errors.New("media skipped by plugin")
+
+// sent to the process on stdin
+type externalRequest struct {
+	Stage             enums.PluginStage `json:"stage"`
+	Extractor         string            `json:"extractor"`
+	ContentID         string            `json:"content_id"`
+	ContentURL        string            `json:"content_url"`
+	Caption           string            `json:"caption"`
+	NSFW              bool              `json:"nsfw"`
+	Index             int               `json:"index"`
+	FilePath          string            `json:"file_path"`
+	ThumbnailFilePath string            `json:"thumbnail_file_path"`
+	Format            *externalFormat   `json:"format"`
+	WorkDir           string            `json:"work_dir"`
+	Options           map[string]any    `json:"options"`
+}
+
+// format of the media sent to the process, without the
+// segments and decryption keys, which must not leave the bot
+type externalFormat struct {
+	Type        enums.MediaType  `json:"type"`
+	FormatID    string           `json:"format_id"`
+	VideoCodec  enums.MediaCodec `json:"video_codec"`
+	AudioCodec  enums.MediaCodec `json:"audio_codec"`
+	Duration    int64            `json:"duration"`
+	Width       int64            `json:"width"`
+	Height      int64            `json:"height"`
+	Bitrate     int64            `json:"bitrate"`
+	Title       string           `json:"title"`
+	Artist      string           `json:"artist"`
+	Language    string           `json:"language"`
+	IsAnimation bool             `json:"is_animation"`
+	IsDocument  bool             `json:"is_document"`
+	FileExt     string           `json:"file_ext"`
+	IsLive      bool             `json:"is_live"`
+	URL         []string         `json:"url"`
+	Thumbnail   []string         `json:"thumbnail"`
+}
+
+func newExternalFormat(format *models.MediaFormat) *externalFormat {
+	return &externalFormat{
+		Type:        format.Type,
+		FormatID:    format.FormatID,
+		VideoCodec:  format.VideoCodec,
+		AudioCodec:  format.AudioCodec,
+		Duration:    format.Duration,
+		Width:       format.Width,
+		Height:      format.Height,
+		Bitrate:     format.Bitrate,
+		Title:       format.Title,
+		Artist:      format.Artist,
+		Language:    format.Language,
+		IsAnimation: format.IsAnimation,
+		IsDocument:  format.IsDocument,
+		FileExt:     format.FileExt,
+		IsLive:      format.IsLive,
+		URL:         format.URL,
+		Thumbnail:   format.Thumbnail,
+	}
+}
+
+// read from the process stdout. every field is optional,
+// an empty output leaves the media unchanged
+type externalResponse struct {
+	Action            string  `json:"action"`
+	Message           string  `json:"message"`
+	FilePath          string  `json:"file_path"`
+	ThumbnailFilePath string  `json:"thumbnail_file_path"`
+	Caption           *string `json:"caption"`
+}
+
+type externalPlugin struct {
+	config  *models.ExternalPluginConfig
+	command string
+	stage   enums.PluginStage
+}
+
+// LoadExternal registers the external process
+// plugins declared in config.yaml
+func LoadExternal() error {
+	for _, pluginConfig := range config.GetExternalPlugins() {
+		definition, err := newExternalDefinition(pluginConfig)
+		if err != nil {
+			return err
+		}
+		zap.S().Debugf(
+			"loaded external plugin %s (%s)",
+			definition.Name, definition.Stage,
+		)
+		List = append(List, definition)
+	}
+	return nil
+}
+
+func newExternalDefinition(pluginConfig *models.ExternalPluginConfig) (*Definition, error) {
+	name := pluginConfig.Name
+	if name == "" || pluginConfig.Command == "" {
+		return nil, errors.New("external plugins need a name and a command")
+	}
+	if slices.ContainsFunc(List, func(definition *Definition) bool {
+		return definition.Name == name
+	}) {
+		return nil, fmt.Errorf("duplicate plugin name: %s", name)
+	}
+
+	stage := pluginConfig.Stage
+	switch stage {
+	case "":
+		stage = enums.PluginStagePreSend
+	case enums.PluginStagePreDownload,
+		enums.PluginStagePostDownload,
+		enums.PluginStagePreSend:
+	default:
+		return nil, fmt.Errorf("invalid stage for plugin %s: %s", name, stage)
+	}
+
+	command, err := exec.LookPath(pluginConfig.Command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find command for plugin %s: %w", name, err)
+	}
+	plugin := &externalPlugin{
+		config:  pluginConfig,
+		command: command,
+		stage:   stage,
+	}
+	return &Definition{
+		Name:  name,
+		Stage: stage,
+		Order: pluginConfig.Order,
+		Rule: &Rule{
+			Extractors:  pluginConfig.Extractors,
+			MediaTypes:  pluginConfig.MediaTypes,
+			VideoCodecs: pluginConfig.VideoCodecs,
+			AudioCodecs: pluginConfig.AudioCodecs,
+		},
+		Run: plugin.run,
+	}, nil
+}
+
+// runs the process in its own temporary working directory,
+// passing the media as json on stdin and applying the
+// modifications it writes as json on stdout. the directory
+// only isolates its files, the process can access anything
+// the bot can
+func (plugin *externalPlugin) run(
+	ctx context.Context,
+	media *models.DownloadedMedia,
+	_ *models.DownloadConfig,
+) error {
+	name := plugin.config.Name
+	if err := util.EnsureDownloadDir(); err != nil {
+		return err
+	}
+	workDir, err := os.MkdirTemp(config.Env().DownloadsDirectory, "plugin")
+	if err != nil {
+		return fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+	workDir = absPath(workDir)
+
+	var options map[string]any
+	if pluginConfig := config.GetPluginConfig(media.Media.ExtractorCodeName, name); pluginConfig != nil {
+		options = pluginConfig.Options
+	}
+	payload, err := sonic.ConfigFastest.Marshal(&externalRequest{
+		Stage:             plugin.stage,
+		Extractor:         media.Media.ExtractorCodeName,
+		ContentID:         media.Media.ContentID,
+		ContentURL:        media.Media.ContentURL,
+		Caption:           media.Media.Caption.String,
+		NSFW:              media.Media.NSFW,
+		Index:             media.Index,
+		FilePath:          absPath(media.FilePath),
+		ThumbnailFilePath: absPath(media.ThumbnailFilePath),
+		Format:            newExternalFormat(media.Media.Format),
+		WorkDir:           workDir,
+		Options:           options,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	timeout := plugin.config.Timeout
+	if timeout <= 0 {
+		timeout = defaultExternalTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, plugin.command, plugin.config.Args...)
+	cmd.Dir = workDir
+	cmd.Env = plugin.environ(workDir)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = externalWaitDelay
+
+	err = cmd.Run()
+	if stderr.Len() > 0 {
+		zap.S().Debugf("plugin %s stderr: %s", name, strings.TrimSpace(stderr.String()))
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("plugin timed out after %s", timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run %s: %w", plugin.command, err)
+	}
+
+	output := bytes.TrimSpace(stdout.Bytes())
+	if len(output) == 0 {
+		return nil
+	}
+	var response externalResponse
+	if err := sonic.ConfigFastest.Unmarshal(output, &response); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return plugin.apply(media, &response, workDir)
+}
+
+func (plugin *externalPlugin) apply(
+	media *models.DownloadedMedia,
+	response *externalResponse,
+	workDir string,
+) error {
+	switch response.Action {
+	case "", externalActionContinue:
+	case externalActionSkip:
+		zap.S().Debugf("plugin %s skipped media: %s", plugin.config.Name, response.Message)
+		return ErrSkipMedia
+	case externalActionAbort:
+		message := response.Message
+		if message == "" {
+			message = "the download was aborted by a plugin"
+		}
+		return &util.Error{Message: message}
+	default:
+		return fmt.Errorf("unknown action: %s", response.Action)
+	}
+
+	// files only exist once downloaded
+	if media.FilePath != "" {
+		if response.FilePath != "" {
+			path, err := importPluginFile(response.FilePath, workDir, media.FilePath)
+			if err != nil {
+				return err
+			}
+			media.FilePath = path
+		}
+		if response.ThumbnailFilePath != "" {
+			target := media.ThumbnailFilePath
+			if target == "" {
+				target = strings.TrimSuffix(media.FilePath, filepath.Ext(media.FilePath)) + ".thumb.jpeg"
+			}
+			path, err := importPluginFile(response.ThumbnailFilePath, workDir, target)
+			if err != nil {
+				return err
+			}
+			media.ThumbnailFilePath = path
+		}
+	}
+	if response.Caption != nil {
+		media.Media.Caption = zero.StringFrom(*response.Caption)
+	}
+	return nil
+}
+
+// the process only gets the path, a temporary
+// home and the variables set in its config
+func (plugin *externalPlugin) environ(workDir string) []string {
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + workDir,
+		"TMPDIR=" + workDir,
+	}
+	for key, value := range plugin.config.Env {
+		env = append(env, key+"="+value)
+	}
+	return env
+}
+
+// moves a file produced by a plugin next to the file it replaces,
+// keeping its extension. files must be in the working directory
+func importPluginFile(path string, workDir string, target string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workDir, path)
+	}
+	path = filepath.Clean(path)
+	if path == absPath(target) {
+		// modified in place
+		return target, nil
+	}
+	rel, err := filepath.Rel(workDir, path)
+	if err != nil || rel == "." || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("plugin file is outside of its working directory: %s", path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("plugin file not found: %w", err)
+	}
+
+	newPath := strings.TrimSuffix(target, filepath.Ext(target)) + filepath.Ext(path)
+	if err := os.Rename(path, newPath); err != nil {
+		return "", fmt.Errorf("failed to move plugin file: %w", err)
+	}
+	if newPath != target {
+		os.Remove(target)
+	}
+	return newPath, nil
+}
+
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
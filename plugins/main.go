@@ -1,8 +1,51 @@
 package plugins
 
-import "github.com/govdbot/govd/models"
+import (
+	"github.com/govdbot/govd/enums"
+	"github.com/govdbot/govd/models"
+)
 
-var List = []models.Plugin{
-	MergeAudio,
-	SetID3,
+// List holds every plugin, each one running at its stage
+// for the medias matching its rule. plugins can be enabled,
+// disabled and configured per extractor in config.yaml
+var List = []*Definition{
+	{
+		Name:  "merge_audio",
+		Stage: enums.PluginStagePostDownload,
+		Rule: &Rule{
+			MediaTypes: []enums.MediaType{enums.MediaTypeVideo},
+			// set when the video needs a separate audio track
+			Condition: func(media *models.DownloadedMedia) bool {
+				return media.Media.AudioFormat != nil
+			},
+		},
+		Run: MergeAudio,
+	},
+	{
+		Name:  "process_audio",
+		Stage: enums.PluginStagePostDownload,
+		Order: 10,
+		Rule: &Rule{
+			MediaTypes: []enums.MediaType{enums.MediaTypeAudio},
+			// set by the group with /normalize and /audiocodec
+			Condition: func(media *models.DownloadedMedia) bool {
+				settings := media.GroupSettings
+				if !IsAudioProcessingEnabled(settings) {
+					return false
+				}
+				return settings.NormalizeAudio ||
+					settings.AudioCodec != string(media.Media.Format.AudioCodec)
+			},
+		},
+		Run: ProcessAudio,
+	},
+	{
+		Name:  "metadata",
+		Stage: enums.PluginStagePreSend,
+		Rule: &Rule{
+			Extractors: []string{"soundcloud", "youtube"},
+			MediaTypes: []enums.MediaType{enums.MediaTypeAudio, enums.MediaTypeVideo},
+		},
+		Run: SetMetadata,
+	},
 }
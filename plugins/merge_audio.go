@@ -12,10 +12,14 @@ import (
 )
 
 func MergeAudio(
+	ctx context.Context,
 	media *models.DownloadedMedia,
 	downloadConfig *models.DownloadConfig,
 ) error {
-	audioFormat := media.Media.GetDefaultAudioFormat()
+	audioFormat := media.Media.AudioFormat
+	if audioFormat == nil {
+		audioFormat = media.Media.GetDefaultAudioFormat()
+	}
 	if audioFormat == nil {
 		return errors.New("no audio format found")
 	}
@@ -30,9 +34,6 @@ func MergeAudio(
 	}
 
 	// download the audio file
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
 	var audioFile string
 	var err error
 
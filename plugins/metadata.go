@@ -0,0 +1,80 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/govdbot/govd/enums"
+	"github.com/govdbot/govd/models"
+	"github.com/govdbot/govd/util/mp4box"
+	"github.com/govdbot/govd/util/vorbis"
+
+	"go.uber.org/zap"
+)
+
+// SetMetadata writes the title, artist, caption and source url
+// of the media into the downloaded file. the tag format is chosen
+// by the container and codecs: id3 for mp3, ilst atoms for mp4 and
+// m4a, vorbis comments for flac and ogg. cover art is only
+// embedded into audio files
+func SetMetadata(
+	_ context.Context,
+	media *models.DownloadedMedia,
+	downloadConfig *models.DownloadConfig,
+) error {
+	format := media.Media.Format
+	fileExt := strings.ToLower(strings.TrimPrefix(filepath.Ext(media.FilePath), "."))
+
+	var writeTags func(string, *models.MediaTags) error
+	switch {
+	case fileExt == "mp3":
+		return SetID3(media, downloadConfig)
+	case fileExt == "mp4", fileExt == "m4a", fileExt == "mov":
+		writeTags = mp4box.WriteTags
+	case fileExt == "flac":
+		writeTags = vorbis.WriteFLACTags
+	case fileExt == "ogg", fileExt == "oga", fileExt == "opus":
+		if format.VideoCodec != "" {
+			zap.S().Debugf("skipping metadata for ogg video: %s", media.FilePath)
+			return nil
+		}
+		writeTags = vorbis.WriteOggTags
+	default:
+		zap.S().Debugf("no metadata support for %s files", fileExt)
+		return nil
+	}
+
+	tags, err := getMediaTags(media)
+	if err != nil {
+		return err
+	}
+	zap.S().Debugf("writing metadata to %s", media.FilePath)
+	if err := writeTags(media.FilePath, tags); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return nil
+}
+
+func getMediaTags(media *models.DownloadedMedia) (*models.MediaTags, error) {
+	format := media.Media.Format
+	tags := &models.MediaTags{
+		Title:     format.Title,
+		Artist:    format.Artist,
+		SourceURL: media.Media.ContentURL,
+	}
+	if caption := media.Media.Caption.String; caption != tags.Title {
+		tags.Comment = caption
+	}
+	embedCover := GetOption(media, "metadata", "cover", true)
+	if embedCover && format.Type == enums.MediaTypeAudio && media.ThumbnailFilePath != "" {
+		cover, err := os.ReadFile(media.ThumbnailFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image file: %w", err)
+		}
+		tags.Cover = cover
+	}
+	return tags, nil
+}
@@ -0,0 +1,130 @@
+package plugins
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/govdbot/govd/config"
+	"github.com/govdbot/govd/enums"
+	"github.com/govdbot/govd/models"
+
+	"go.uber.org/zap"
+)
+
+// Rule decides which medias a plugin runs on.
+// empty fields match anything
+type Rule struct {
+	Extractors  []string // extractor code names
+	MediaTypes  []enums.MediaType
+	VideoCodecs []enums.MediaCodec
+	AudioCodecs []enums.MediaCodec
+	// additional condition on the media
+	Condition func(*models.DownloadedMedia) bool
+}
+
+// Definition is a named plugin, run at the given
+// stage for every media matching its rule
+type Definition struct {
+	Name  string
+	Stage enums.PluginStage
+	Order int // lower runs first within the stage
+	Rule  *Rule
+	Run   models.Plugin
+}
+
+// Run runs the plugins of a stage matching the media,
+// honoring the per-extractor settings of config.yaml
+func Run(ctx context.Context, stage enums.PluginStage, media *models.DownloadedMedia) error {
+	definitions := GetStagePlugins(stage, media)
+	if len(definitions) == 0 {
+		return nil
+	}
+	format := media.Media.Format
+	zap.S().Debugf(
+		"running %d %s plugins for %s (%s)",
+		len(definitions), stage,
+		media.Media.ContentID,
+		media.Media.ExtractorCodeName,
+	)
+	for _, definition := range definitions {
+		start := time.Now()
+		err := definition.Run(ctx, media, models.GetDownloadConfig(format.DownloadConfig))
+		if err != nil {
+			return fmt.Errorf("failed to run plugin %s: %w", definition.Name, err)
+		}
+		zap.S().Debugf("plugin %s took %s", definition.Name, time.Since(start))
+	}
+	return nil
+}
+
+// GetStagePlugins returns the plugins of a stage
+// enabled for the media, in their running order
+func GetStagePlugins(stage enums.PluginStage, media *models.DownloadedMedia) []*Definition {
+	var definitions []*Definition
+	for _, definition := range List {
+		if definition.Stage != stage {
+			continue
+		}
+		if !definition.isEnabled(media) {
+			continue
+		}
+		definitions = append(definitions, definition)
+	}
+	slices.SortStableFunc(definitions, func(a, b *Definition) int {
+		return cmp.Compare(a.Order, b.Order)
+	})
+	return definitions
+}
+
+// GetOption returns an option of a plugin set in config.yaml
+// for the extractor of the media, or the fallback value
+func GetOption[T any](media *models.DownloadedMedia, plugin string, key string, fallback T) T {
+	pluginConfig := config.GetPluginConfig(media.Media.ExtractorCodeName, plugin)
+	if pluginConfig == nil {
+		return fallback
+	}
+	value, ok := pluginConfig.Options[key].(T)
+	if !ok {
+		return fallback
+	}
+	return value
+}
+
+func (definition *Definition) isEnabled(media *models.DownloadedMedia) bool {
+	rule := definition.Rule
+	if rule == nil {
+		rule = &Rule{}
+	}
+	extractorMatch := len(rule.Extractors) == 0 ||
+		slices.Contains(rule.Extractors, media.Media.ExtractorCodeName)
+
+	pluginConfig := config.GetPluginConfig(media.Media.ExtractorCodeName, definition.Name)
+	if pluginConfig != nil && pluginConfig.Enabled != nil {
+		if !*pluginConfig.Enabled {
+			return false
+		}
+		// enabled for an extractor outside of the rule
+		extractorMatch = true
+	}
+	if !extractorMatch {
+		return false
+	}
+
+	format := media.Media.Format
+	if len(rule.MediaTypes) > 0 && !slices.Contains(rule.MediaTypes, format.Type) {
+		return false
+	}
+	if len(rule.VideoCodecs) > 0 && !slices.Contains(rule.VideoCodecs, format.VideoCodec) {
+		return false
+	}
+	if len(rule.AudioCodecs) > 0 && !slices.Contains(rule.AudioCodecs, format.AudioCodec) {
+		return false
+	}
+	if rule.Condition != nil && !rule.Condition(media) {
+		return false
+	}
+	return true
+}
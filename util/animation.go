@@ -0,0 +1,235 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	gifExtension       = 0x21
+	gifImageDescriptor = 0x2C
+	gifTrailer         = 0x3B
+	gifColorTable      = 0x80
+
+	webpAnimationFlag = 0x02
+)
+
+var vp8xHeader = []byte("VP8X")
+
+const (
+	webpAlphaFlag = 0x10
+	// position, size and duration of an animation frame
+	webpFrameHeaderSize = 16
+)
+
+// IsAnimatedImage reports whether the image is a gif
+// with more than one frame, or an animated webp
+func IsAnimatedImage(file io.ReadSeeker) (bool, error) {
+	format, err := DetectImageFormat(file)
+	if err != nil {
+		return false, err
+	}
+	defer file.Seek(0, io.SeekStart)
+
+	switch format {
+	case "gif":
+		frames, err := countGIFFrames(bufio.NewReader(file), 2)
+		if err != nil {
+			return false, fmt.Errorf("failed to read gif: %w", err)
+		}
+		return frames > 1, nil
+	case "webp":
+		// the extended header, when present,
+		// is the first chunk of the file
+		header := make([]byte, 21)
+		if _, err := io.ReadFull(file, header); err != nil {
+			return false, nil
+		}
+		return bytes.Equal(header[12:16], vp8xHeader) &&
+			header[20]&webpAnimationFlag != 0, nil
+	default:
+		return false, nil
+	}
+}
+
+// GetFirstFrame returns the first frame of an animated image,
+// as a still image that can be decoded. gif decoders already
+// return the first frame, so gifs are returned as they are
+func GetFirstFrame(file io.ReadSeeker) (io.ReadSeeker, error) {
+	format, err := DetectImageFormat(file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to reset file position: %w", err)
+	}
+	if format != "webp" {
+		return file, nil
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	frame, err := extractWebPFrame(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract webp frame: %w", err)
+	}
+	return bytes.NewReader(frame), nil
+}
+
+// builds a still webp from the first ANMF chunk of
+// an animated one, keeping its alpha channel, if any
+func extractWebPFrame(data []byte) ([]byte, error) {
+	chunks := readWebPChunks(data[12:])
+	for _, chunk := range chunks {
+		if chunk.id != "ANMF" || len(chunk.data) < webpFrameHeaderSize {
+			continue
+		}
+		header := chunk.data[:webpFrameHeaderSize]
+		var alpha, bitstream *webpChunk
+		for _, frameChunk := range readWebPChunks(chunk.data[webpFrameHeaderSize:]) {
+			switch frameChunk.id {
+			case "ALPH":
+				alpha = frameChunk
+			case "VP8 ", "VP8L":
+				bitstream = frameChunk
+			}
+		}
+		if bitstream == nil {
+			return nil, errors.New("no frame bitstream found")
+		}
+
+		var body bytes.Buffer
+		body.WriteString("WEBP")
+		if alpha != nil && bitstream.id == "VP8 " {
+			// lossy frames keep their alpha in a separate
+			// chunk, which needs the extended header
+			extended := make([]byte, 10)
+			extended[0] = webpAlphaFlag
+			copy(extended[4:10], header[6:12])
+			writeWebPChunk(&body, "VP8X", extended)
+			writeWebPChunk(&body, alpha.id, alpha.data)
+		}
+		writeWebPChunk(&body, bitstream.id, bitstream.data)
+
+		var output bytes.Buffer
+		output.WriteString("RIFF")
+		binary.Write(&output, binary.LittleEndian, uint32(body.Len()))
+		output.Write(body.Bytes())
+		return output.Bytes(), nil
+	}
+	return nil, errors.New("no animation frame found")
+}
+
+type webpChunk struct {
+	id   string
+	data []byte
+}
+
+// chunks are padded to an even size
+func readWebPChunks(data []byte) []*webpChunk {
+	var chunks []*webpChunk
+	for len(data) >= 8 {
+		size := int(binary.LittleEndian.Uint32(data[4:8]))
+		if size > len(data)-8 {
+			break
+		}
+		chunks = append(chunks, &webpChunk{
+			id:   string(data[:4]),
+			data: data[8 : 8+size],
+		})
+		data = data[min(8+size+size%2, len(data)):]
+	}
+	return chunks
+}
+
+func writeWebPChunk(w *bytes.Buffer, id string, data []byte) {
+	w.WriteString(id)
+	binary.Write(w, binary.LittleEndian, uint32(len(data)))
+	w.Write(data)
+	if len(data)%2 == 1 {
+		w.WriteByte(0)
+	}
+}
+
+// counts the image descriptors of a gif, stopping
+// once the limit is reached. frames are not decoded
+func countGIFFrames(r *bufio.Reader, limit int) (int, error) {
+	// header and logical screen descriptor
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, err
+	}
+	if header[10]&gifColorTable != 0 {
+		if err := skipGIFColorTable(r, header[10]); err != nil {
+			return 0, err
+		}
+	}
+
+	var frames int
+	for frames < limit {
+		introducer, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch introducer {
+		case gifExtension:
+			// extension label
+			if _, err := r.ReadByte(); err != nil {
+				return 0, err
+			}
+			if err := skipGIFSubBlocks(r); err != nil {
+				return 0, err
+			}
+		case gifImageDescriptor:
+			frames++
+			descriptor := make([]byte, 9)
+			if _, err := io.ReadFull(r, descriptor); err != nil {
+				return 0, err
+			}
+			if descriptor[8]&gifColorTable != 0 {
+				if err := skipGIFColorTable(r, descriptor[8]); err != nil {
+					return 0, err
+				}
+			}
+			// lzw minimum code size
+			if _, err := r.ReadByte(); err != nil {
+				return 0, err
+			}
+			if err := skipGIFSubBlocks(r); err != nil {
+				return 0, err
+			}
+		case gifTrailer:
+			return frames, nil
+		default:
+			return 0, fmt.Errorf("unknown block: 0x%02x", introducer)
+		}
+	}
+	return frames, nil
+}
+
+func skipGIFColorTable(r *bufio.Reader, flags byte) error {
+	size := 3 * (1 << (int(flags&0x07) + 1))
+	_, err := r.Discard(size)
+	return err
+}
+
+func skipGIFSubBlocks(r *bufio.Reader) error {
+	for {
+		size, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		if _, err := r.Discard(int(size)); err != nil {
+			return err
+		}
+	}
+}
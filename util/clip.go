@@ -0,0 +1,332 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/govdbot/govd/config"
+	"github.com/govdbot/govd/models"
+	"github.com/govdbot/govd/util/libav"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// prefix of the files downloaded before being cut
+const uncutFilePrefix = "uncut."
+
+var errInvalidTimestamp = errors.New("invalid timestamp")
+
+// ParseTimestamp parses timestamps like 80, 1:20,
+// 1:02:05, 80s or 1m20s, as used in urls and commands
+func ParseTimestamp(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, errInvalidTimestamp
+	}
+	if strings.Contains(value, ":") {
+		parts := strings.Split(value, ":")
+		if len(parts) > 3 {
+			return 0, errInvalidTimestamp
+		}
+		var seconds float64
+		for i, part := range parts {
+			number, err := strconv.ParseFloat(part, 64)
+			if err != nil || number < 0 {
+				return 0, errInvalidTimestamp
+			}
+			// only the seconds can have a fraction
+			if i < len(parts)-1 && number != float64(int64(number)) {
+				return 0, errInvalidTimestamp
+			}
+			seconds = seconds*60 + number
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds < 0 {
+			return 0, errInvalidTimestamp
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, errInvalidTimestamp
+	}
+	return duration, nil
+}
+
+// ParseClipRange parses a range like 1:20-2:05, or
+// a single timestamp for a clip lasting until the end
+func ParseClipRange(value string) (*models.Clip, error) {
+	startValue, endValue, hasEnd := strings.Cut(value, "-")
+	start, err := ParseTimestamp(startValue)
+	if err != nil {
+		return nil, ErrInvalidClip
+	}
+	clip := &models.Clip{Start: start}
+	if hasEnd && endValue != "" {
+		end, err := ParseTimestamp(endValue)
+		if err != nil || end <= start {
+			return nil, ErrInvalidClip
+		}
+		clip.End = end
+	}
+	return clip, nil
+}
+
+// GetURLClip returns the clip requested by the timestamp of
+// the url: the t and start parameters, with an optional end,
+// or a #t= fragment. returns nil when there is none
+func GetURLClip(rawURL string) *models.Clip {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	query := parsedURL.Query()
+	start := query.Get("t")
+	if start == "" {
+		start = query.Get("start")
+	}
+	end := query.Get("end")
+	if start == "" {
+		// media fragments, e.g. #t=80 or #t=80,125
+		fragment, found := strings.CutPrefix(parsedURL.Fragment, "t=")
+		if !found {
+			return nil
+		}
+		start, end, _ = strings.Cut(fragment, ",")
+	}
+
+	startTime, err := ParseTimestamp(start)
+	if err != nil || startTime == 0 {
+		return nil
+	}
+	clip := &models.Clip{Start: startTime}
+	if end != "" {
+		endTime, err := ParseTimestamp(end)
+		if err == nil && endTime > startTime {
+			clip.End = endTime
+		}
+	}
+	return clip
+}
+
+// downloads only the part of a progressive file covered by the
+// clip: ffmpeg seeks in the file with range requests. when the
+// source can't be read this way, the whole file is downloaded
+// and cut afterwards
+func downloadClip(
+	ctx context.Context,
+	urlList []string,
+	fileName string,
+	downloadConfig *models.DownloadConfig,
+) (string, error) {
+	clip := downloadConfig.Clip
+	filePath := filepath.Join(config.Env().DownloadsDirectory, fileName)
+	if err := EnsureDownloadDir(); err != nil {
+		return "", err
+	}
+
+	// encrypted files must be downloaded whole
+	if downloadConfig.DecryptionKey == nil && len(urlList) > 0 {
+		err := cutClipFromURL(ctx, urlList, filePath, downloadConfig)
+		if err == nil {
+			return filePath, nil
+		}
+		if errors.Is(err, ErrFileTooLarge) || ctx.Err() != nil {
+			return "", err
+		}
+		zap.S().Debugf("failed to cut clip from url: %v", err)
+	}
+
+	uncutConfig := *downloadConfig
+	uncutConfig.Clip = nil
+	uncutFilePath, err := DownloadFile(ctx, urlList, uncutFilePrefix+fileName, &uncutConfig)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(uncutFilePath)
+
+	err = libav.CutMedia(ctx, uncutFilePath, filePath, clip.Start, clip.End, nil)
+	if err != nil {
+		return "", err
+	}
+	return filePath, nil
+}
+
+// cuts the clip with ffmpeg from the best mirror, probed like
+// the ones of full downloads. ffmpeg uses its own http client,
+// so it's given the proxy, and its output is capped at the file
+// size limit. space is reserved for the whole file when the
+// download has no estimated size
+func cutClipFromURL(
+	ctx context.Context,
+	urlList []string,
+	filePath string,
+	downloadConfig *models.DownloadConfig,
+) error {
+	source := rankMirrors(ctx, urlList, downloadConfig)[0]
+	if source.Err != nil {
+		return source.Err
+	}
+
+	maxSize := getMaxFileSize(downloadConfig)
+	if reservedDiskSpace(ctx) == 0 {
+		size := maxSize
+		if source.Size > 0 {
+			size = min(int64(source.Size), maxSize)
+		}
+		_, releaseSpace, err := ReserveDiskSpace(ctx, size)
+		if err != nil {
+			return err
+		}
+		defer releaseSpace()
+	}
+
+	clip := downloadConfig.Clip
+	err := libav.CutMedia(
+		ctx, source.URL, filePath,
+		clip.Start, clip.End,
+		&libav.CutOptions{
+			Headers: getClipHeaders(downloadConfig),
+			Proxy:   getClipProxy(source.URL),
+			MaxSize: maxSize,
+			Timeout: downloadConfig.Timeout,
+		},
+	)
+	if err != nil {
+		recordMirrorFailure(source.URL)
+		return err
+	}
+	// ffmpeg stops writing once the limit is reached
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to get clip size: %w", err)
+	}
+	if info.Size() >= maxSize {
+		os.Remove(filePath)
+		return ErrFileTooLarge
+	}
+	return nil
+}
+
+// returns the proxy the download client would use for the url
+func getClipProxy(fileURL string) string {
+	req, err := http.NewRequest(http.MethodGet, fileURL, nil)
+	if err != nil {
+		return ""
+	}
+	proxyURL, err := http.ProxyFromEnvironment(req)
+	if err != nil || proxyURL == nil {
+		return ""
+	}
+	return proxyURL.String()
+}
+
+// downloads only the segments covered by the clip, then cuts
+// it from the start of the first one. when the duration of
+// the segments is unknown, all of them are downloaded
+func downloadSegmentsClip(
+	ctx context.Context,
+	initSegment *models.Segment,
+	segments []*models.Segment,
+	fileName string,
+	downloadConfig *models.DownloadConfig,
+) (string, error) {
+	clip := downloadConfig.Clip
+	selected, offset, ok := getClipSegments(segments, clip)
+	if !ok {
+		zap.S().Debug("segment durations unknown, downloading all segments")
+		selected, offset = segments, 0
+	}
+	zap.S().Debugf("downloading %d of %d segments for clip", len(selected), len(segments))
+
+	uncutConfig := *downloadConfig
+	uncutConfig.Clip = nil
+	uncutFilePath, err := DownloadFileWithSegments(
+		ctx, initSegment, selected,
+		uncutFilePrefix+fileName, &uncutConfig,
+	)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(uncutFilePath)
+
+	end := clip.End
+	if end > 0 {
+		end -= offset
+	}
+	filePath := filepath.Join(config.Env().DownloadsDirectory, fileName)
+	err = libav.CutMedia(ctx, uncutFilePath, filePath, clip.Start-offset, end, nil)
+	if err != nil {
+		return "", err
+	}
+	return filePath, nil
+}
+
+// returns the segments covering the clip, with the start
+// time of the first one. the duration of every segment
+// is needed to locate the clip
+func getClipSegments(
+	segments []*models.Segment,
+	clip *models.Clip,
+) ([]*models.Segment, time.Duration, bool) {
+	first, last := -1, len(segments)-1
+	var position, offset time.Duration
+	var init, firstInit *models.Segment
+	for i, segment := range segments {
+		if segment.Duration <= 0 {
+			return nil, 0, false
+		}
+		if clip.End > 0 && position >= clip.End {
+			last = i - 1
+			break
+		}
+		if segment.Init != nil {
+			init = segment.Init
+		}
+		end := position + time.Duration(segment.Duration*float64(time.Second))
+		if first < 0 && end > clip.Start {
+			first, offset, firstInit = i, position, init
+		}
+		position = end
+	}
+	if first < 0 || last < first {
+		return nil, 0, false
+	}
+
+	selected := segments[first : last+1]
+	if firstInit != nil && selected[0].Init == nil {
+		// the first segment needs the init
+		// segment in effect at its position
+		segment := *selected[0]
+		segment.Init = firstInit
+		selected = append([]*models.Segment{&segment}, selected[1:]...)
+	}
+	return selected, offset, true
+}
+
+// headers for ffmpeg, with the cookies
+// of the download config
+func getClipHeaders(downloadConfig *models.DownloadConfig) string {
+	var headers strings.Builder
+	for key, value := range downloadConfig.Headers {
+		fmt.Fprintf(&headers, "%s: %s\r\n", key, value)
+	}
+	if len(downloadConfig.Cookies) > 0 {
+		cookies := make([]string, 0, len(downloadConfig.Cookies))
+		for _, cookie := range downloadConfig.Cookies {
+			cookies = append(cookies, cookie.Name+"="+cookie.Value)
+		}
+		fmt.Fprintf(&headers, "Cookie: %s\r\n", strings.Join(cookies, "; "))
+	}
+	return headers.String()
+}
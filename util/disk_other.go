@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package util
+
+import "github.com/pkg/errors"
+
+func freeDiskSpace(string) (int64, error) {
+	return 0, errors.New("free disk space is not available on this platform")
+}
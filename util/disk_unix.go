@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package util
+
+import "syscall"
+
+// returns the space available to unprivileged users on the
+// filesystem containing path, in bytes
+func freeDiskSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(uint64(stat.Bavail) * uint64(stat.Bsize)), nil
+}
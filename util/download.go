@@ -23,6 +23,7 @@ import (
 
 	"github.com/dustin/go-humanize"
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
@@ -36,8 +37,14 @@ func DownloadFile(
 ) (string, error) {
 	zap.S().Debugf("invoking downloader: %v with config %+v", urlList, downloadConfig)
 
+	if downloadConfig.Clip != nil {
+		return downloadClip(ctx, urlList, fileName, downloadConfig)
+	}
+
+	mirrors := rankMirrors(ctx, urlList, downloadConfig)
+
 	var errs []error
-	for _, fileURL := range urlList {
+	for i := range mirrors {
 		select {
 		case <-ctx.Done():
 			return "", ctx.Err()
@@ -46,13 +53,35 @@ func DownloadFile(
 				return "", err
 			}
 
-			filePath := filepath.Join(config.Env.DownloadsDirectory, fileName)
-			err := runChunkedDownload(ctx, fileURL, filePath, downloadConfig)
+			filePath := filepath.Join(config.Env().DownloadsDirectory, fileName)
+			selector := newMirrorSelector(mirrors[i:])
+
+			// try to remux while downloading, avoiding temporary files.
+			// encrypted samples must be decrypted before remuxing
+			canStream := !downloadConfig.DecryptionKey.IsCENC()
+			if canStream && downloadConfig.Remux && libav.CanRemux(filePath) {
+				err := streamDownload(ctx, selector, filePath, downloadConfig)
+				if err == nil {
+					return filePath, nil
+				}
+				if !errors.Is(err, errNotStreamable) {
+					errs = append(errs, err)
+					continue
+				}
+				zap.S().Debug("source is not streamable, downloading to file")
+			}
+
+			err := runChunkedDownload(ctx, selector, filePath, downloadConfig)
 			if err != nil {
 				errs = append(errs, err)
 				continue
 			}
 
+			if err := decryptCENCFile(filePath, downloadConfig.DecryptionKey); err != nil {
+				os.Remove(filePath)
+				return "", err
+			}
+
 			if downloadConfig.Remux {
 				remuxedFilePath, err := libav.RemuxFile(filePath)
 				if err != nil {
@@ -70,62 +99,85 @@ func DownloadFile(
 
 func DownloadFileWithSegments(
 	ctx context.Context,
-	initSegmentURL string,
-	segmentURLs []string,
+	initSegment *models.Segment,
+	segments []*models.Segment,
 	fileName string,
 	downloadConfig *models.DownloadConfig,
 ) (string, error) {
 	zap.S().Debugf("invoking segments downloader: %s", fileName)
 
+	if downloadConfig.Clip != nil {
+		return downloadSegmentsClip(
+			ctx, initSegment, segments,
+			fileName, downloadConfig,
+		)
+	}
+
 	if err := EnsureDownloadDir(); err != nil {
 		return "", err
 	}
+	// segments with discontinuities can't be fed to the remuxer
+	// as a single stream, they need to be merged. the same
+	// applies to encrypted samples, which are decrypted after
+	canStream := !hasDiscontinuities(segments) &&
+		!downloadConfig.DecryptionKey.IsCENC()
+	if downloadConfig.Remux && canStream {
+		outputPath := filepath.Join(config.Env().DownloadsDirectory, fileName)
+		err := streamSegments(
+			ctx, initSegment,
+			segments, outputPath,
+			downloadConfig,
+		)
+		if err != nil {
+			return "", fmt.Errorf("failed to stream segments: %w", err)
+		}
+		return outputPath, nil
+	}
 	tempDir := filepath.Join(
-		config.Env.DownloadsDirectory,
+		config.Env().DownloadsDirectory,
 		"segments"+uuid.NewString(),
 	)
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create temporary directory: %w", err)
 	}
-	var initSegmentFile string
-	if initSegmentURL != "" {
-		segment, err := downloadFile(
-			ctx, initSegmentURL,
-			filepath.Join(tempDir, "init"),
-			downloadConfig,
-		)
-		if err != nil {
-			os.RemoveAll(tempDir)
-			return "", fmt.Errorf("failed to download init segment: %w", err)
-		}
-		initSegmentFile = segment
-	}
-	downloadedFiles, err := downloadSegments(ctx, tempDir, segmentURLs, downloadConfig)
+	defer os.RemoveAll(tempDir)
+
+	downloadedFiles, err := downloadSegments(
+		ctx, tempDir, 0,
+		segments, downloadConfig,
+	)
 	if err != nil {
-		os.RemoveAll(tempDir)
 		return "", fmt.Errorf("failed to download segments: %w", err)
 	}
-	if downloadConfig.DecryptionKey != nil {
-		zap.S().Debug("decrypting segments")
-		err = DecryptSegmentsInPlace(
-			downloadedFiles,
-			downloadConfig.DecryptionKey.Key,
-			downloadConfig.DecryptionKey.IV,
-			downloadConfig.DecryptionKey.MediaSequence,
-		)
-		if err != nil {
-			return "", fmt.Errorf("failed to decrypt segments: %w", err)
-		}
+	err = decryptSegmentFiles(
+		downloadedFiles, segments, 0,
+		downloadConfig.DecryptionKey,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt segments: %w", err)
 	}
-	zap.S().Debugf("merging %d segments", len(downloadedFiles)+1)
-	outputPath := filepath.Join(config.Env.DownloadsDirectory, fileName)
-	mergedFilePath, err := libav.MergeSegments(initSegmentFile, downloadedFiles, outputPath)
+	outputPath := filepath.Join(config.Env().DownloadsDirectory, fileName)
+	mergedFilePath, err := mergeSegmentFiles(
+		ctx, tempDir, initSegment,
+		segments, downloadedFiles,
+		outputPath, downloadConfig,
+	)
 	if err != nil {
-		os.RemoveAll(tempDir)
-		return "", fmt.Errorf("failed to merge segments: %w", err)
+		return "", err
 	}
-	if err := os.RemoveAll(tempDir); err != nil {
-		return "", fmt.Errorf("failed to remove temporary directory: %w", err)
+	if downloadConfig.DecryptionKey.IsCENC() {
+		if err := decryptCENCFile(mergedFilePath, downloadConfig.DecryptionKey); err != nil {
+			os.Remove(mergedFilePath)
+			return "", err
+		}
+		if downloadConfig.Remux {
+			remuxedFilePath, err := libav.RemuxFile(mergedFilePath)
+			if err != nil {
+				os.Remove(mergedFilePath)
+				return "", fmt.Errorf("remuxing failed: %w", err)
+			}
+			mergedFilePath = remuxedFilePath
+		}
 	}
 	return mergedFilePath, nil
 }
@@ -144,7 +196,7 @@ func DownloadFileInMemory(
 			return nil, ctx.Err()
 		default:
 			data, err := downloadInMemory(
-				ctx, fileURL,
+				ctx, &models.Segment{URL: fileURL},
 				downloadConfig,
 			)
 			if err != nil {
@@ -160,7 +212,7 @@ func DownloadFileInMemory(
 
 func downloadInMemory(
 	ctx context.Context,
-	fileURL string,
+	segment *models.Segment,
 	downloadConfig *models.DownloadConfig,
 ) ([]byte, error) {
 	reqCtx, cancel := context.WithTimeout(
@@ -176,7 +228,7 @@ func downloadInMemory(
 		// continue with the request
 	}
 
-	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, fileURL, nil)
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, segment.URL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -186,6 +238,9 @@ func downloadInMemory(
 	for _, cookie := range downloadConfig.Cookies {
 		req.AddCookie(cookie)
 	}
+	if segment.HasRange() {
+		req.Header.Set("Range", segment.GetRange())
+	}
 
 	resp, err := downloadHTTPClient.Do(req)
 	if err != nil {
@@ -193,18 +248,27 @@ func downloadInMemory(
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	if err := checkSegmentResponse(resp, segment); err != nil {
+		return nil, err
+	}
+	body, err := segmentBody(resp, segment)
+	if err != nil {
+		return nil, err
 	}
 
-	if resp.ContentLength > int64(downloadConfig.MaxInMemory) {
+	if segment.HasRange() && segment.Length > int64(downloadConfig.MaxInMemory) {
+		return nil, fmt.Errorf("file too large for in-memory download: %s", humanize.Bytes(uint64(segment.Length)))
+	}
+	if !segment.HasRange() && resp.ContentLength > int64(downloadConfig.MaxInMemory) {
 		return nil, fmt.Errorf("file too large for in-memory download: %s", humanize.Bytes(uint64(resp.ContentLength)))
 	}
 
 	// allocate a single buffer with the
 	// correct size upfront to prevent reallocations
 	var data []byte
-	if resp.ContentLength > 0 {
+	if segment.HasRange() {
+		data = make([]byte, 0, segment.Length)
+	} else if resp.ContentLength > 0 {
 		data = make([]byte, 0, resp.ContentLength)
 	} else {
 		// 64KB initial capacity
@@ -213,7 +277,7 @@ func downloadInMemory(
 
 	// use a limited reader to prevent
 	// exceeding memory limits even if content-length is wrong
-	limitedReader := io.LimitReader(resp.Body, int64(downloadConfig.MaxInMemory))
+	limitedReader := io.LimitReader(body, int64(downloadConfig.MaxInMemory))
 
 	buf := make([]byte, 32*1024) // 32KB buffer
 	for {
@@ -233,7 +297,7 @@ func downloadInMemory(
 }
 
 func EnsureDownloadDir() error {
-	dir := config.Env.DownloadsDirectory
+	dir := config.Env().DownloadsDirectory
 	if _, err := os.Stat(dir); err != nil {
 		if os.IsNotExist(err) {
 			zap.S().Debugf("creating downloads directory: %s", dir)
@@ -249,7 +313,7 @@ func EnsureDownloadDir() error {
 
 func runChunkedDownload(
 	ctx context.Context,
-	fileURL string,
+	selector *mirrorSelector,
 	filePath string,
 	downloadConfig *models.DownloadConfig,
 ) error {
@@ -262,12 +326,17 @@ func runChunkedDownload(
 		downloadConfig.Concurrency = optimalConcurrency
 	}
 
-	fileSize, err := getFileSize(ctx, fileURL, downloadConfig)
-	if err != nil {
-		return err
+	// size may be already known from mirror probing
+	fileSize := selector.Size()
+	if fileSize <= 0 {
+		size, err := getFileSize(ctx, selector.URL(), downloadConfig)
+		if err != nil {
+			return err
+		}
+		fileSize = size
 	}
 
-	if ExceedsMaxFileSize(int64(fileSize)) {
+	if ExceedsMaxFileSize(int64(fileSize), downloadConfig) {
 		return ErrFileTooLarge
 	}
 
@@ -327,7 +396,7 @@ func runChunkedDownload(
 			}
 
 			err := downloadChunkToFile(
-				downloadCtx, fileURL,
+				downloadCtx, selector,
 				file, start, end,
 				downloadConfig, &fileMutex,
 			)
@@ -491,6 +560,10 @@ func getFileSizeWithRange(
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("range request failed: status code %d", resp.StatusCode)
+	}
+
 	if contentRange := resp.Header.Get("Content-Range"); contentRange != "" {
 		// format is typically "bytes 0-0/1234" where 1234 is the total size
 		parts := strings.Split(contentRange, "/")
@@ -506,14 +579,101 @@ func getFileSizeWithRange(
 	return 0, nil
 }
 
+// makes sure the response holds exactly the start-end range.
+// a full response is only fine when the range is the whole file,
+// servers ignoring the range header would send everything otherwise
+func checkChunkResponse(resp *http.Response, start int, end int) error {
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		contentRange := resp.Header.Get("Content-Range")
+		var rangeStart, rangeEnd int
+		_, err := fmt.Sscanf(contentRange, "bytes %d-%d/", &rangeStart, &rangeEnd)
+		if err != nil {
+			return fmt.Errorf("invalid content range: %q", contentRange)
+		}
+		if rangeStart != start || rangeEnd != end {
+			return fmt.Errorf(
+				"unexpected content range: got %d-%d, want %d-%d",
+				rangeStart, rangeEnd, start, end,
+			)
+		}
+		return nil
+	case http.StatusOK:
+		if start != 0 || resp.ContentLength != int64(end+1) {
+			return fmt.Errorf("server ignored range %d-%d", start, end)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+}
+
 func downloadChunkToFile(
 	ctx context.Context,
-	fileURL string,
+	selector *mirrorSelector,
 	file *os.File,
 	start int,
 	end int,
 	downloadConfig *models.DownloadConfig,
 	fileMutex *sync.Mutex,
+) error {
+	return downloadChunk(
+		ctx, selector,
+		start, end, downloadConfig,
+		func(body io.Reader) error {
+			// use a fixed-size buffer for
+			// copying to avoid large allocations (32KB)
+			buf := make([]byte, 32*1024)
+
+			fileMutex.Lock()
+			defer fileMutex.Unlock()
+
+			if _, err := file.Seek(int64(start), io.SeekStart); err != nil {
+				return fmt.Errorf("failed to seek file: %w", err)
+			}
+			if _, err := io.CopyBuffer(file, body, buf); err != nil {
+				return fmt.Errorf("failed to write chunk data: %w", err)
+			}
+			return nil
+		},
+	)
+}
+
+func downloadChunkInMemory(
+	ctx context.Context,
+	selector *mirrorSelector,
+	start int,
+	end int,
+	downloadConfig *models.DownloadConfig,
+) ([]byte, error) {
+	data := bytes.NewBuffer(make([]byte, 0, end-start+1))
+	err := downloadChunk(
+		ctx, selector,
+		start, end, downloadConfig,
+		func(body io.Reader) error {
+			// discard partial data from failed attempts
+			data.Reset()
+			if _, err := io.Copy(data, body); err != nil {
+				return fmt.Errorf("failed to read chunk data: %w", err)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+// downloads the start-end byte range, retrying on
+// failure and switching mirror when one stops working
+func downloadChunk(
+	ctx context.Context,
+	selector *mirrorSelector,
+	start int,
+	end int,
+	downloadConfig *models.DownloadConfig,
+	write func(io.Reader) error,
 ) error {
 	var lastErr error
 
@@ -527,10 +687,11 @@ func downloadChunkToFile(
 			}
 		}
 
+		fileURL := selector.URL()
 		err := downloadAndWriteChunk(
-			ctx, fileURL, file,
+			ctx, fileURL,
 			start, end, downloadConfig,
-			fileMutex,
+			selector.HasFallback(), write,
 		)
 		if err == nil {
 			return nil
@@ -538,6 +699,11 @@ func downloadChunkToFile(
 
 		zap.S().Debugf("chunk %d-%d download failed: %v", start, end, err)
 		lastErr = err
+
+		if ctx.Err() == nil {
+			recordMirrorFailure(fileURL)
+			selector.Fallback(fileURL)
+		}
 	}
 
 	return fmt.Errorf(
@@ -550,17 +716,18 @@ func downloadChunkToFile(
 func downloadAndWriteChunk(
 	ctx context.Context,
 	fileURL string,
-	file *os.File,
 	start int,
 	end int,
 	downloadConfig *models.DownloadConfig,
-	fileMutex *sync.Mutex,
+	hasFallback bool,
+	write func(io.Reader) error,
 ) error {
 	zap.S().Debugf(
 		"downloading chunk %d-%d",
 		start, end,
 	)
 
+	requestStart := time.Now()
 	reqCtx, cancel := context.WithTimeout(ctx, downloadConfig.Timeout)
 	defer cancel()
 
@@ -584,42 +751,48 @@ func downloadAndWriteChunk(
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	if err := checkChunkResponse(resp, start, end); err != nil {
+		return err
 	}
 
 	chunkSize := resp.ContentLength
 	zap.S().Debugf("chunk size: %s", humanize.Bytes(uint64(chunkSize)))
 
-	// use a fixed-size buffer for
-	// copying to avoid large allocations (32KB)
-	buf := make([]byte, 32*1024)
-
-	fileMutex.Lock()
-	defer fileMutex.Unlock()
-
-	if _, err := file.Seek(int64(start), io.SeekStart); err != nil {
-		return fmt.Errorf("failed to seek file: %w", err)
+	// only watch throughput when there's
+	// another mirror we could switch to
+	// never read past the requested range, even
+	// if the server sends more than it should
+	body := &throughputReader{
+		reader: io.LimitReader(resp.Body, int64(end-start+1)),
+	}
+	if hasFallback {
+		body.minRate = downloadConfig.MinThroughput
 	}
 
-	_, err = io.CopyBuffer(file, resp.Body, buf)
-	if err != nil {
-		return fmt.Errorf("failed to write chunk data: %w", err)
+	if err := write(body); err != nil {
+		return err
 	}
+	addWrittenSpace(ctx, body.read)
+	recordMirrorSuccess(fileURL, 0, body.Rate())
+	zap.S().Debugf(
+		"chunk %d-%d downloaded in %s (%s/s)",
+		start, end, time.Since(requestStart),
+		humanize.Bytes(uint64(body.Rate())),
+	)
 
 	return nil
 }
 
 func downloadFile(
 	ctx context.Context,
-	fileURL string,
+	segment *models.Segment,
 	filePath string,
 	downloadConfig *models.DownloadConfig,
 ) (string, error) {
 	reqCtx, cancel := context.WithTimeout(ctx, downloadConfig.Timeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, fileURL, nil)
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, segment.URL, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -629,14 +802,21 @@ func downloadFile(
 	for _, cookie := range downloadConfig.Cookies {
 		req.AddCookie(cookie)
 	}
+	if segment.HasRange() {
+		req.Header.Set("Range", segment.GetRange())
+	}
 	resp, err := downloadHTTPClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to download file: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	if err := checkSegmentResponse(resp, segment); err != nil {
+		return "", err
+	}
+	body, err := segmentBody(resp, segment)
+	if err != nil {
+		return "", err
 	}
 
 	file, err := os.Create(filePath)
@@ -648,10 +828,11 @@ func downloadFile(
 	// use a fixed-size buffer for
 	// copying to avoid large allocations (32KB)
 	buf := make([]byte, 32*1024)
-	_, err = io.CopyBuffer(file, resp.Body, buf)
+	written, err := io.CopyBuffer(file, body, buf)
 	if err != nil {
 		return "", fmt.Errorf("failed to write file: %w", err)
 	}
+	addWrittenSpace(ctx, written)
 
 	return filePath, nil
 }
@@ -659,7 +840,8 @@ func downloadFile(
 func downloadSegments(
 	ctx context.Context,
 	path string,
-	segmentURLs []string,
+	offset int,
+	segments []*models.Segment,
 	downloadConfig *models.DownloadConfig,
 ) ([]string, error) {
 	semaphore := make(chan struct{}, downloadConfig.Concurrency)
@@ -667,7 +849,7 @@ func downloadSegments(
 
 	var firstErr atomic.Value
 
-	downloadedFiles := make([]string, len(segmentURLs))
+	downloadedFiles := make([]string, len(segments))
 	defer func() {
 		if firstErr.Load() != nil {
 			for _, path := range downloadedFiles {
@@ -681,9 +863,9 @@ func downloadSegments(
 	downloadCtx, cancelDownload := context.WithCancel(ctx)
 	defer cancelDownload()
 
-	for i, segmentURL := range segmentURLs {
+	for i, segment := range segments {
 		wg.Add(1)
-		go func(idx int, url string) {
+		go func(idx int, segment *models.Segment) {
 			defer wg.Done()
 
 			select {
@@ -697,25 +879,25 @@ func downloadSegments(
 			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
 
-			segmentFileName := fmt.Sprintf("segment_%05d", idx)
+			segmentFileName := fmt.Sprintf("segment_%05d", offset+idx)
 			segmentPath := filepath.Join(path, segmentFileName)
 
 			filePath, err := downloadFile(
-				ctx, url,
+				ctx, segment,
 				segmentPath,
 				downloadConfig,
 			)
 
 			if err != nil {
 				if firstErr.Load() == nil {
-					firstErr.Store(fmt.Errorf("failed to download segment %d: %w", idx, err))
+					firstErr.Store(fmt.Errorf("failed to download segment %d: %w", offset+idx, err))
 					cancelDownload()
 				}
 				return
 			}
 
 			downloadedFiles[idx] = filePath
-		}(i, segmentURL)
+		}(i, segment)
 	}
 	wg.Wait()
 
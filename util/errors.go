@@ -14,13 +14,21 @@ var (
 	ErrTimeout                  = &Error{Message: "timeout error when downloading. try again"}
 	ErrUnknownRIFF              = &Error{Message: "uknown RIFF format"}
 	ErrUnsupportedImageFormat   = &Error{Message: "unsupported image format"}
+	ErrImageTooLarge            = &Error{Message: "image is too large for this instance"}
 	ErrUnsupportedExtractorType = &Error{Message: "unsupported extractor type"}
 	ErrMediaGroupLimitExceeded  = &Error{Message: "media group limit exceeded for this group. try changing /settings"}
 	ErrNSFWNotAllowed           = &Error{Message: "this content is marked as nsfw and can't be downloaded in this group. try changing /settings or use me privately"}
 	ErrInlineMediaGroup         = &Error{Message: "you can't download media groups in inline mode. try using me in a private chat"}
+	ErrInlineLiveStream         = &Error{Message: "you can't record live streams in inline mode. try using me in a private chat"}
 	ErrAuthenticationNeeded     = &Error{Message: "this instance is not authenticated with this service."}
 	ErrFileTooLarge             = &Error{Message: "file is too large for this instance"}
+	ErrDiskSpaceLow             = &Error{Message: "this instance is running low on disk space. try again later"}
 	ErrTelegramFileTooLarge     = &Error{Message: "file is too large for your telegram botapi. be sure to use a local botapi for large files"}
 	ErrDurationTooLong          = &Error{Message: "media duration is too long for this instance"}
+	ErrInvalidClip              = &Error{Message: "invalid clip range. use timestamps like 1:20-2:05 within the media duration"}
+	ErrNoteNotSupported         = &Error{Message: "this content can't be sent as a voice message or video note"}
+	ErrVideoNoteTooLong         = &Error{Message: "video notes can't be longer than 60 seconds. try clipping the video"}
 	ErrPaidContent              = &Error{Message: "this content is paid"}
+	ErrNoSubtitles              = &Error{Message: "no subtitles are available for this content"}
+	ErrSkippedByPlugin          = &Error{Message: "this content was filtered out by this instance"}
 )
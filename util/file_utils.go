@@ -79,7 +79,7 @@ func EnsureFileInDownloadsDir(fileName string) string {
 	if filepath.IsAbs(fileName) {
 		return fileName
 	}
-	return filepath.Join(config.Env.DownloadsDirectory, fileName)
+	return filepath.Join(config.Env().DownloadsDirectory, fileName)
 }
 
 // removes files older than the specified duration
@@ -12,9 +12,11 @@ import (
 	_ "image/gif" // register GIF decoder
 	_ "image/png" // register PNG decoder
 
+	"github.com/govdbot/govd/config"
+	"github.com/govdbot/govd/util/libav"
+
 	_ "github.com/strukturag/libheif/go/heif" // register HEIF decoder
 	"go.uber.org/zap"
-	"golang.org/x/image/draw"
 	_ "golang.org/x/image/webp" // register WebP decoder
 )
 
@@ -33,40 +35,11 @@ func ImgToJPEG(file io.ReadSeeker, outputPath string) error {
 	}
 	defer outputFile.Close()
 
-	img, err := DecodeImage(file, 0)
-	if err != nil {
-		os.Remove(outputPath)
-		return fmt.Errorf("failed to decode image: %w", err)
-	}
-	if img == nil {
-		// already a jpeg
-		if _, err = io.Copy(outputFile, file); err != nil {
-			os.Remove(outputPath)
-			return fmt.Errorf("failed to copy image: %w", err)
-		}
-		return nil
-	}
-	err = jpeg.Encode(outputFile, img, nil)
-	if err != nil {
-		os.Remove(outputPath)
-		return fmt.Errorf("failed to encode image: %w", err)
-	}
-	return nil
-}
-
-func ResizeImgToJPEG(file io.ReadSeeker, outputPath string, resize int) error {
-	outputFile, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer outputFile.Close()
-
-	img, err := DecodeImage(file, resize)
+	img, err := DecodeImage(file)
 	if err != nil {
 		os.Remove(outputPath)
 		return fmt.Errorf("failed to decode image: %w", err)
 	}
-
 	if img == nil {
 		// already a jpeg
 		if _, err = io.Copy(outputFile, file); err != nil {
@@ -83,42 +56,83 @@ func ResizeImgToJPEG(file io.ReadSeeker, outputPath string, resize int) error {
 	return nil
 }
 
-func DecodeImage(
-	file io.ReadSeeker,
-	resize int,
-) (image.Image, error) {
+// DecodeImage decodes the image, once its header is checked
+// against the configured limits. returns nil for jpeg images
+// that can be kept as they are. larger images are downscaled
+func DecodeImage(file io.ReadSeeker) (image.Image, error) {
 	format, err := DetectImageFormat(file)
 	if err != nil {
 		return nil, fmt.Errorf("failed to detect image format: %w", err)
 	}
 	zap.S().Debugf("detected image format: %s", format)
 
+	width, height, err := CheckImageLimits(file, format)
+	if err != nil {
+		return nil, err
+	}
+	isOversize := max(width, height) > maxImageDimension
+
 	if format == "jpeg" {
 		if _, err = file.Seek(0, io.SeekStart); err != nil {
 			return nil, fmt.Errorf("failed to reset file position: %w", err)
 		}
-		if resize > 0 {
-			img, err := jpeg.Decode(file)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decode image: %w", err)
-			}
-			dst := image.NewRGBA(image.Rect(0, 0, resize, resize))
-			draw.NearestNeighbor.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Over, nil)
-			return dst, nil
+		if !isOversize {
+			// already a jpeg, no need to decode
+			return nil, nil
 		}
-		// already a jpeg, no need to decode
-		return nil, nil
 	}
 	if _, err = file.Seek(0, io.SeekStart); err != nil {
 		return nil, fmt.Errorf("failed to reset file position: %w", err)
 	}
+	if isLibavFormat(format) {
+		// downscaled while decoding
+		img, err := decodeWithLibav(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image: %w", err)
+		}
+		return img, nil
+	}
 	img, _, err := image.Decode(file)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
+	if isOversize {
+		img = fitImage(img, maxImageDimension)
+	}
 	return img, nil
 }
 
+// go has no decoder for avif and jpeg xl
+func isLibavFormat(format string) bool {
+	return format == "avif" || format == "jxl"
+}
+
+// the image is written to a file and decoded by libav,
+// which downscales it to fit in maxImageDimension
+func decodeWithLibav(file io.ReadSeeker) (image.Image, error) {
+	tempFile, err := os.CreateTemp(config.Env().DownloadsDirectory, "image-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = io.Copy(tempFile, file)
+	tempFile.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+	return libav.DecodeImage(tempFile.Name(), maxImageDimension)
+}
+
+// GetImageExtension returns the file
+// extension of a detected image format
+func GetImageExtension(format string) string {
+	if format == "heif" {
+		return "heic"
+	}
+	return format
+}
+
 func DetectImageFormat(file io.ReadSeeker) (string, error) {
 	header := make([]byte, 12)
 
@@ -144,10 +158,19 @@ func DetectImageFormat(file io.ReadSeeker) (string, error) {
 		return "gif", nil
 	}
 
+	if isAVIF(header) {
+		return "avif", nil
+	}
+
 	if isHEIF(header) {
 		return "heif", nil
 	}
 
+	if bytes.HasPrefix(header, jxlCodestreamHeader) ||
+		bytes.Equal(header, jxlContainerHeader) {
+		return "jxl", nil
+	}
+
 	if bytes.HasPrefix(header, riffHeader) {
 		if bytes.Equal(header[8:12], webpHeader) {
 			return "webp", nil
@@ -170,3 +193,11 @@ func isHEIF(header []byte) bool {
 
 	return slices.Contains(heifBrands, brand)
 }
+
+func isAVIF(header []byte) bool {
+	if !bytes.Equal(header[4:8], []byte("ftyp")) {
+		return false
+	}
+	brand := string(header[8:12])
+	return brand == "avif" || brand == "avis"
+}
@@ -0,0 +1,208 @@
+package util
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/govdbot/govd/config"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// images with a larger side are
+	// downscaled once decoded
+	maxImageDimension = 4096
+	// go decoders hold the whole image in memory before it's
+	// downscaled, so larger images are rejected even when
+	// the pixel count isn't limited
+	maxDecodePixels = 4 * maxImageDimension * maxImageDimension
+
+	// limits of telegram for photos, larger
+	// images are sent as documents instead
+	TelegramPhotoMaxSize  = 10 * 1024 * 1024
+	telegramPhotoMaxRatio = 20
+)
+
+var errInvalidBox = errors.New("invalid heif box")
+
+// CheckImageLimits reads the size of the image from its header,
+// without decoding it, and rejects images over the configured
+// byte size or pixel count. returns the width and height
+func CheckImageLimits(file io.ReadSeeker, format string) (int, int, error) {
+	fileSize, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get file size: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, fmt.Errorf("failed to reset file position: %w", err)
+	}
+	if config.Env().MaxImageSize > 0 && fileSize > config.Env().MaxImageSize {
+		return 0, 0, ErrImageTooLarge
+	}
+
+	var width, height int
+	switch format {
+	case "heif", "avif":
+		width, height, err = getHEIFSize(file, fileSize)
+	case "jxl":
+		width, height, err = getJXLSize(file, fileSize)
+	default:
+		var imageConfig image.Config
+		imageConfig, _, err = image.DecodeConfig(file)
+		width, height = imageConfig.Width, imageConfig.Height
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, fmt.Errorf("failed to reset file position: %w", err)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read image header: %w", err)
+	}
+	if width <= 0 || height <= 0 {
+		return 0, 0, errors.New("invalid image size")
+	}
+
+	zap.S().Debugf("image size: %dx%d", width, height)
+	maxPixels := config.Env().MaxImagePixels
+	if maxPixels <= 0 && !isLibavFormat(format) {
+		maxPixels = maxDecodePixels
+	}
+	if maxPixels > 0 && int64(width)*int64(height) > maxPixels {
+		return 0, 0, ErrImageTooLarge
+	}
+	return width, height, nil
+}
+
+// ExceedsPhotoLimits reports whether telegram would reject an
+// image of the given size as a photo. their total size limit
+// can't be exceeded, as images are downscaled to fit in
+// maxImageDimension, so only the aspect ratio is checked
+func ExceedsPhotoLimits(width int, height int) bool {
+	if width <= 0 || height <= 0 {
+		return false
+	}
+	longest, shortest := max(width, height), min(width, height)
+	return longest > telegramPhotoMaxRatio*shortest
+}
+
+// downscales the image when its larger
+// side exceeds the given dimension
+func fitImage(img image.Image, dimension int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	longest := max(width, height)
+	if longest <= dimension {
+		return img
+	}
+	width = max(width*dimension/longest, 1)
+	height = max(height*dimension/longest, 1)
+	zap.S().Debugf("downscaling image to %dx%d", width, height)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
+
+// the size of a heif image is in the image spatial extents
+// property, at meta/iprp/ipco/ispe. grid images have one for
+// the whole image and one per tile, so the largest is used
+func getHEIFSize(file io.ReadSeeker, fileSize int64) (int, int, error) {
+	var width, height int
+	path := []string{"meta", "iprp", "ipco", "ispe"}
+	err := findHEIFBoxes(file, 0, fileSize, path, func(offset int64, size int64) error {
+		if size < 12 {
+			return errInvalidBox
+		}
+		data := make([]byte, 12)
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(file, data); err != nil {
+			return err
+		}
+		// version and flags, then width and height
+		boxWidth := int(binary.BigEndian.Uint32(data[4:8]))
+		boxHeight := int(binary.BigEndian.Uint32(data[8:12]))
+		if int64(boxWidth)*int64(boxHeight) > int64(width)*int64(height) {
+			width, height = boxWidth, boxHeight
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if width == 0 || height == 0 {
+		return 0, 0, errors.New("image size not found")
+	}
+	return width, height, nil
+}
+
+// calls fn with the payload offset and size of
+// every box at the given path of box types
+func findHEIFBoxes(
+	file io.ReadSeeker,
+	start int64,
+	end int64,
+	path []string,
+	fn func(offset int64, size int64) error,
+) error {
+	return walkHEIFBoxes(file, start, end, func(boxType string, offset int64, size int64) error {
+		if boxType != path[0] {
+			return nil
+		}
+		if boxType == "meta" {
+			// full box, skip version and flags
+			offset += 4
+			size -= 4
+		}
+		if len(path) == 1 {
+			return fn(offset, size)
+		}
+		return findHEIFBoxes(file, offset, offset+size, path[1:], fn)
+	})
+}
+
+// calls fn with the type, payload offset and payload
+// size of each box between the start and end offsets
+func walkHEIFBoxes(
+	file io.ReadSeeker,
+	start int64,
+	end int64,
+	fn func(boxType string, offset int64, size int64) error,
+) error {
+	header := make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(file, header[:8]); err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			// extends to the end
+			size = end - offset
+		case 1:
+			if _, err := io.ReadFull(file, header[8:16]); err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize || size > end-offset {
+			return errInvalidBox
+		}
+		if err := fn(boxType, offset+headerSize, size-headerSize); err != nil {
+			return err
+		}
+		offset += size
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package util
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	jxlCodestreamHeader = []byte{0xFF, 0x0A}
+	jxlContainerHeader  = []byte{
+		0x00, 0x00, 0x00, 0x0C, 0x4A, 0x58, 0x4C, 0x20,
+		0x0D, 0x0A, 0x87, 0x0A,
+	}
+
+	errJXLSizeNotFound = errors.New("jpeg xl codestream not found")
+)
+
+// the size header is bit packed, least
+// significant bit of each byte first
+type jxlBitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *jxlBitReader) read(bits int) (uint32, error) {
+	var value uint32
+	for i := range bits {
+		if r.pos >= len(r.data)*8 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		bit := (r.data[r.pos/8] >> (r.pos % 8)) & 1
+		value |= uint32(bit) << i
+		r.pos++
+	}
+	return value, nil
+}
+
+// reads a dimension, either in multiples of 8 or
+// as one of four distributions picked by a selector
+func (r *jxlBitReader) readDimension(div8 bool) (int, error) {
+	if div8 {
+		value, err := r.read(5)
+		return (int(value) + 1) * 8, err
+	}
+	selector, err := r.read(2)
+	if err != nil {
+		return 0, err
+	}
+	value, err := r.read([]int{9, 13, 18, 30}[selector])
+	return int(value) + 1, err
+}
+
+// the size of a jpeg xl image is in the size header, right
+// after the codestream signature. in the container format
+// the codestream is in a jxlc box, or split in jxlp boxes
+func getJXLSize(file io.ReadSeeker, fileSize int64) (int, int, error) {
+	header := make([]byte, len(jxlContainerHeader))
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, 0, err
+	}
+	var offset int64
+	if bytes.Equal(header[:n], jxlContainerHeader) {
+		offset = -1
+		err := walkHEIFBoxes(file, 0, fileSize, func(boxType string, boxOffset int64, size int64) error {
+			if offset >= 0 {
+				return nil
+			}
+			switch boxType {
+			case "jxlc":
+				offset = boxOffset
+			case "jxlp":
+				// sequence index of the part
+				offset = boxOffset + 4
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+		if offset < 0 {
+			return 0, 0, errJXLSizeNotFound
+		}
+	}
+
+	// signature and at most 9 bytes of size header
+	data := make([]byte, 11)
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	n, err = io.ReadFull(file, data)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, 0, err
+	}
+	if !bytes.HasPrefix(data[:n], jxlCodestreamHeader) {
+		return 0, 0, errJXLSizeNotFound
+	}
+	return parseJXLSizeHeader(data[2:n])
+}
+
+func parseJXLSizeHeader(data []byte) (int, int, error) {
+	r := &jxlBitReader{data: data}
+	div8, err := r.read(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	height, err := r.readDimension(div8 == 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	ratio, err := r.read(3)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var width int
+	switch ratio {
+	case 0:
+		width, err = r.readDimension(div8 == 1)
+		if err != nil {
+			return 0, 0, err
+		}
+	case 1:
+		width = height
+	case 2:
+		width = height * 12 / 10
+	case 3:
+		width = height * 4 / 3
+	case 4:
+		width = height * 3 / 2
+	case 5:
+		width = height * 16 / 9
+	case 6:
+		width = height * 5 / 4
+	case 7:
+		width = height * 2
+	}
+	return width, height, nil
+}
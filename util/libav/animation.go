@@ -0,0 +1,34 @@
+package libav
+
+import (
+	"fmt"
+	"os"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"go.uber.org/zap"
+)
+
+// ConvertToAnimation converts an animated image, or a video,
+// into a silent h264 mp4 that telegram plays as an animation
+func ConvertToAnimation(inputPath string, outputPath string) error {
+	silent := zap.S().Level() != zap.DebugLevel
+	err := ffmpeg.
+		Input(inputPath).
+		Output(outputPath, ffmpeg.KwArgs{
+			"movflags": "+faststart",
+			"an":       "",
+			"c:v":      "libx264",
+			"preset":   "veryfast",
+			"pix_fmt":  "yuv420p",
+			// h264 needs even dimensions
+			"vf": "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		}).
+		Silent(silent).
+		OverWriteOutput().
+		Run()
+	if err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("failed to convert animation: %w", err)
+	}
+	return nil
+}
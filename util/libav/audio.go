@@ -0,0 +1,163 @@
+package libav
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"go.uber.org/zap"
+)
+
+// loudnorm resamples to 192khz, the output is
+// set back to a rate every encoder supports
+const normalizedSampleRate = "48000"
+
+// AudioEncoder is an ffmpeg encoder and its bitrate,
+// empty for lossless encoders
+type AudioEncoder struct {
+	Codec   string
+	Bitrate string
+}
+
+// LoudnessTarget is the EBU R128 target of the
+// normalization, as used by the loudnorm filter
+type LoudnessTarget struct {
+	Integrated float64 // integrated loudness, in LUFS
+	TruePeak   float64 // maximum true peak, in dBTP
+	Range      float64 // loudness range, in LU
+}
+
+// values measured by the first pass of loudnorm
+type loudnessMeasurement struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// ProcessAudio re-encodes the audio of the input with the given
+// encoder. with a loudness target, the audio is normalized in two
+// passes: the first measures the input, so that the second can
+// apply a linear gain and keep the dynamics of the track
+func ProcessAudio(
+	ctx context.Context,
+	inputPath string,
+	outputPath string,
+	encoder *AudioEncoder,
+	target *LoudnessTarget,
+) error {
+	outputArgs := ffmpeg.KwArgs{
+		// covers are embedded again by the metadata plugin
+		"vn":  "",
+		"c:a": encoder.Codec,
+	}
+	if encoder.Bitrate != "" {
+		outputArgs["b:a"] = encoder.Bitrate
+	}
+	if target != nil {
+		measurement, err := measureLoudness(ctx, inputPath, target)
+		if err != nil {
+			// loudnorm still works in a single pass,
+			// adjusting the gain dynamically
+			zap.S().Debugf("failed to measure loudness: %v", err)
+		}
+		outputArgs["af"] = getLoudnormFilter(target, measurement)
+		outputArgs["ar"] = normalizedSampleRate
+	}
+
+	silent := zap.S().Level() != zap.DebugLevel
+	err := ffmpeg.
+		OutputContext(
+			ctx,
+			[]*ffmpeg.Stream{ffmpeg.Input(inputPath)},
+			outputPath, outputArgs,
+		).
+		Silent(silent).
+		OverWriteOutput().
+		Run()
+	if err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("failed to process audio: %w", err)
+	}
+	return nil
+}
+
+func measureLoudness(
+	ctx context.Context,
+	inputPath string,
+	target *LoudnessTarget,
+) (*loudnessMeasurement, error) {
+	var output bytes.Buffer
+	silent := zap.S().Level() != zap.DebugLevel
+	err := ffmpeg.
+		OutputContext(
+			ctx,
+			[]*ffmpeg.Stream{ffmpeg.Input(inputPath)},
+			"-", ffmpeg.KwArgs{
+				"vn": "",
+				"af": getLoudnormFilter(target, nil) + ":print_format=json",
+				"f":  "null",
+			},
+		).
+		WithErrorOutput(&output).
+		Silent(silent).
+		Run()
+	if err != nil {
+		return nil, err
+	}
+
+	// the measurement is the last json object of the log
+	log := output.String()
+	start := strings.LastIndex(log, "{")
+	end := strings.LastIndex(log, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("loudness measurement not found")
+	}
+	var measurement loudnessMeasurement
+	if err := json.Unmarshal([]byte(log[start:end+1]), &measurement); err != nil {
+		return nil, fmt.Errorf("failed to parse loudness measurement: %w", err)
+	}
+	// silent tracks measure -inf
+	for _, value := range []string{
+		measurement.InputI, measurement.InputTP,
+		measurement.InputLRA, measurement.InputThresh,
+		measurement.TargetOffset,
+	} {
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsInf(number, 0) || math.IsNaN(number) {
+			return nil, fmt.Errorf("invalid loudness measurement: %s", value)
+		}
+	}
+	zap.S().Debugf(
+		"measured loudness: %s LUFS, %s dBTP",
+		measurement.InputI, measurement.InputTP,
+	)
+	return &measurement, nil
+}
+
+func getLoudnormFilter(
+	target *LoudnessTarget,
+	measurement *loudnessMeasurement,
+) string {
+	filter := fmt.Sprintf(
+		"loudnorm=I=%g:TP=%g:LRA=%g",
+		target.Integrated, target.TruePeak, target.Range,
+	)
+	if measurement == nil {
+		return filter
+	}
+	return filter + fmt.Sprintf(
+		":measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+		measurement.InputI, measurement.InputTP,
+		measurement.InputLRA, measurement.InputThresh,
+		measurement.TargetOffset,
+	)
+}
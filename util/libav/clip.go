@@ -0,0 +1,89 @@
+package libav
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"go.uber.org/zap"
+)
+
+// CutOptions are used when cutting from a url
+type CutOptions struct {
+	Headers string // http headers, each ending with a crlf
+	Proxy   string // http proxy url, empty for none
+	MaxSize int64  // the output stops at this size, zero for no limit
+	// reads stalling for this long fail, zero for no limit
+	Timeout time.Duration
+}
+
+// CutMedia cuts the input, a file or a url, between start and
+// end, or until its end when end is zero. videos are re-encoded
+// to start on the exact frame, audio is copied as its packets
+// are short enough to cut on. ffmpeg is killed when ctx is done
+func CutMedia(
+	ctx context.Context,
+	input string,
+	outputPath string,
+	start time.Duration,
+	end time.Duration,
+	options *CutOptions,
+) error {
+	zap.S().Debugf("cutting %s from %s to %s", input, start, end)
+
+	inputArgs := ffmpeg.KwArgs{
+		"ss": formatSeconds(start),
+	}
+	outputArgs := ffmpeg.KwArgs{
+		"c": "copy",
+	}
+	if options != nil {
+		if options.Headers != "" {
+			inputArgs["headers"] = options.Headers
+		}
+		if options.Proxy != "" {
+			inputArgs["http_proxy"] = options.Proxy
+		}
+		if options.MaxSize > 0 {
+			outputArgs["fs"] = strconv.FormatInt(options.MaxSize, 10)
+		}
+		if options.Timeout > 0 {
+			// in microseconds
+			inputArgs["rw_timeout"] = strconv.FormatInt(options.Timeout.Microseconds(), 10)
+		}
+	}
+	if end > start {
+		outputArgs["t"] = formatSeconds(end - start)
+	}
+	if strings.ToLower(filepath.Ext(outputPath)) == ".mp4" {
+		outputArgs["movflags"] = "+faststart"
+		outputArgs["c:v"] = "libx264"
+		outputArgs["preset"] = "veryfast"
+		outputArgs["pix_fmt"] = "yuv420p"
+	}
+
+	silent := zap.S().Level() != zap.DebugLevel
+	err := ffmpeg.
+		OutputContext(
+			ctx,
+			[]*ffmpeg.Stream{ffmpeg.Input(input, inputArgs)},
+			outputPath, outputArgs,
+		).
+		Silent(silent).
+		OverWriteOutput().
+		Run()
+	if err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("failed to cut media: %w", err)
+	}
+	return nil
+}
+
+func formatSeconds(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
@@ -0,0 +1,168 @@
+package libav
+
+import (
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/asticode/go-astiav"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// how long decoding a single frame can take
+const decodeTimeout = 5 * time.Second
+
+// DecodeImage decodes the first frame of the file, for image
+// formats with no go decoder like avif and jpeg xl. frames in
+// pixel formats go can't handle are converted to rgba. also
+// used to read the cover art embedded in audio files.
+// frames with a larger side than maxDimension are downscaled
+// by libav, zero keeps their size
+func DecodeImage(imagePath string, maxDimension int) (image.Image, error) {
+	setLogLevel()
+
+	formatCtx := astiav.AllocFormatContext()
+	defer formatCtx.Free()
+
+	err := formatCtx.OpenInput(imagePath, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening input: %w", err)
+	}
+	defer formatCtx.CloseInput()
+
+	err = formatCtx.FindStreamInfo(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed finding stream info: %w", err)
+	}
+
+	stream, _, err := formatCtx.FindBestStream(
+		astiav.MediaTypeVideo, -1, -1)
+	if err != nil {
+		return nil, fmt.Errorf("failed finding image stream: %w", err)
+	}
+	return decodeNextFrame(formatCtx, stream, time.Now().Add(decodeTimeout), maxDimension)
+}
+
+// decodes the next frame of the stream from the current position
+// of the input. a new decoder is opened on each call, so that no
+// frames are left buffered from before a seek
+func decodeNextFrame(
+	formatCtx *astiav.FormatContext,
+	stream *astiav.Stream,
+	deadline time.Time,
+	maxDimension int,
+) (image.Image, error) {
+	codecParameters := stream.CodecParameters()
+	decoder := astiav.FindDecoder(codecParameters.CodecID())
+	if decoder == nil {
+		return nil, fmt.Errorf("no decoder found for codec %s", codecParameters.CodecID())
+	}
+
+	codecCtx := astiav.AllocCodecContext(decoder)
+	defer codecCtx.Free()
+
+	err := codecParameters.ToCodecContext(codecCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed setting codec parameters: %w", err)
+	}
+
+	err = codecCtx.Open(decoder, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening codec: %w", err)
+	}
+
+	packet := astiav.AllocPacket()
+	defer packet.Free()
+	frame := astiav.AllocFrame()
+	defer frame.Free()
+
+	for time.Now().Before(deadline) {
+		err := formatCtx.ReadFrame(packet)
+		if errors.Is(err, astiav.ErrEof) {
+			// still images and short videos may only
+			// output a frame once the decoder is drained
+			if err := codecCtx.SendPacket(nil); err != nil {
+				return nil, fmt.Errorf("failed draining decoder: %w", err)
+			}
+			if err := codecCtx.ReceiveFrame(frame); err != nil {
+				return nil, fmt.Errorf("failed receiving frame from decoder: %w", err)
+			}
+			return frameToImage(frame, maxDimension)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed reading frame: %w", err)
+		}
+		if packet.StreamIndex() != stream.Index() {
+			packet.Unref()
+			continue
+		}
+
+		err = codecCtx.SendPacket(packet)
+		packet.Unref()
+		if err != nil {
+			return nil, fmt.Errorf("failed sending packet to decoder: %w", err)
+		}
+
+		err = codecCtx.ReceiveFrame(frame)
+		if errors.Is(err, astiav.ErrEagain) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed receiving frame from decoder: %w", err)
+		}
+		return frameToImage(frame, maxDimension)
+	}
+
+	return nil, errors.New("timeout while waiting for frame")
+}
+
+func frameToImage(frame *astiav.Frame, maxDimension int) (image.Image, error) {
+	width, height := frame.Width(), frame.Height()
+	if longest := max(width, height); maxDimension > 0 && longest > maxDimension {
+		width = max(width*maxDimension/longest, 1)
+		height = max(height*maxDimension/longest, 1)
+	} else {
+		img, err := frame.Data().GuessImageFormat()
+		if err == nil {
+			if err := frame.Data().ToImage(img); err != nil {
+				return nil, fmt.Errorf("failed converting frame to image: %w", err)
+			}
+			return img, nil
+		}
+	}
+
+	// downscaled, or in pixel formats go can't
+	// handle, like 10-bit frames of hdr images
+	zap.S().Debugf(
+		"converting %s frame to %dx%d rgba",
+		frame.PixelFormat(), width, height,
+	)
+	scaleCtx, err := astiav.CreateSoftwareScaleContext(
+		frame.Width(),
+		frame.Height(),
+		frame.PixelFormat(),
+		width,
+		height,
+		astiav.PixelFormatRgba,
+		astiav.NewSoftwareScaleContextFlags(astiav.SoftwareScaleContextFlagBilinear),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating scale context: %w", err)
+	}
+	defer scaleCtx.Free()
+
+	rgbaFrame := astiav.AllocFrame()
+	defer rgbaFrame.Free()
+	if err := scaleCtx.ScaleFrame(frame, rgbaFrame); err != nil {
+		return nil, fmt.Errorf("failed converting frame: %w", err)
+	}
+	img, err := rgbaFrame.Data().GuessImageFormat()
+	if err != nil {
+		return nil, fmt.Errorf("failed guessing image format: %w", err)
+	}
+	if err := rgbaFrame.Data().ToImage(img); err != nil {
+		return nil, fmt.Errorf("failed converting frame to image: %w", err)
+	}
+	return img, nil
+}
@@ -4,24 +4,103 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/dustin/go-humanize"
 	"github.com/pkg/errors"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
 	"go.uber.org/zap"
 )
 
+// SegmentGroup is a run of segments sharing
+// the same init segment and timeline
+type SegmentGroup struct {
+	InitSegmentPath string
+	SegmentPaths    []string
+}
+
 func MergeSegments(
-	initSegmentPath string,
-	segmentPaths []string,
+	groups []SegmentGroup,
 	outputPath string,
 ) (string, error) {
-	if len(segmentPaths) == 0 {
+	switch len(groups) {
+	case 0:
 		return "", errors.New("no segments to merge")
+	case 1:
+		return mergeSegmentGroup(groups[0], outputPath)
 	}
-	if initSegmentPath != "" && fileExists(initSegmentPath) {
-		return mergeFragmentedMP4(initSegmentPath, segmentPaths, outputPath)
+
+	// groups can't be concatenated byte by byte, as timestamps
+	// restart and codec parameters may change at discontinuities.
+	// each group is merged on its own and then joined by ffmpeg
+	partPaths := make([]string, 0, len(groups))
+	defer func() {
+		for _, partPath := range partPaths {
+			os.Remove(partPath)
+		}
+	}()
+	for i, group := range groups {
+		partPath, err := mergeSegmentGroup(
+			group,
+			fmt.Sprintf("%s.part%03d", outputPath, i),
+		)
+		if err != nil {
+			return "", fmt.Errorf("failed to merge segment group %d: %w", i, err)
+		}
+		partPaths = append(partPaths, partPath)
+	}
+	if err := concatFiles(partPaths, outputPath); err != nil {
+		return "", err
+	}
+	zap.S().Debugf("merged %d segment groups: written to %s", len(groups), outputPath)
+	return outputPath, nil
+}
+
+func mergeSegmentGroup(group SegmentGroup, outputPath string) (string, error) {
+	if len(group.SegmentPaths) == 0 {
+		return "", errors.New("no segments to merge")
+	}
+	if group.InitSegmentPath != "" && fileExists(group.InitSegmentPath) {
+		return mergeFragmentedMP4(group.InitSegmentPath, group.SegmentPaths, outputPath)
+	}
+	return mergeRegularSegments(group.SegmentPaths, outputPath)
+}
+
+// joins files with the ffmpeg concat demuxer,
+// which rebuilds a continuous timeline
+func concatFiles(filePaths []string, outputPath string) error {
+	silent := zap.S().Level() != zap.DebugLevel
+
+	listPath := outputPath + ".txt"
+	var list strings.Builder
+	for _, filePath := range filePaths {
+		absPath, err := filepath.Abs(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to resolve path: %w", err)
+		}
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(absPath, "'", `'\''`))
+	}
+	if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write concat list: %w", err)
+	}
+	defer os.Remove(listPath)
+
+	err := ffmpeg.Input(listPath, ffmpeg.KwArgs{
+		"f":    "concat",
+		"safe": "0",
+	}).
+		Output(outputPath, ffmpeg.KwArgs{
+			"c": "copy",
+		}).
+		Silent(silent).
+		OverWriteOutput().
+		Run()
+	if err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("failed to concat segment groups: %w", err)
 	}
-	return mergeRegularSegments(segmentPaths, outputPath)
+	return nil
 }
 
 func mergeFragmentedMP4(
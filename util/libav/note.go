@@ -0,0 +1,73 @@
+package libav
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"go.uber.org/zap"
+)
+
+// VideoNoteMaxDuration is the longest video
+// note telegram plays, in seconds
+const VideoNoteMaxDuration = 60
+
+// ConvertToVoice converts the audio of the input
+// into a mono opus track, as telegram voice messages
+func ConvertToVoice(ctx context.Context, inputPath string, outputPath string) error {
+	silent := zap.S().Level() != zap.DebugLevel
+	err := ffmpeg.
+		OutputContext(
+			ctx,
+			[]*ffmpeg.Stream{ffmpeg.Input(inputPath)},
+			outputPath, ffmpeg.KwArgs{
+				"vn":          "",
+				"c:a":         "libopus",
+				"b:a":         "64k",
+				"ac":          1,
+				"application": "voip",
+				"f":           "ogg",
+			},
+		).
+		Silent(silent).
+		OverWriteOutput().
+		Run()
+	if err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("failed to convert voice: %w", err)
+	}
+	return nil
+}
+
+// ConvertToVideoNote crops the center square of the video, scaled
+// to the given length. longer videos are refused before converting,
+// the output is still cut in case the duration was rounded down
+func ConvertToVideoNote(ctx context.Context, inputPath string, outputPath string, length int64) error {
+	silent := zap.S().Level() != zap.DebugLevel
+	err := ffmpeg.
+		OutputContext(
+			ctx,
+			[]*ffmpeg.Stream{ffmpeg.Input(inputPath)},
+			outputPath, ffmpeg.KwArgs{
+				"movflags": "+faststart",
+				"t":        VideoNoteMaxDuration,
+				"c:v":      "libx264",
+				"c:a":      "aac",
+				"preset":   "veryfast",
+				"pix_fmt":  "yuv420p",
+				"vf": fmt.Sprintf(
+					`crop=min(iw\,ih):min(iw\,ih),scale=%d:%d,setsar=1`,
+					length, length,
+				),
+			},
+		).
+		Silent(silent).
+		OverWriteOutput().
+		Run()
+	if err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("failed to convert video note: %w", err)
+	}
+	return nil
+}
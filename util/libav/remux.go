@@ -12,27 +12,10 @@ import (
 )
 
 func RemuxFile(inputFile string) (string, error) {
-	if zap.S().Level() == zap.DebugLevel {
-		astiav.SetLogLevel(astiav.LogLevelDebug)
-	} else {
-		astiav.SetLogLevel(astiav.LogLevelQuiet)
-	}
+	setLogLevel()
 	defer os.Remove(inputFile)
 
 	ext := strings.ToLower(filepath.Ext(inputFile))
-	var muxerName string
-	switch ext {
-	case ".mp4":
-		muxerName = "mp4"
-	case ".mkv":
-		muxerName = "matroska"
-	case ".mov":
-		muxerName = "mov"
-	case ".avi":
-		muxerName = "avi"
-	default:
-		return "", fmt.Errorf("unsupported output container for extension: %s", ext)
-	}
 	outputFile := strings.TrimSuffix(inputFile, ext) + ".remuxed" + ext
 
 	inputCtx := astiav.AllocFormatContext()
@@ -46,13 +29,50 @@ func RemuxFile(inputFile string) (string, error) {
 	}
 	defer inputCtx.CloseInput()
 
+	if err := remux(inputCtx, outputFile); err != nil {
+		return "", err
+	}
+	return outputFile, nil
+}
+
+// CanRemux reports whether outputFile has
+// an extension supported by the remuxer
+func CanRemux(outputFile string) bool {
+	_, err := getMuxerName(outputFile)
+	return err == nil
+}
+
+func getMuxerName(outputFile string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(outputFile))
+	switch ext {
+	case ".mp4", ".m4a":
+		return "mp4", nil
+	case ".mkv":
+		return "matroska", nil
+	case ".mov":
+		return "mov", nil
+	case ".avi":
+		return "avi", nil
+	default:
+		return "", fmt.Errorf("unsupported output container for extension: %s", ext)
+	}
+}
+
+// copies all the supported streams of an opened input
+// into outputFile, without re-encoding
+func remux(inputCtx *astiav.FormatContext, outputFile string) error {
+	muxerName, err := getMuxerName(outputFile)
+	if err != nil {
+		return err
+	}
+
 	if err := inputCtx.FindStreamInfo(nil); err != nil {
-		return "", fmt.Errorf("failed to find stream info: %w", err)
+		return fmt.Errorf("failed to find stream info: %w", err)
 	}
 
 	outCtx, err := astiav.AllocOutputFormatContext(nil, muxerName, outputFile)
 	if err != nil {
-		return "", fmt.Errorf("failed to alloc output format context: %w", err)
+		return fmt.Errorf("failed to alloc output format context: %w", err)
 	}
 	defer outCtx.Free()
 
@@ -67,23 +87,23 @@ func RemuxFile(inputFile string) (string, error) {
 		}
 		outStream := outCtx.NewStream(nil)
 		if outStream == nil {
-			return "", errors.New("failed to create new stream in output context")
+			return errors.New("failed to create new stream in output context")
 		}
 		if err := inCP.Copy(outStream.CodecParameters()); err != nil {
-			return "", fmt.Errorf("failed to copy codec parameters: %w", err)
+			return fmt.Errorf("failed to copy codec parameters: %w", err)
 		}
 		outStream.CodecParameters().SetCodecTag(0)
 		outStream.SetTimeBase(inStream.TimeBase())
 		inToOutIdx[inIdx] = len(inToOutIdx)
 	}
 	if len(inToOutIdx) == 0 {
-		return "", errors.New("no supported streams to remux")
+		return errors.New("no supported streams to remux")
 	}
 
 	if !outCtx.OutputFormat().Flags().Has(astiav.IOFormatFlagNofile) {
 		ioCtx, err := astiav.OpenIOContext(outputFile, astiav.NewIOContextFlags(astiav.IOContextFlagWrite), nil, nil)
 		if err != nil {
-			return "", fmt.Errorf("failed to open output IO context: %w", err)
+			return fmt.Errorf("failed to open output IO context: %w", err)
 		}
 		defer ioCtx.Close()
 		outCtx.SetPb(ioCtx)
@@ -91,7 +111,7 @@ func RemuxFile(inputFile string) (string, error) {
 
 	if err := outCtx.WriteHeader(nil); err != nil {
 		os.Remove(outputFile)
-		return "", fmt.Errorf("failed to write output header: %w", err)
+		return fmt.Errorf("failed to write output header: %w", err)
 	}
 
 	packet := astiav.AllocPacket()
@@ -102,7 +122,7 @@ func RemuxFile(inputFile string) (string, error) {
 				break
 			}
 			os.Remove(outputFile)
-			return "", fmt.Errorf("failed to read frame: %w", err)
+			return fmt.Errorf("failed to read frame: %w", err)
 		}
 		outIdx, ok := inToOutIdx[packet.StreamIndex()]
 		if !ok {
@@ -124,14 +144,22 @@ func RemuxFile(inputFile string) (string, error) {
 		if err := outCtx.WriteInterleavedFrame(packet); err != nil {
 			packet.Unref()
 			os.Remove(outputFile)
-			return "", fmt.Errorf("failed to write frame: %w", err)
+			return fmt.Errorf("failed to write frame: %w", err)
 		}
 		packet.Unref()
 	}
 
 	if err := outCtx.WriteTrailer(); err != nil {
 		os.Remove(outputFile)
-		return "", fmt.Errorf("failed to write trailer: %w", err)
+		return fmt.Errorf("failed to write trailer: %w", err)
+	}
+	return nil
+}
+
+func setLogLevel() {
+	if zap.S().Level() == zap.DebugLevel {
+		astiav.SetLogLevel(astiav.LogLevelDebug)
+	} else {
+		astiav.SetLogLevel(astiav.LogLevelQuiet)
 	}
-	return outputFile, nil
 }
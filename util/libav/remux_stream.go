@@ -0,0 +1,80 @@
+package libav
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/asticode/go-astiav"
+	"github.com/pkg/errors"
+)
+
+// size of the buffer used by the custom input IO context
+const streamBufferSize = 64 * 1024
+
+// RemuxReader remuxes a non-seekable stream (mp4 with moov box
+// before mdat, fragmented mp4 or mpeg-ts) into outputFile,
+// so the source never needs to be written to disk first.
+// inputFormat may be empty to let libav probe the stream
+func RemuxReader(
+	reader io.Reader,
+	inputFormat string,
+	outputFile string,
+) error {
+	setLogLevel()
+
+	ioCtx, err := astiav.AllocIOContext(
+		streamBufferSize, false,
+		(&avReader{reader: reader}).Read,
+		nil, nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to alloc input IO context: %w", err)
+	}
+	// the IO context is not owned by the format context
+	// when set by the caller, so it must be freed here
+	defer ioCtx.Free()
+
+	inputCtx := astiav.AllocFormatContext()
+	if inputCtx == nil {
+		return errors.New("failed to alloc input format context")
+	}
+	defer inputCtx.Free()
+	inputCtx.SetPb(ioCtx)
+
+	var format *astiav.InputFormat
+	if inputFormat != "" {
+		format = astiav.FindInputFormat(inputFormat)
+	}
+	if err := inputCtx.OpenInput("", format, nil); err != nil {
+		return fmt.Errorf("failed to open input stream: %w", err)
+	}
+	defer inputCtx.CloseInput()
+
+	return remux(inputCtx, outputFile)
+}
+
+// avReader adapts an io.Reader to the libav read callback,
+// which expects data and EOF to never be returned together
+type avReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *avReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	for {
+		n, err := r.reader.Read(p)
+		if err != nil {
+			r.err = err
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
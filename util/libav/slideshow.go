@@ -0,0 +1,110 @@
+package libav
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"go.uber.org/zap"
+)
+
+const (
+	slideshowFrameRate = 30
+	slideshowMaxSize   = 1920
+)
+
+// RenderSlideshow renders the images into an h264 video, each shown
+// for the given delay, with the audio looped over the whole video.
+// images are scaled and padded to the size of the first one
+func RenderSlideshow(
+	ctx context.Context,
+	imagePaths []string,
+	audioPath string,
+	outputPath string,
+	delay time.Duration,
+) error {
+	if len(imagePaths) == 0 {
+		return errors.New("no images to render")
+	}
+	silent := zap.S().Level() != zap.DebugLevel
+
+	width, height, err := getSlideshowSize(imagePaths[0])
+	if err != nil {
+		return err
+	}
+	size := fmt.Sprintf("%d:%d", width, height)
+	seconds := delay.Seconds()
+
+	streams := make([]*ffmpeg.Stream, 0, len(imagePaths))
+	for _, path := range imagePaths {
+		stream := ffmpeg.
+			Input(path, ffmpeg.KwArgs{
+				"loop":      1,
+				"t":         seconds,
+				"framerate": slideshowFrameRate,
+			}).
+			Filter("scale", ffmpeg.Args{size}, ffmpeg.KwArgs{
+				"force_original_aspect_ratio": "decrease",
+			}).
+			Filter("pad", ffmpeg.Args{size, "(ow-iw)/2", "(oh-ih)/2"}).
+			Filter("setsar", ffmpeg.Args{"1"})
+		streams = append(streams, stream)
+	}
+	videoStream := ffmpeg.Concat(streams)
+	audioStream := ffmpeg.
+		Input(audioPath, ffmpeg.KwArgs{"stream_loop": -1}).
+		Audio()
+
+	err = ffmpeg.OutputContext(
+		ctx,
+		[]*ffmpeg.Stream{videoStream, audioStream},
+		outputPath,
+		ffmpeg.KwArgs{
+			"movflags": "+faststart",
+			"c:v":      "libx264",
+			"preset":   "veryfast",
+			"tune":     "stillimage",
+			"pix_fmt":  "yuv420p",
+			"r":        slideshowFrameRate,
+			"c:a":      "aac",
+			"b:a":      "128k",
+			// the audio is looped, so the
+			// images set the video length
+			"t": seconds * float64(len(imagePaths)),
+		}).
+		Silent(silent).
+		OverWriteOutput().
+		Run()
+	if err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("failed to render slideshow: %w", err)
+	}
+	return nil
+}
+
+// size of the image, fitted in the maximum
+// size and rounded to even numbers for h264
+func getSlideshowSize(imagePath string) (int, int, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to decode image: %w", err)
+	}
+	width, height := config.Width, config.Height
+	if longest := max(width, height); longest > slideshowMaxSize {
+		width = width * slideshowMaxSize / longest
+		height = height * slideshowMaxSize / longest
+	}
+	width, height = max(width&^1, 2), max(height&^1, 2)
+	return width, height, nil
+}
@@ -0,0 +1,66 @@
+package libav
+
+import (
+	"fmt"
+	"os"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"go.uber.org/zap"
+	"golang.org/x/text/language"
+)
+
+// EmbedSubtitles soft-muxes an srt file into
+// an mp4 video as a mov_text subtitle track
+func EmbedSubtitles(
+	videoFile string,
+	subtitleFile string,
+	subtitleLanguage string,
+) error {
+	silent := zap.S().Level() != zap.DebugLevel
+
+	tempFileName := videoFile + ".temp"
+	outputFile := videoFile
+
+	err := os.Rename(videoFile, tempFileName)
+	if err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+	defer os.Remove(tempFileName)
+
+	videoStream := ffmpeg.Input(tempFileName)
+	subtitleStream := ffmpeg.Input(subtitleFile)
+
+	err = ffmpeg.Output(
+		[]*ffmpeg.Stream{videoStream, subtitleStream},
+		outputFile,
+		ffmpeg.KwArgs{
+			"movflags":        "+faststart",
+			"c:v":             "copy",
+			"c:a":             "copy",
+			"c:s":             "mov_text",
+			"metadata:s:s:0":  "language=" + getISO3Language(subtitleLanguage),
+			"disposition:s:0": "default",
+		}).
+		Silent(silent).
+		OverWriteOutput().
+		Run()
+
+	if err != nil {
+		os.Remove(outputFile)
+		// keep the video without subtitles
+		os.Rename(tempFileName, videoFile)
+		return fmt.Errorf("failed to embed subtitles: %w", err)
+	}
+
+	return nil
+}
+
+// mp4 stores iso 639-2 language codes
+func getISO3Language(tag string) string {
+	parsed, err := language.Parse(tag)
+	if err != nil {
+		return "und"
+	}
+	base, _ := parsed.Base()
+	return base.ISO3()
+}
@@ -2,8 +2,8 @@ package libav
 
 import (
 	"fmt"
-	"image/jpeg"
-	"os"
+	"image"
+	"image/color"
 	"time"
 
 	"github.com/asticode/go-astiav"
@@ -11,112 +11,106 @@ import (
 	"go.uber.org/zap"
 )
 
-func ExtractVideoThumbnail(videoPath string, imagePath string) error {
-	if zap.S().Level() == zap.DebugLevel {
-		astiav.SetLogLevel(astiav.LogLevelDebug)
-	} else {
-		astiav.SetLogLevel(astiav.LogLevelQuiet)
-	}
+const (
+	// frames sampled across the video
+	thumbnailSamples = 5
+
+	// points per side of the grid
+	// the luma variance is sampled on
+	lumaSampleGrid = 64
+)
+
+// ExtractVideoThumbnail samples frames across the video and
+// returns the most informative one, with the highest luma
+// variance, so that black frames and fades are skipped
+func ExtractVideoThumbnail(videoPath string) (image.Image, error) {
+	setLogLevel()
 
 	formatCtx := astiav.AllocFormatContext()
 	defer formatCtx.Free()
 
 	err := formatCtx.OpenInput(videoPath, nil, nil)
 	if err != nil {
-		return fmt.Errorf("failed opening input: %w", err)
+		return nil, fmt.Errorf("failed opening input: %w", err)
 	}
+	defer formatCtx.CloseInput()
 
 	err = formatCtx.FindStreamInfo(nil)
 	if err != nil {
-		return fmt.Errorf("failed finding stream info: %w", err)
+		return nil, fmt.Errorf("failed finding stream info: %w", err)
 	}
 
-	stream, codec, err := formatCtx.FindBestStream(
+	stream, _, err := formatCtx.FindBestStream(
 		astiav.MediaTypeVideo, -1, -1)
 	if err != nil {
-		return fmt.Errorf("failed finding best video stream: %w", err)
-	}
-
-	codecParameters := stream.CodecParameters()
-
-	decoder := astiav.FindDecoder(codec.ID())
-	if decoder == nil {
-		return fmt.Errorf("no decoder found for codec %s", codec.String())
-	}
-
-	codecCtx := astiav.AllocCodecContext(decoder)
-	defer codecCtx.Free()
-
-	err = codecParameters.ToCodecContext(codecCtx)
-	if err != nil {
-		return fmt.Errorf("failed setting codec parameters: %w", err)
+		return nil, fmt.Errorf("failed finding best video stream: %w", err)
 	}
 
-	err = codecCtx.Open(decoder, nil)
-	if err != nil {
-		return fmt.Errorf("failed opening codec: %w", err)
+	// in AV_TIME_BASE units
+	duration := formatCtx.Duration()
+	samples := thumbnailSamples
+	if duration <= 0 {
+		samples = 1
 	}
 
-	packet := astiav.AllocPacket()
-	defer packet.Free()
-	frame := astiav.AllocFrame()
-	defer frame.Free()
-
-	startTime := time.Now()
-	timeout := 5 * time.Second
-
-	// read frames until we find a video frame or timeout
-	for time.Since(startTime) < timeout {
-		err := formatCtx.ReadFrame(packet)
-		if err != nil {
-			if errors.Is(err, astiav.ErrEof) {
-				return errors.New("end of file reached before finding video frame")
+	deadline := time.Now().Add(decodeTimeout)
+	var best image.Image
+	bestVariance := -1.0
+	for i := range samples {
+		if samples > 1 {
+			// middle of each equal part of the video
+			timestamp := duration * int64(2*i+1) / int64(2*samples)
+			err := formatCtx.SeekFrame(-1, timestamp, astiav.NewSeekFlags(astiav.SeekFlagBackward))
+			if err != nil {
+				// keep decoding from where the input is
+				zap.S().Debugf("failed seeking to thumbnail sample: %v", err)
 			}
-			return fmt.Errorf("failed reading frame: %w", err)
-		}
-
-		if packet.StreamIndex() != stream.Index() {
-			packet.Unref()
-			continue
-		}
-
-		err = codecCtx.SendPacket(packet)
-		if err != nil {
-			return fmt.Errorf("failed sending packet to decoder: %w", err)
 		}
-
-		err = codecCtx.ReceiveFrame(frame)
+		img, err := decodeNextFrame(formatCtx, stream, deadline, 0)
 		if err != nil {
-			if errors.Is(err, astiav.ErrEagain) || errors.Is(err, astiav.ErrEof) {
-				packet.Unref()
-				continue
+			if best != nil {
+				break
 			}
-			return fmt.Errorf("failed receiving frame from decoder: %w", err)
+			return nil, err
 		}
-
-		img, err := frame.Data().GuessImageFormat()
-		if err != nil {
-			return fmt.Errorf("failed guessing image format: %w", err)
-		}
-		err = frame.Data().ToImage(img)
-		if err != nil {
-			return fmt.Errorf("failed converting frame to image: %w", err)
-		}
-		packet.Unref()
-
-		file, err := os.Create(imagePath)
-		if err != nil {
-			return fmt.Errorf("failed creating image file: %w", err)
+		variance := lumaVariance(img)
+		zap.S().Debugf("thumbnail sample %d luma variance: %.2f", i, variance)
+		if variance > bestVariance {
+			best, bestVariance = img, variance
 		}
-		defer file.Close()
+	}
+	if best == nil {
+		return nil, errors.New("no video frame found")
+	}
+	return best, nil
+}
 
-		err = jpeg.Encode(file, img, nil)
-		if err != nil {
-			return fmt.Errorf("failed encoding image: %w", err)
+// variance of the luma of the image, on a grid of
+// sample points. flat and black frames score near zero
+func lumaVariance(img image.Image) float64 {
+	bounds := img.Bounds()
+	stepX := max(bounds.Dx()/lumaSampleGrid, 1)
+	stepY := max(bounds.Dy()/lumaSampleGrid, 1)
+	ycbcr, isYCbCr := img.(*image.YCbCr)
+
+	var sum, sumSquares float64
+	var count int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += stepY {
+		for x := bounds.Min.X; x < bounds.Max.X; x += stepX {
+			var luma float64
+			if isYCbCr {
+				luma = float64(ycbcr.Y[ycbcr.YOffset(x, y)])
+			} else {
+				luma = float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+			}
+			sum += luma
+			sumSquares += luma * luma
+			count++
 		}
-
-		return nil
 	}
-
-	return errors.New("timeout while waiting for video frame")
+	if count == 0 {
+		return 0
+	}
+	mean := sum / float64(count)
+	return sumSquares/float64(count) - mean*mean
 }
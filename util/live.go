@@ -0,0 +1,210 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/govdbot/govd/config"
+	"github.com/govdbot/govd/models"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// segments kept from the live edge when the recording starts,
+	// as recommended by the hls spec for sliding window playlists
+	liveEdgeSegments = 3
+	// time left to the task deadline for merging and sending
+	liveDeadlineMargin = 2 * time.Minute
+)
+
+// keeps track of the segments recorded from a live playlist
+type liveRecording struct {
+	initSegment *models.Segment
+	currentInit *models.Segment
+	segments    []*models.Segment
+	files       []string
+	seen        map[string]bool
+	duration    time.Duration
+	maxDuration time.Duration
+}
+
+// RecordLiveStream records a live hls stream by polling its playlist
+// and downloading new segments, until the stream ends or the maximum
+// duration is reached. recorded segments are merged into a single file
+func RecordLiveStream(
+	ctx context.Context,
+	fetchPlaylist models.LivePlaylistFunc,
+	fileName string,
+	downloadConfig *models.DownloadConfig,
+) (string, error) {
+	if err := EnsureDownloadDir(); err != nil {
+		return "", err
+	}
+	maxDuration := config.Env().MaxDuration
+	if downloadConfig.MaxDuration > 0 && downloadConfig.MaxDuration < maxDuration {
+		maxDuration = downloadConfig.MaxDuration
+	}
+	zap.S().Debugf("recording live stream for up to %s: %s", maxDuration, fileName)
+
+	tempDir := filepath.Join(
+		config.Env().DownloadsDirectory,
+		"live"+uuid.NewString(),
+	)
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	recording := &liveRecording{
+		seen:        make(map[string]bool),
+		maxDuration: maxDuration,
+	}
+	var failures int
+	for {
+		playlist, err := fetchPlaylist(ctx)
+		if err != nil {
+			failures++
+			if failures > downloadConfig.RetryAttempts {
+				if len(recording.files) == 0 {
+					return "", err
+				}
+				// keep what has been recorded so far
+				zap.S().Warnf("stopping live recording: %v", err)
+				break
+			}
+			if !waitLivePoll(ctx, downloadConfig.RetryDelay) {
+				break
+			}
+			continue
+		}
+		failures = 0
+
+		segments, full := recording.collect(playlist)
+		if len(segments) > 0 {
+			files, err := downloadSegments(
+				ctx, tempDir, len(recording.files),
+				segments, downloadConfig,
+			)
+			if err != nil {
+				return "", fmt.Errorf("failed to download live segments: %w", err)
+			}
+			err = decryptSegmentFiles(
+				files, segments,
+				len(recording.files),
+				downloadConfig.DecryptionKey,
+			)
+			if err != nil {
+				return "", fmt.Errorf("failed to decrypt live segments: %w", err)
+			}
+			recording.segments = append(recording.segments, segments...)
+			recording.files = append(recording.files, files...)
+			zap.S().Debugf(
+				"recorded %d live segments (%s)",
+				len(recording.files),
+				recording.duration,
+			)
+		}
+		if full || playlist.Ended {
+			break
+		}
+
+		// the playlist is reloaded every target duration,
+		// or half of it when no new segments were found
+		interval := playlist.TargetDuration
+		if interval <= 0 {
+			interval = 2 * time.Second
+		}
+		if len(segments) == 0 {
+			interval /= 2
+		}
+		if !waitLivePoll(ctx, interval) {
+			break
+		}
+	}
+
+	if len(recording.files) == 0 {
+		return "", errors.New("no live segments recorded")
+	}
+	outputPath := filepath.Join(config.Env().DownloadsDirectory, fileName)
+	return mergeSegmentFiles(
+		ctx, tempDir,
+		recording.initSegment,
+		recording.segments,
+		recording.files,
+		outputPath, downloadConfig,
+	)
+}
+
+// returns the new segments of a playlist snapshot that fit in
+// the recording, and whether the maximum duration was reached
+func (recording *liveRecording) collect(playlist *models.LivePlaylist) ([]*models.Segment, bool) {
+	snapshot := playlist.Segments
+	if len(recording.seen) == 0 && !playlist.IsEvent && !playlist.Ended {
+		// start near the live edge, while event
+		// playlists (dvr) are recorded from the start
+		skipped := max(len(snapshot)-liveEdgeSegments, 0)
+		for _, segment := range snapshot[:skipped] {
+			recording.seen[segment.URL+segment.GetRange()] = true
+			if segment.Init != nil {
+				playlist.InitSegment = segment.Init
+			}
+		}
+		snapshot = snapshot[skipped:]
+	}
+
+	var segments []*models.Segment
+	effectiveInit := playlist.InitSegment
+	for _, segment := range snapshot {
+		if segment.Init != nil {
+			effectiveInit = segment.Init
+		}
+		key := segment.URL + segment.GetRange()
+		if recording.seen[key] {
+			continue
+		}
+		duration := time.Duration(segment.Duration * float64(time.Second))
+		if recording.duration+duration > recording.maxDuration {
+			return segments, true
+		}
+		recording.seen[key] = true
+		recording.duration += duration
+
+		if len(recording.segments)+len(segments) == 0 {
+			recording.initSegment = effectiveInit
+			recording.currentInit = effectiveInit
+			// the recording starts a new timeline
+			segment.Discontinuity = false
+			segment.Init = nil
+		} else if !effectiveInit.Equals(recording.currentInit) {
+			// the init segment changed between two snapshots
+			recording.currentInit = effectiveInit
+			segment.Init = effectiveInit
+			segment.Discontinuity = true
+		}
+		segments = append(segments, segment)
+	}
+	return segments, false
+}
+
+// waits for the next playlist reload. returns false when
+// the task is about to time out, so that the recorded
+// segments can still be merged and sent
+func waitLivePoll(ctx context.Context, interval time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok &&
+		time.Until(deadline) < interval+liveDeadlineMargin {
+		zap.S().Debug("stopping live recording before the task deadline")
+		return false
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(interval):
+		return true
+	}
+}
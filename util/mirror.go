@@ -0,0 +1,329 @@
+package util
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/govdbot/govd/models"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// how long host health stats are remembered
+	mirrorHealthTTL = 15 * time.Minute
+	// maximum time spent probing a single mirror
+	mirrorProbeTimeout = 5 * time.Second
+	// time before throughput checks kick in for a response
+	throughputGracePeriod = 5 * time.Second
+	// throughput is measured over the last seconds of a response
+	throughputWindow         = 3 * time.Second
+	throughputSampleInterval = 250 * time.Millisecond
+)
+
+var errMirrorTooSlow = errors.New("mirror throughput collapsed")
+
+type mirror struct {
+	URL     string
+	Size    int
+	Latency time.Duration
+	Err     error
+	Score   float64 // health score of the host when ranked
+}
+
+// weights response time by host health, so a fast
+// but unreliable host doesn't always win
+func (m *mirror) cost() float64 {
+	return m.Latency.Seconds() / max(m.Score, 0.1)
+}
+
+type hostHealth struct {
+	Successes  int
+	Failures   int
+	Latency    time.Duration // moving average of probe latency
+	Throughput float64       // moving average in bytes per second
+	UpdatedAt  time.Time
+}
+
+var (
+	// health stats per CDN host, shared by all downloads
+	hostHealthMap   = make(map[string]*hostHealth)
+	hostHealthMutex sync.Mutex
+)
+
+// returns the health score of a host, from 0 (bad) to 1 (good).
+// unknown hosts get a neutral score
+func (health *hostHealth) score() float64 {
+	total := health.Successes + health.Failures
+	if total == 0 {
+		return 0.5
+	}
+	return float64(health.Successes) / float64(total)
+}
+
+func mirrorHost(fileURL string) string {
+	parsedURL, err := url.Parse(fileURL)
+	if err != nil {
+		return fileURL
+	}
+	return parsedURL.Hostname()
+}
+
+// returns the health entry for a host, resetting it
+// when stats are older than mirrorHealthTTL.
+// must be called with hostHealthMutex held
+func getHostHealth(host string) *hostHealth {
+	health, ok := hostHealthMap[host]
+	if !ok || time.Since(health.UpdatedAt) > mirrorHealthTTL {
+		health = &hostHealth{}
+		hostHealthMap[host] = health
+	}
+	health.UpdatedAt = time.Now()
+	return health
+}
+
+func hostScore(fileURL string) float64 {
+	hostHealthMutex.Lock()
+	defer hostHealthMutex.Unlock()
+
+	health, ok := hostHealthMap[mirrorHost(fileURL)]
+	if !ok || time.Since(health.UpdatedAt) > mirrorHealthTTL {
+		return 0.5
+	}
+	return health.score()
+}
+
+func recordMirrorSuccess(fileURL string, latency time.Duration, throughput float64) {
+	hostHealthMutex.Lock()
+	defer hostHealthMutex.Unlock()
+
+	health := getHostHealth(mirrorHost(fileURL))
+	health.Successes++
+	if latency > 0 {
+		if health.Latency == 0 {
+			health.Latency = latency
+		} else {
+			health.Latency = (health.Latency*3 + latency) / 4
+		}
+	}
+	if throughput > 0 {
+		if health.Throughput == 0 {
+			health.Throughput = throughput
+		} else {
+			health.Throughput = (health.Throughput*3 + throughput) / 4
+		}
+	}
+}
+
+func recordMirrorFailure(fileURL string) {
+	hostHealthMutex.Lock()
+	defer hostHealthMutex.Unlock()
+
+	health := getHostHealth(mirrorHost(fileURL))
+	health.Failures++
+}
+
+// probes all the urls in parallel and sorts them by
+// probe result, host health and response time.
+// a single url is returned as is, without probing
+func rankMirrors(
+	ctx context.Context,
+	urlList []string,
+	downloadConfig *models.DownloadConfig,
+) []*mirror {
+	mirrors := make([]*mirror, len(urlList))
+	if len(urlList) == 1 {
+		mirrors[0] = &mirror{URL: urlList[0]}
+		return mirrors
+	}
+
+	var wg sync.WaitGroup
+	for i, fileURL := range urlList {
+		wg.Add(1)
+		go func(idx int, fileURL string) {
+			defer wg.Done()
+			mirrors[idx] = probeMirror(ctx, fileURL, downloadConfig)
+		}(i, fileURL)
+	}
+	wg.Wait()
+
+	// scores are read once, not on every comparison
+	for _, m := range mirrors {
+		m.Score = hostScore(m.URL)
+	}
+	slices.SortStableFunc(mirrors, func(a, b *mirror) int {
+		if (a.Err == nil) != (b.Err == nil) {
+			if a.Err == nil {
+				return -1
+			}
+			return 1
+		}
+		costA, costB := a.cost(), b.cost()
+		switch {
+		case costA < costB:
+			return -1
+		case costA > costB:
+			return 1
+		}
+		return 0
+	})
+
+	for i, m := range mirrors {
+		zap.S().Debugf(
+			"mirror %d: %s (latency: %s, score: %.2f, err: %v)",
+			i, mirrorHost(m.URL), m.Latency, m.Score, m.Err,
+		)
+	}
+	return mirrors
+}
+
+func probeMirror(
+	ctx context.Context,
+	fileURL string,
+	downloadConfig *models.DownloadConfig,
+) *mirror {
+	probeConfig := *downloadConfig
+	probeConfig.Timeout = min(downloadConfig.Timeout, mirrorProbeTimeout)
+
+	start := time.Now()
+	size, err := getFileSize(ctx, fileURL, &probeConfig)
+	latency := time.Since(start)
+	if err != nil {
+		recordMirrorFailure(fileURL)
+	} else {
+		recordMirrorSuccess(fileURL, latency, 0)
+	}
+	return &mirror{
+		URL:     fileURL,
+		Size:    size,
+		Latency: latency,
+		Err:     err,
+	}
+}
+
+// mirrorSelector hands out the mirror a chunk should be
+// downloaded from, moving to the next one when it fails.
+// only mirrors serving a file of the same size as the
+// primary one are used as fallbacks
+type mirrorSelector struct {
+	mirrors []*mirror
+	current int
+	mu      sync.Mutex
+}
+
+func newMirrorSelector(mirrors []*mirror) *mirrorSelector {
+	primary := mirrors[0]
+	selected := []*mirror{primary}
+	if primary.Size > 0 {
+		for _, m := range mirrors[1:] {
+			if m.Err == nil && m.Size == primary.Size {
+				selected = append(selected, m)
+			}
+		}
+	}
+	return &mirrorSelector{mirrors: selected}
+}
+
+func (selector *mirrorSelector) URL() string {
+	selector.mu.Lock()
+	defer selector.mu.Unlock()
+	return selector.mirrors[selector.current].URL
+}
+
+func (selector *mirrorSelector) Size() int {
+	return selector.mirrors[0].Size
+}
+
+func (selector *mirrorSelector) HasFallback() bool {
+	selector.mu.Lock()
+	defer selector.mu.Unlock()
+	return selector.current < len(selector.mirrors)-1
+}
+
+// moves to the next mirror if failedURL is still the current one.
+// other chunks failing on the same mirror won't skip more mirrors
+func (selector *mirrorSelector) Fallback(failedURL string) {
+	selector.mu.Lock()
+	defer selector.mu.Unlock()
+	if selector.mirrors[selector.current].URL != failedURL {
+		return
+	}
+	if selector.current < len(selector.mirrors)-1 {
+		selector.current++
+		zap.S().Debugf(
+			"switching to mirror %s",
+			mirrorHost(selector.mirrors[selector.current].URL),
+		)
+	}
+}
+
+// throughputReader fails with errMirrorTooSlow when the read
+// speed over the last throughputWindow drops below minRate,
+// after the grace period. a fast start doesn't hide a mirror
+// that collapses later on
+type throughputReader struct {
+	reader  io.Reader
+	minRate int
+	start   time.Time
+	read    int64
+	// read progress over time, the first sample is
+	// the oldest one within the window or just before
+	samples []throughputSample
+}
+
+type throughputSample struct {
+	at   time.Time
+	read int64
+}
+
+func (r *throughputReader) Read(p []byte) (int, error) {
+	if r.start.IsZero() {
+		r.start = time.Now()
+		r.samples = append(r.samples, throughputSample{at: r.start})
+	}
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	if err == nil && r.minRate > 0 {
+		now := time.Now()
+		r.addSample(now)
+		if now.Sub(r.start) > throughputGracePeriod && r.windowRate(now) < float64(r.minRate) {
+			return n, errMirrorTooSlow
+		}
+	}
+	return n, err
+}
+
+func (r *throughputReader) addSample(now time.Time) {
+	last := r.samples[len(r.samples)-1]
+	if now.Sub(last.at) >= throughputSampleInterval {
+		r.samples = append(r.samples, throughputSample{at: now, read: r.read})
+	}
+	for len(r.samples) > 1 && now.Sub(r.samples[1].at) >= throughputWindow {
+		r.samples = r.samples[1:]
+	}
+}
+
+// returns the read speed in bytes per second since the
+// oldest sample, which covers about the last window
+func (r *throughputReader) windowRate(now time.Time) float64 {
+	oldest := r.samples[0]
+	elapsed := now.Sub(oldest.at).Seconds()
+	if elapsed == 0 {
+		return 0
+	}
+	return float64(r.read-oldest.read) / elapsed
+}
+
+// returns the average read speed in bytes per second
+func (r *throughputReader) Rate() float64 {
+	elapsed := time.Since(r.start).Seconds()
+	if r.start.IsZero() || elapsed == 0 {
+		return 0
+	}
+	return float64(r.read) / elapsed
+}
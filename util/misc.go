@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/govdbot/govd/config"
@@ -26,14 +27,42 @@ import (
 	"github.com/aki237/nscjar"
 )
 
-var cookiesCache = make(map[string][]*http.Cookie)
+var (
+	cookiesCache   = make(map[string][]*http.Cookie)
+	cookiesCacheMu sync.RWMutex
+)
+
+func init() {
+	// cookie files are parsed again once changed
+	config.OnReload(func() {
+		cookiesCacheMu.Lock()
+		defer cookiesCacheMu.Unlock()
+		clear(cookiesCache)
+	})
+}
 
-func ExceedsMaxFileSize(fileSize int64) bool {
-	return fileSize > config.Env.MaxFileSize
+// ExceedsMaxFileSize checks the size against the instance
+// limit, or the one of the download config when lower
+func ExceedsMaxFileSize(fileSize int64, downloadConfig *models.DownloadConfig) bool {
+	return fileSize > getMaxFileSize(downloadConfig)
+}
+
+func getMaxFileSize(downloadConfig *models.DownloadConfig) int64 {
+	maxFileSize := config.Env().MaxFileSize
+	if downloadConfig != nil && downloadConfig.MaxFileSize > 0 {
+		maxFileSize = min(maxFileSize, downloadConfig.MaxFileSize)
+	}
+	return maxFileSize
 }
 
-func ExceedsMaxDuration(duration int64) bool {
-	return duration > int64(config.Env.MaxDuration.Seconds())
+// ExceedsMaxDuration checks the duration, in seconds, against the
+// instance limit, or the one of the download config when lower
+func ExceedsMaxDuration(duration int64, downloadConfig *models.DownloadConfig) bool {
+	maxDuration := config.Env().MaxDuration
+	if downloadConfig != nil && downloadConfig.MaxDuration > 0 {
+		maxDuration = min(maxDuration, downloadConfig.MaxDuration)
+	}
+	return duration > int64(maxDuration.Seconds())
 }
 
 func FetchPage(
@@ -212,11 +241,13 @@ func GetExtractorCookies(extractor *models.Extractor) []*http.Cookie {
 }
 
 func ParseCookieFile(fileName string) ([]*http.Cookie, error) {
+	cookiesCacheMu.RLock()
 	cachedCookies, ok := cookiesCache[fileName]
+	cookiesCacheMu.RUnlock()
 	if ok {
 		return cachedCookies, nil
 	}
-	cookiePath := filepath.Join("cookies", fileName)
+	cookiePath := filepath.Join(config.CookiesDirectory, fileName)
 	cookieFile, err := os.Open(cookiePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open cookie file: %w", err)
@@ -228,7 +259,9 @@ func ParseCookieFile(fileName string) ([]*http.Cookie, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse cookie file: %w", err)
 	}
+	cookiesCacheMu.Lock()
 	cookiesCache[fileName] = cookies
+	cookiesCacheMu.Unlock()
 	return cookies, nil
 }
 
@@ -237,7 +270,7 @@ func FixURL(url string) string {
 }
 
 func CleanupDownloadsDir() {
-	dir := config.Env.DownloadsDirectory
+	dir := config.Env().DownloadsDirectory
 	zap.S().Debug("cleaning up downloads directory")
 
 	CleanupOpenFiles()
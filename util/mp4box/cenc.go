@@ -0,0 +1,392 @@
+package mp4box
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/abema/go-mp4"
+	"github.com/pkg/errors"
+)
+
+const (
+	schemeCENC = "cenc"
+	schemeCBCS = "cbcs"
+
+	sencUseSubsamples = 0x000002
+	trunDataOffset    = 0x000001
+	trunSampleSize    = 0x000200
+)
+
+var boxTypeSenc = mp4.StrToBoxType("senc")
+
+// encryption parameters of a track, from its init segment
+type cencTrack struct {
+	id              uint32
+	scheme          string
+	kid             [16]byte
+	perSampleIVSize int
+	constantIV      []byte
+	cryptByteBlock  int
+	skipByteBlock   int
+}
+
+// a track fragment (traf) with its sample encryption data
+type cencFragment struct {
+	moofOffset uint64
+	tfhd       *mp4.Tfhd
+	truns      []*mp4.Trun
+	senc       []byte
+}
+
+// boxes are only renamed, never resized,
+// so every offset in the file stays valid
+type cencPatch struct {
+	offset  int64
+	boxType [4]byte
+}
+
+type cencFile struct {
+	tracks      map[uint32]*cencTrack
+	sampleSizes map[uint32]uint32
+	fragments   []*cencFragment
+	patches     []cencPatch
+
+	track       *cencTrack
+	entryOffset uint64
+	moofOffset  uint64
+	fragment    *cencFragment
+}
+
+// DecryptCENC decrypts a fragmented mp4 file protected with
+// common encryption (cenc or cbcs schemes) in place, given
+// the clear key. when kid is set, it must match the key id
+// of every encrypted track.
+// sample entries are restored to their original format and
+// the encryption boxes are turned into free boxes
+func DecryptCENC(filePath string, key []byte, kid []byte) error {
+	if len(key) != 16 {
+		return fmt.Errorf("invalid key: expected 16 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	file, err := os.OpenFile(filePath, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	cenc := &cencFile{
+		tracks:      make(map[uint32]*cencTrack),
+		sampleSizes: make(map[uint32]uint32),
+	}
+	if _, err := mp4.ReadBoxStructure(file, cenc.handle); err != nil {
+		return fmt.Errorf("failed to read boxes: %w", err)
+	}
+	if len(cenc.tracks) == 0 {
+		return errors.New("no encrypted tracks found")
+	}
+	for _, track := range cenc.tracks {
+		if len(kid) > 0 && !bytes.Equal(track.kid[:], kid) {
+			return fmt.Errorf("no key for key id %x", track.kid)
+		}
+	}
+
+	for _, fragment := range cenc.fragments {
+		if err := cenc.decryptFragment(file, block, fragment); err != nil {
+			return err
+		}
+	}
+	for _, patch := range cenc.patches {
+		if _, err := file.WriteAt(patch.boxType[:], patch.offset); err != nil {
+			return fmt.Errorf("failed to patch box: %w", err)
+		}
+	}
+	return nil
+}
+
+func (cenc *cencFile) handle(h *mp4.ReadHandle) (interface{}, error) {
+	info := h.BoxInfo
+	switch info.Type {
+	case mp4.BoxTypeMoov(), mp4.BoxTypeMdia(), mp4.BoxTypeMinf(),
+		mp4.BoxTypeStbl(), mp4.BoxTypeStsd(), mp4.BoxTypeMvex(),
+		mp4.BoxTypeSchi():
+		return h.Expand()
+	case mp4.BoxTypeTrak():
+		cenc.track = &cencTrack{}
+		if _, err := h.Expand(); err != nil {
+			return nil, err
+		}
+		if cenc.track.scheme != "" {
+			cenc.tracks[cenc.track.id] = cenc.track
+		}
+		cenc.track = nil
+		return nil, nil
+	case mp4.BoxTypeEncv(), mp4.BoxTypeEnca():
+		cenc.entryOffset = info.Offset
+		return h.Expand()
+	case mp4.BoxTypeSinf():
+		cenc.rename(info, "free")
+		return h.Expand()
+	case mp4.BoxTypeMoof():
+		cenc.moofOffset = info.Offset
+		return h.Expand()
+	case mp4.BoxTypeTraf():
+		cenc.fragment = &cencFragment{moofOffset: cenc.moofOffset}
+		if _, err := h.Expand(); err != nil {
+			return nil, err
+		}
+		cenc.fragments = append(cenc.fragments, cenc.fragment)
+		cenc.fragment = nil
+		return nil, nil
+	case mp4.BoxTypeSaiz(), mp4.BoxTypeSaio(), mp4.BoxTypePssh():
+		cenc.rename(info, "free")
+		return nil, nil
+	case boxTypeSenc:
+		if cenc.fragment == nil {
+			return nil, nil
+		}
+		var buf bytes.Buffer
+		if _, err := h.ReadData(&buf); err != nil {
+			return nil, err
+		}
+		cenc.fragment.senc = buf.Bytes()
+		cenc.rename(info, "free")
+		return nil, nil
+	}
+
+	if !info.IsSupportedType() {
+		return nil, nil
+	}
+	switch info.Type {
+	case mp4.BoxTypeTkhd(), mp4.BoxTypeFrma(), mp4.BoxTypeSchm(),
+		mp4.BoxTypeTenc(), mp4.BoxTypeTrex(), mp4.BoxTypeTfhd(),
+		mp4.BoxTypeTrun():
+	default:
+		return nil, nil
+	}
+	box, _, err := h.ReadPayload()
+	if err != nil {
+		return nil, err
+	}
+	switch box := box.(type) {
+	case *mp4.Tkhd:
+		if cenc.track != nil {
+			cenc.track.id = box.TrackID
+		}
+	case *mp4.Frma:
+		// restore the original sample entry type
+		cenc.patches = append(cenc.patches, cencPatch{
+			offset:  int64(cenc.entryOffset) + 4,
+			boxType: box.DataFormat,
+		})
+	case *mp4.Schm:
+		if cenc.track != nil {
+			cenc.track.scheme = string(box.SchemeType[:])
+		}
+	case *mp4.Tenc:
+		if cenc.track != nil {
+			cenc.track.kid = box.DefaultKID
+			cenc.track.perSampleIVSize = int(box.DefaultPerSampleIVSize)
+			cenc.track.constantIV = box.DefaultConstantIV
+			cenc.track.cryptByteBlock = int(box.DefaultCryptByteBlock)
+			cenc.track.skipByteBlock = int(box.DefaultSkipByteBlock)
+		}
+	case *mp4.Trex:
+		cenc.sampleSizes[box.TrackID] = box.DefaultSampleSize
+	case *mp4.Tfhd:
+		if cenc.fragment != nil {
+			cenc.fragment.tfhd = box
+		}
+	case *mp4.Trun:
+		if cenc.fragment != nil {
+			cenc.fragment.truns = append(cenc.fragment.truns, box)
+		}
+	}
+	return nil, nil
+}
+
+func (cenc *cencFile) rename(info mp4.BoxInfo, boxType string) {
+	patch := cencPatch{offset: int64(info.Offset) + 4}
+	copy(patch.boxType[:], boxType)
+	cenc.patches = append(cenc.patches, patch)
+}
+
+func (cenc *cencFile) decryptFragment(
+	file *os.File,
+	block cipher.Block,
+	fragment *cencFragment,
+) error {
+	if fragment.tfhd == nil || fragment.senc == nil {
+		return nil
+	}
+	track := cenc.tracks[fragment.tfhd.TrackID]
+	if track == nil {
+		return nil
+	}
+	if track.scheme != schemeCENC && track.scheme != schemeCBCS {
+		return fmt.Errorf("unsupported encryption scheme: %s", track.scheme)
+	}
+	samples, err := parseSenc(fragment.senc, track)
+	if err != nil {
+		return err
+	}
+
+	tfhd := fragment.tfhd
+	base := fragment.moofOffset
+	if tfhd.CheckFlag(mp4.TfhdBaseDataOffsetPresent) {
+		base = tfhd.BaseDataOffset
+	}
+	defaultSize := cenc.sampleSizes[tfhd.TrackID]
+	if tfhd.CheckFlag(mp4.TfhdDefaultSampleSizePresent) {
+		defaultSize = tfhd.DefaultSampleSize
+	}
+
+	var idx int
+	offset := base
+	for _, trun := range fragment.truns {
+		if trun.CheckFlag(trunDataOffset) {
+			offset = uint64(int64(base) + int64(trun.DataOffset))
+		}
+		for i := range int(trun.SampleCount) {
+			size := defaultSize
+			if trun.CheckFlag(trunSampleSize) {
+				size = trun.Entries[i].SampleSize
+			}
+			if idx >= len(samples) {
+				return errors.New("missing sample encryption data")
+			}
+			if err := decryptSample(file, block, track, samples[idx], int64(offset), int(size)); err != nil {
+				return fmt.Errorf("failed to decrypt sample %d: %w", idx, err)
+			}
+			offset += uint64(size)
+			idx++
+		}
+	}
+	return nil
+}
+
+type cencSubsample struct {
+	clear     int
+	protected int
+}
+
+type cencSample struct {
+	iv         []byte
+	subsamples []cencSubsample
+}
+
+// parses the sample encryption box payload
+func parseSenc(data []byte, track *cencTrack) ([]cencSample, error) {
+	if len(data) < 8 {
+		return nil, errors.New("truncated senc box")
+	}
+	flags := binary.BigEndian.Uint32(data) & 0x00ffffff
+	count := int(binary.BigEndian.Uint32(data[4:]))
+	pos := 8
+
+	samples := make([]cencSample, 0, count)
+	for range count {
+		sample := cencSample{iv: track.constantIV}
+		if track.perSampleIVSize > 0 {
+			if len(data) < pos+track.perSampleIVSize {
+				return nil, errors.New("truncated senc box")
+			}
+			sample.iv = data[pos : pos+track.perSampleIVSize]
+			pos += track.perSampleIVSize
+		}
+		if flags&sencUseSubsamples != 0 {
+			if len(data) < pos+2 {
+				return nil, errors.New("truncated senc box")
+			}
+			subsampleCount := int(binary.BigEndian.Uint16(data[pos:]))
+			pos += 2
+			if len(data) < pos+subsampleCount*6 {
+				return nil, errors.New("truncated senc box")
+			}
+			for range subsampleCount {
+				sample.subsamples = append(sample.subsamples, cencSubsample{
+					clear:     int(binary.BigEndian.Uint16(data[pos:])),
+					protected: int(binary.BigEndian.Uint32(data[pos+2:])),
+				})
+				pos += 6
+			}
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+func decryptSample(
+	file *os.File,
+	block cipher.Block,
+	track *cencTrack,
+	sample cencSample,
+	offset int64,
+	size int,
+) error {
+	if size == 0 {
+		return nil
+	}
+	data := make([]byte, size)
+	if _, err := file.ReadAt(data, offset); err != nil {
+		return err
+	}
+
+	// 8-byte IVs are padded to the block size
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, sample.iv)
+
+	subsamples := sample.subsamples
+	if len(subsamples) == 0 {
+		subsamples = []cencSubsample{{protected: size}}
+	}
+
+	var stream cipher.Stream
+	if track.scheme == schemeCENC {
+		// the counter runs across all the protected ranges
+		stream = cipher.NewCTR(block, iv)
+	}
+	pos := 0
+	for _, subsample := range subsamples {
+		pos += subsample.clear
+		end := pos + subsample.protected
+		if end > size {
+			return errors.New("subsamples exceed sample size")
+		}
+		protected := data[pos:end]
+		if stream != nil {
+			stream.XORKeyStream(protected, protected)
+		} else {
+			decryptPattern(block, iv, protected, track.cryptByteBlock, track.skipByteBlock)
+		}
+		pos = end
+	}
+
+	_, err := file.WriteAt(data, offset)
+	return err
+}
+
+// decrypts a cbcs protected range in place. the cbc chain starts
+// from the IV in every range and runs over encrypted blocks only,
+// skipping the clear blocks of the pattern. the trailing partial
+// block is always clear
+func decryptPattern(block cipher.Block, iv []byte, data []byte, crypt int, skip int) {
+	mode := cipher.NewCBCDecrypter(block, iv)
+	fullBlocks := len(data) / aes.BlockSize * aes.BlockSize
+	if crypt == 0 && skip == 0 {
+		// no pattern, every block is encrypted
+		mode.CryptBlocks(data[:fullBlocks], data[:fullBlocks])
+		return
+	}
+	for pos := 0; pos < fullBlocks; pos += (crypt + skip) * aes.BlockSize {
+		end := min(pos+crypt*aes.BlockSize, fullBlocks)
+		mode.CryptBlocks(data[pos:end], data[pos:end])
+	}
+}
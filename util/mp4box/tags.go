@@ -0,0 +1,349 @@
+package mp4box
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+
+	"github.com/govdbot/govd/models"
+
+	"github.com/abema/go-mp4"
+	"github.com/pkg/errors"
+	"github.com/sunfish-shogi/bufseekio"
+)
+
+// go-mp4 has no constant for png cover art
+const dataTypePNG = 13
+
+var (
+	boxTypeTitle    = mp4.BoxType{0xa9, 'n', 'a', 'm'}
+	boxTypeArtist   = mp4.BoxType{0xa9, 'A', 'R', 'T'}
+	boxTypeComment  = mp4.BoxType{0xa9, 'c', 'm', 't'}
+	boxTypeCover    = mp4.StrToBoxType("covr")
+	boxTypeFreeform = mp4.StrToBoxType("----")
+	boxTypeMean     = mp4.StrToBoxType("mean")
+	boxTypeName     = mp4.StrToBoxType("name")
+
+	pngHeader = []byte{0x89, 0x50, 0x4E, 0x47}
+
+	// boxes rebuilt while rewriting the file,
+	// as they contain the ones to update
+	tagsContainerTypes = []mp4.BoxType{
+		mp4.BoxTypeMoov(),
+		mp4.BoxTypeTrak(),
+		mp4.BoxTypeMdia(),
+		mp4.BoxTypeMinf(),
+		mp4.BoxTypeStbl(),
+		mp4.BoxTypeMoof(),
+		mp4.BoxTypeTraf(),
+	}
+)
+
+// layout of the movie box of the original file
+type moovLayout struct {
+	found    bool
+	end      uint64
+	hasUdta  bool
+	metaSize uint64
+}
+
+type tagsRewriter struct {
+	reader io.ReadSeeker
+	writer *mp4.Writer
+	meta   []byte
+	layout *moovLayout
+	// size difference of the movie box, applied to
+	// every absolute offset pointing past its end
+	delta int64
+}
+
+// WriteTags writes itunes-style metadata (an ilst atom under
+// moov/udta/meta) into an mp4 or m4a file, replacing the existing
+// one. the file is rewritten, shifting chunk and fragment offsets
+// when the movie box is placed before the media data
+func WriteTags(filePath string, tags *models.MediaTags) error {
+	meta, err := marshalTagsMeta(tags)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tags: %w", err)
+	}
+
+	input, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer input.Close()
+	reader := bufseekio.NewReadSeeker(input, 128*1024, 4)
+
+	layout, err := scanMoov(reader)
+	if err != nil {
+		return err
+	}
+	delta := int64(len(meta)) - int64(layout.metaSize)
+	if !layout.hasUdta {
+		delta += mp4.SmallHeaderSize
+	}
+
+	tempPath := filePath + ".temp"
+	output, err := os.Create(tempPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tempPath)
+
+	rewriter := &tagsRewriter{
+		reader: reader,
+		writer: mp4.NewWriter(output),
+		meta:   meta,
+		layout: layout,
+		delta:  delta,
+	}
+	_, err = mp4.ReadBoxStructure(reader, rewriter.handle)
+	output.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write tags: %w", err)
+	}
+
+	if err := os.Rename(tempPath, filePath); err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+	return nil
+}
+
+func scanMoov(r io.ReadSeeker) (*moovLayout, error) {
+	layout := &moovLayout{}
+	_, err := mp4.ReadBoxStructure(r, func(h *mp4.ReadHandle) (any, error) {
+		switch {
+		case len(h.Path) == 1 && h.BoxInfo.Type == mp4.BoxTypeMoov():
+			layout.found = true
+			layout.end = h.BoxInfo.Offset + h.BoxInfo.Size
+			return h.Expand()
+		case isMoovUdta(h.Path):
+			layout.hasUdta = true
+			return h.Expand()
+		case isMoovUdtaMeta(h.Path):
+			layout.metaSize += h.BoxInfo.Size
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read boxes: %w", err)
+	}
+	if !layout.found {
+		return nil, errors.New("movie box not found")
+	}
+	return layout, nil
+}
+
+func (rewriter *tagsRewriter) handle(h *mp4.ReadHandle) (any, error) {
+	boxType := h.BoxInfo.Type
+	switch {
+	case isMoovUdtaMeta(h.Path):
+		// replaced by the new tags
+		return nil, nil
+	case isMoovUdta(h.Path):
+		return nil, rewriter.expand(h, func() error {
+			_, err := rewriter.writer.Write(rewriter.meta)
+			return err
+		})
+	case len(h.Path) == 1 && boxType == mp4.BoxTypeMoov():
+		return nil, rewriter.expand(h, func() error {
+			if rewriter.layout.hasUdta {
+				return nil
+			}
+			return rewriter.writeUdta()
+		})
+	case slices.Contains(tagsContainerTypes, boxType):
+		return nil, rewriter.expand(h, nil)
+	case len(h.Path) == 1 && boxType == mp4.BoxTypeMfra() && rewriter.delta != 0:
+		// the random access index is optional,
+		// drop it rather than fixing its offsets
+		return nil, nil
+	case boxType == mp4.BoxTypeStco(),
+		boxType == mp4.BoxTypeCo64(),
+		boxType == mp4.BoxTypeTfhd():
+		return nil, rewriter.shiftOffsets(h)
+	default:
+		return nil, rewriter.writer.CopyBox(rewriter.reader, &h.BoxInfo)
+	}
+}
+
+// writes a container box, its original children
+// and the ones added by appendChildren
+func (rewriter *tagsRewriter) expand(h *mp4.ReadHandle, appendChildren func() error) error {
+	if _, err := rewriter.writer.StartBox(&h.BoxInfo); err != nil {
+		return err
+	}
+	if _, err := h.Expand(); err != nil {
+		return err
+	}
+	if appendChildren != nil {
+		if err := appendChildren(); err != nil {
+			return err
+		}
+	}
+	_, err := rewriter.writer.EndBox()
+	return err
+}
+
+func (rewriter *tagsRewriter) writeUdta() error {
+	_, err := rewriter.writer.StartBox(&mp4.BoxInfo{
+		Type:       mp4.BoxTypeUdta(),
+		HeaderSize: mp4.SmallHeaderSize,
+		Size:       mp4.SmallHeaderSize,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := rewriter.writer.Write(rewriter.meta); err != nil {
+		return err
+	}
+	_, err = rewriter.writer.EndBox()
+	return err
+}
+
+func (rewriter *tagsRewriter) shiftOffsets(h *mp4.ReadHandle) error {
+	if rewriter.delta == 0 {
+		return rewriter.writer.CopyBox(rewriter.reader, &h.BoxInfo)
+	}
+	box, _, err := h.ReadPayload()
+	if err != nil {
+		return err
+	}
+	switch box := box.(type) {
+	case *mp4.Stco:
+		for idx, offset := range box.ChunkOffset {
+			shifted := rewriter.shift(uint64(offset))
+			if shifted > math.MaxUint32 {
+				return errors.New("chunk offset overflow")
+			}
+			box.ChunkOffset[idx] = uint32(shifted)
+		}
+	case *mp4.Co64:
+		for idx, offset := range box.ChunkOffset {
+			box.ChunkOffset[idx] = rewriter.shift(offset)
+		}
+	case *mp4.Tfhd:
+		if box.CheckFlag(mp4.TfhdBaseDataOffsetPresent) {
+			box.BaseDataOffset = rewriter.shift(box.BaseDataOffset)
+		}
+	}
+	if _, err := rewriter.writer.StartBox(&h.BoxInfo); err != nil {
+		return err
+	}
+	if _, err := mp4.Marshal(rewriter.writer, box, h.BoxInfo.Context); err != nil {
+		return err
+	}
+	_, err = rewriter.writer.EndBox()
+	return err
+}
+
+func (rewriter *tagsRewriter) shift(offset uint64) uint64 {
+	if offset < rewriter.layout.end {
+		return offset
+	}
+	return uint64(int64(offset) + rewriter.delta)
+}
+
+// builds the meta box, with an mdir handler
+// and the item list holding the tags
+func marshalTagsMeta(tags *models.MediaTags) ([]byte, error) {
+	var ilst bytes.Buffer
+	items := []struct {
+		boxType mp4.BoxType
+		value   string
+	}{
+		{boxTypeTitle, tags.Title},
+		{boxTypeArtist, tags.Artist},
+		{boxTypeComment, tags.Comment},
+	}
+	for _, item := range items {
+		if item.value == "" {
+			continue
+		}
+		data, err := marshalData(mp4.DataTypeStringUTF8, []byte(item.value))
+		if err != nil {
+			return nil, err
+		}
+		ilst.Write(newBox(item.boxType, data))
+	}
+	if tags.SourceURL != "" {
+		data, err := marshalData(mp4.DataTypeStringUTF8, []byte(tags.SourceURL))
+		if err != nil {
+			return nil, err
+		}
+		// freeform item, ----:com.apple.iTunes:URL
+		ilst.Write(newBox(
+			boxTypeFreeform,
+			newBox(boxTypeMean, make([]byte, 4), []byte("com.apple.iTunes")),
+			newBox(boxTypeName, make([]byte, 4), []byte("URL")),
+			data,
+		))
+	}
+	if len(tags.Cover) > 0 {
+		dataType := uint32(mp4.DataTypeStringJPEG)
+		if bytes.HasPrefix(tags.Cover, pngHeader) {
+			dataType = dataTypePNG
+		}
+		data, err := marshalData(dataType, tags.Cover)
+		if err != nil {
+			return nil, err
+		}
+		ilst.Write(newBox(boxTypeCover, data))
+	}
+
+	var hdlr bytes.Buffer
+	_, err := mp4.Marshal(&hdlr, &mp4.Hdlr{
+		HandlerType: [4]byte{'m', 'd', 'i', 'r'},
+	}, mp4.Context{})
+	if err != nil {
+		return nil, err
+	}
+	return newBox(
+		mp4.BoxTypeMeta(),
+		make([]byte, 4), // version and flags
+		newBox(mp4.BoxTypeHdlr(), hdlr.Bytes()),
+		newBox(mp4.BoxTypeIlst(), ilst.Bytes()),
+	), nil
+}
+
+func marshalData(dataType uint32, value []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := mp4.Marshal(&buf, &mp4.Data{
+		DataType: dataType,
+		Data:     value,
+	}, mp4.Context{UnderIlstMeta: true})
+	if err != nil {
+		return nil, err
+	}
+	return newBox(mp4.BoxTypeData(), buf.Bytes()), nil
+}
+
+func newBox(boxType mp4.BoxType, payloads ...[]byte) []byte {
+	size := mp4.SmallHeaderSize
+	for _, payload := range payloads {
+		size += len(payload)
+	}
+	box := make([]byte, mp4.SmallHeaderSize, size)
+	binary.BigEndian.PutUint32(box, uint32(size))
+	copy(box[4:], boxType[:])
+	for _, payload := range payloads {
+		box = append(box, payload...)
+	}
+	return box
+}
+
+func isMoovUdta(path mp4.BoxPath) bool {
+	return len(path) == 2 &&
+		path[0] == mp4.BoxTypeMoov() &&
+		path[1] == mp4.BoxTypeUdta()
+}
+
+func isMoovUdtaMeta(path mp4.BoxPath) bool {
+	return len(path) == 3 &&
+		isMoovUdta(path[:2]) &&
+		path[2] == mp4.BoxTypeMeta()
+}
@@ -14,8 +14,18 @@ var (
 	defaultClient     *http.Client
 	defaultClientOnce sync.Once
 	extractorClients  = make(map[string]models.HTTPClient)
+	extractorClientMu sync.Mutex
 )
 
+func init() {
+	// clients are built again with the new extractor configs
+	config.OnReload(func() {
+		extractorClientMu.Lock()
+		defer extractorClientMu.Unlock()
+		clear(extractorClients)
+	})
+}
+
 func GetDefaultHTTPClient() *http.Client {
 	defaultClientOnce.Do(func() {
 		defaultClient = &http.Client{
@@ -46,6 +56,8 @@ func GetBaseTransport() *http.Transport {
 }
 
 func GetExtractorHTTPClient(extractor *models.Extractor) models.HTTPClient {
+	extractorClientMu.Lock()
+	defer extractorClientMu.Unlock()
 	if client, exists := extractorClients[extractor.CodeName]; exists {
 		return client
 	}
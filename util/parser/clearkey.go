@@ -0,0 +1,172 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/pkg/errors"
+)
+
+const (
+	mp4ProtectionScheme = "urn:mpeg:dash:mp4protection:2011"
+	// dash-if and w3c clearkey system ids
+	clearKeySystemID       = "urn:uuid:e2719d58-a985-b3c9-781a-b030af78d30e"
+	commonClearKeySystemID = "urn:uuid:1077efec-c0b2-4d02-ace3-3c1e52e2fb4b"
+)
+
+type clearKeyRequest struct {
+	KIDs []string `json:"kids"`
+	Type string   `json:"type"`
+}
+
+type clearKeyLicense struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		K   string `json:"k"`
+		KID string `json:"kid"`
+	} `json:"keys"`
+}
+
+func isClearKeyScheme(scheme string) bool {
+	return scheme == clearKeySystemID || scheme == commonClearKeySystemID
+}
+
+// parses a key id in uuid form
+func parseKeyID(kid string) ([]byte, error) {
+	keyID, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(kid), "-", ""))
+	if err != nil {
+		return nil, err
+	}
+	if len(keyID) != 16 {
+		return nil, fmt.Errorf("key id must be 16 bytes, got %d", len(keyID))
+	}
+	return keyID, nil
+}
+
+// returns the key for keyID from the clearkey license, fetching
+// each license only once for all the representations using it
+func (manifest *mpdManifest) getClearKey(
+	ctx context.Context,
+	licenseURL string,
+	keyID []byte,
+) ([]byte, error) {
+	cacheKey := licenseURL + "|" + hex.EncodeToString(keyID)
+
+	manifest.clearKeysMutex.Lock()
+	defer manifest.clearKeysMutex.Unlock()
+
+	if key, ok := manifest.clearKeys[cacheKey]; ok {
+		return key, nil
+	}
+	license, err := fetchClearKeyLicense(ctx, licenseURL, keyID, manifest.cookies)
+	if err != nil {
+		return nil, err
+	}
+	key, err := license.getKey(keyID)
+	if err != nil {
+		return nil, err
+	}
+	manifest.clearKeys[cacheKey] = key
+	return key, nil
+}
+
+// fetches a clearkey license, which can also
+// be embedded in the manifest as a data URI
+func fetchClearKeyLicense(
+	ctx context.Context,
+	licenseURL string,
+	keyID []byte,
+	cookies []*http.Cookie,
+) (*clearKeyLicense, error) {
+	var body []byte
+	if strings.HasPrefix(licenseURL, "data:") {
+		data, err := decodeDataURI(licenseURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid license data URI: %w", err)
+		}
+		body = data
+	} else {
+		request := clearKeyRequest{Type: "temporary"}
+		if keyID != nil {
+			request.KIDs = []string{base64.RawURLEncoding.EncodeToString(keyID)}
+		}
+		payload, err := sonic.ConfigFastest.Marshal(request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode license request: %w", err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, licenseURL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		resp, err := getHTTPClient().Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch license: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("license server returned status code: %d", resp.StatusCode)
+		}
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read license: %w", err)
+		}
+	}
+
+	var license clearKeyLicense
+	if err := sonic.ConfigFastest.Unmarshal(body, &license); err != nil {
+		return nil, fmt.Errorf("failed to decode license: %w", err)
+	}
+	return &license, nil
+}
+
+// returns the key matching keyID, or the
+// only key of the license when keyID is unknown
+func (license *clearKeyLicense) getKey(keyID []byte) ([]byte, error) {
+	for _, entry := range license.Keys {
+		if entry.Kty != "" && entry.Kty != "oct" {
+			continue
+		}
+		kid, err := decodeBase64URL(entry.KID)
+		if err != nil {
+			continue
+		}
+		if keyID != nil && !bytes.Equal(kid, keyID) {
+			continue
+		}
+		if keyID == nil && len(license.Keys) > 1 {
+			return nil, errors.New("license has multiple keys but no key id is known")
+		}
+		key, err := decodeBase64URL(entry.K)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key: %w", err)
+		}
+		return key, nil
+	}
+	return nil, errors.New("license has no key for the representation")
+}
+
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+func decodeDataURI(uri string) ([]byte, error) {
+	header, data, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !ok {
+		return nil, errors.New("missing data")
+	}
+	if strings.HasSuffix(header, ";base64") {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	return []byte(data), nil
+}
@@ -91,6 +91,10 @@ func parseMasterPlaylistWithContext(
 	if err != nil {
 		return nil, fmt.Errorf("failed processing variants: %w", err)
 	}
+	subtitles := processSubtitleAlternatives(playlist.Variants, baseURL, cookies)
+	for _, format := range variantFormats {
+		format.Subtitles = subtitles
+	}
 	formats = append(formats, variantFormats...)
 
 	return formats, nil
@@ -112,10 +116,11 @@ func processAlternatives(
 			continue
 		}
 		for _, alt := range variant.Alternatives {
-			if alt == nil || alt.GroupId == "" || seenAlternatives[alt.GroupId] {
+			// a group holds one rendition per language
+			if alt == nil || alt.Type != "AUDIO" || alt.GroupId == "" || seenAlternatives[alt.URI] {
 				continue
 			}
-			seenAlternatives[alt.GroupId] = true
+			seenAlternatives[alt.URI] = true
 
 			if format := parseAlternativeWithContext(ctx, variants, alt, baseURL, cookies, opts); format != nil {
 				formats = append(formats, format)
@@ -316,10 +321,18 @@ func parseMediaPlaylistWithContext(
 	}
 
 	// handle encryption if present
-	if err := handleEncryption(ctx, playlist, baseURL, cookies, format); err != nil {
+	if err := handleEncryption(ctx, playlist, baseURL, cookies, segments); err != nil {
 		return nil, err
 	}
 
+	// without EXT-X-ENDLIST, the playlist is a snapshot
+	// of a live stream, which needs to be recorded
+	if !playlist.Closed {
+		format.IsLive = true
+		format.Duration = 0
+		format.LivePlaylist = newLivePlaylistFunc(baseURL, cookies)
+	}
+
 	return []*models.MediaFormat{format}, nil
 }
 
@@ -339,10 +352,15 @@ func parseAlternativeWithContext(
 	altURL := resolveURL(baseURL, alternative.URI)
 	audioCodec := getAudioAlternativeCodec(variants, alternative)
 
+	formatID := "hls-" + alternative.GroupId
+	if alternative.Language != "" {
+		formatID += "-" + alternative.Language
+	}
 	format := &models.MediaFormat{
-		FormatID:   "hls-" + alternative.GroupId,
+		FormatID:   formatID,
 		Type:       enums.MediaTypeAudio,
 		AudioCodec: audioCodec,
+		Language:   alternative.Language,
 		URL:        []string{altURL},
 	}
 
@@ -383,8 +401,8 @@ func countAlternatives(variants []*m3u8.Variant) int {
 			continue
 		}
 		for _, alt := range variant.Alternatives {
-			if alt != nil && !seen[alt.GroupId] {
-				seen[alt.GroupId] = true
+			if alt != nil && !seen[alt.URI] {
+				seen[alt.URI] = true
 				count++
 			}
 		}
@@ -415,15 +433,16 @@ func parseResolution(resolution string) (int64, int64) {
 	return width, height
 }
 
-func extractSegments(playlist *m3u8.MediaPlaylist, baseURL *url.URL) ([]string, string, float64) {
-	segments := make([]string, 0, len(playlist.Segments))
+func extractSegments(playlist *m3u8.MediaPlaylist, baseURL *url.URL) ([]*models.Segment, *models.Segment, float64) {
+	segments := make([]*models.Segment, 0, len(playlist.Segments))
 	var totalDuration float64
-	var initSegment string
+	var initSegment *models.Segment
 
 	// handle initialization segment separately
 	if playlist.Map != nil && playlist.Map.URI != "" {
-		initSegment = resolveURL(baseURL, playlist.Map.URI)
+		initSegment = newMapSegment(playlist.Map, baseURL)
 	}
+	currentInit := initSegment
 
 	// add only media segments
 	for _, segment := range playlist.Segments {
@@ -431,45 +450,115 @@ func extractSegments(playlist *m3u8.MediaPlaylist, baseURL *url.URL) ([]string,
 			continue
 		}
 
-		segmentURL := resolveURL(baseURL, segment.URI)
-		segments = append(segments, segmentURL)
-		totalDuration += segment.Duration
-
-		// skip byte-range segments (not supported)
+		mediaSegment := &models.Segment{
+			URL: resolveURL(baseURL, segment.URI),
+		}
 		if segment.Limit > 0 {
-			break
+			mediaSegment.Offset = segment.Offset
+			mediaSegment.Length = segment.Limit
+			// the offset is optional: when missing, the sub-range
+			// starts right after the previous one of the same resource
+			if segment.Offset == 0 && len(segments) > 0 {
+				previous := segments[len(segments)-1]
+				if previous.URL == mediaSegment.URL && previous.HasRange() {
+					mediaSegment.Offset = previous.Offset + previous.Length
+				}
+			}
 		}
+		if segment.Discontinuity && len(segments) > 0 {
+			mediaSegment.Discontinuity = true
+		}
+		// a new map means a new init segment for the following segments
+		if segment.Map != nil && segment.Map.URI != "" {
+			mapSegment := newMapSegment(segment.Map, baseURL)
+			if !mapSegment.Equals(currentInit) {
+				currentInit = mapSegment
+				if len(segments) > 0 {
+					mediaSegment.Init = mapSegment
+					mediaSegment.Discontinuity = true
+				} else {
+					initSegment = mapSegment
+				}
+			}
+		}
+
+		mediaSegment.Duration = segment.Duration
+		segments = append(segments, mediaSegment)
+		totalDuration += segment.Duration
 	}
 	return segments, initSegment, totalDuration
 }
 
+func newMapSegment(xmap *m3u8.Map, baseURL *url.URL) *models.Segment {
+	return &models.Segment{
+		URL:    resolveURL(baseURL, xmap.URI),
+		Offset: xmap.Offset,
+		Length: xmap.Limit,
+	}
+}
+
+// assigns the decryption key of each segment. keys may rotate
+// mid-playlist and METHOD=NONE marks the following segments
+// as clear, so every segment carries its own key and sequence
 func handleEncryption(
 	ctx context.Context,
 	playlist *m3u8.MediaPlaylist,
 	baseURL *url.URL,
 	cookies []*http.Cookie,
-	format *models.MediaFormat,
+	segments []*models.Segment,
 ) error {
-	if playlist.Key == nil || playlist.Key.URI == "" {
-		return nil
-	}
+	// each key is fetched only once
+	keys := make(map[string][]byte)
 
-	keyURL := resolveURL(baseURL, playlist.Key.URI)
-	key, err := fetchContentWithContext(ctx, keyURL, cookies)
-	if err != nil {
-		return fmt.Errorf("failed to fetch encryption key: %w", err)
-	}
+	var currentKey *m3u8.Key
+	var idx int
+	for _, segment := range playlist.Segments {
+		if segment == nil || segment.URI == "" {
+			continue
+		}
+		if segment.Key != nil {
+			currentKey = segment.Key
+		}
+		mediaSegment := segments[idx]
+		sequence := int(playlist.SeqNo) + idx
+		idx++
 
-	iv, err := util.ParseHex(playlist.Key.IV)
-	if err != nil {
-		return fmt.Errorf("invalid initialization vector: %w", err)
-	}
+		if currentKey == nil || currentKey.URI == "" ||
+			strings.EqualFold(currentKey.Method, "NONE") {
+			continue
+		}
+		if !strings.EqualFold(currentKey.Method, "AES-128") {
+			return fmt.Errorf("unsupported encryption method: %s", currentKey.Method)
+		}
 
-	format.DecryptionKey = &models.DecryptionKey{
-		Method:        playlist.Key.Method,
-		Key:           key,
-		IV:            iv,
-		MediaSequence: int(playlist.SeqNo),
+		keyURL := resolveURL(baseURL, currentKey.URI)
+		key, ok := keys[keyURL]
+		if !ok {
+			var err error
+			key, err = fetchContentWithContext(ctx, keyURL, cookies)
+			if err != nil {
+				return fmt.Errorf("failed to fetch encryption key: %w", err)
+			}
+			keys[keyURL] = key
+		}
+
+		decryptionKey := &models.DecryptionKey{
+			Method: currentKey.Method,
+			Key:    key,
+		}
+		if currentKey.IV != "" {
+			iv, err := util.ParseHex(currentKey.IV)
+			if err != nil {
+				return fmt.Errorf("invalid initialization vector: %w", err)
+			}
+			decryptionKey.IV = iv
+		} else {
+			// without an explicit IV, the media
+			// sequence number is used as the IV
+			decryptionKey.IV = util.GenerateZeroIV()
+			decryptionKey.MediaSequence = sequence
+		}
+		mediaSegment.Key = decryptionKey
 	}
 
 	return nil
@@ -479,7 +568,7 @@ func enrichFormatFromVariant(dst, src *models.MediaFormat) {
 	if src.Segments != nil {
 		dst.Segments = src.Segments
 	}
-	if src.InitSegment != "" {
+	if src.InitSegment != nil {
 		dst.InitSegment = src.InitSegment
 	}
 	if src.Duration > 0 {
@@ -488,6 +577,10 @@ func enrichFormatFromVariant(dst, src *models.MediaFormat) {
 	if src.DecryptionKey != nil {
 		dst.DecryptionKey = src.DecryptionKey
 	}
+	if src.IsLive {
+		dst.IsLive = true
+		dst.LivePlaylist = src.LivePlaylist
+	}
 }
 
 func getAudioAlternativeCodec(variants []*m3u8.Variant, alt *m3u8.Alternative) enums.MediaCodec {
@@ -0,0 +1,49 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/govdbot/govd/models"
+
+	"github.com/grafov/m3u8"
+	"github.com/pkg/errors"
+)
+
+// returns a function fetching the current
+// snapshot of a live media playlist
+func newLivePlaylistFunc(
+	playlistURL *url.URL,
+	cookies []*http.Cookie,
+) models.LivePlaylistFunc {
+	return func(ctx context.Context) (*models.LivePlaylist, error) {
+		content, err := fetchContentWithContext(ctx, playlistURL.String(), cookies)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch live playlist: %w", err)
+		}
+		playlist, listType, err := m3u8.DecodeFrom(bytes.NewBuffer(content), false)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing M3U8: %w", err)
+		}
+		media, ok := playlist.(*m3u8.MediaPlaylist)
+		if listType != m3u8.MEDIA || !ok {
+			return nil, errors.New("live playlist is not a media playlist")
+		}
+
+		segments, initSegment, _ := extractSegments(media, playlistURL)
+		if err := handleEncryption(ctx, media, playlistURL, cookies, segments); err != nil {
+			return nil, err
+		}
+		return &models.LivePlaylist{
+			InitSegment:    initSegment,
+			Segments:       segments,
+			TargetDuration: time.Duration(media.TargetDuration * float64(time.Second)),
+			IsEvent:        media.MediaType == m3u8.EVENT,
+			Ended:          media.Closed,
+		}, nil
+	}
+}
@@ -112,6 +112,44 @@ func fetchContentWithContext(ctx context.Context, url string, cookies []*http.Co
 	return io.ReadAll(resp.Body)
 }
 
+// fetches length bytes starting at offset
+func fetchRangeWithContext(
+	ctx context.Context,
+	url string,
+	offset int64,
+	length int64,
+	cookies []*http.Cookie,
+) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	resp, err := getHTTPClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch content: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// range not supported, skip to the requested bytes
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			return nil, fmt.Errorf("failed to read content: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("server returned status code: %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, length))
+}
+
 // backward-compatible function for fetching content without context
 func fetchContent(url string, cookies []*http.Cookie) ([]byte, error) {
 	return fetchContentWithContext(context.Background(), url, cookies)
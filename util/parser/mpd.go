@@ -13,7 +13,6 @@ import (
 
 	"github.com/govdbot/govd/enums"
 	"github.com/govdbot/govd/models"
-	"github.com/govdbot/govd/util"
 
 	"github.com/pkg/errors"
 	"github.com/unki2aut/go-mpd"
@@ -45,8 +44,8 @@ func ParseMPDContentWithContext(
 		return nil, fmt.Errorf("invalid base URL %q: %w", baseURL, err)
 	}
 
-	mpdDoc := &mpd.MPD{}
-	if err := mpdDoc.Decode(content); err != nil {
+	mpdDoc, err := decodeMPDManifest(content, cookies)
+	if err != nil {
 		return nil, fmt.Errorf("failed parsing MPD: %w", err)
 	}
 
@@ -76,7 +75,7 @@ func ParseMPDContentWithOptions(
 
 func parseMPDWithContext(
 	ctx context.Context,
-	mpdDoc *mpd.MPD,
+	mpdDoc *mpdManifest,
 	baseURL *url.URL,
 	opts *ParseOptions,
 ) ([]*models.MediaFormat, error) {
@@ -84,28 +83,50 @@ func parseMPDWithContext(
 		return nil, errors.New("no periods found in mpd")
 	}
 
-	// process first period (most common case)
-	period := mpdDoc.Period[0]
-	if len(period.AdaptationSets) == 0 {
-		return nil, errors.New("no adaptation sets found in period")
-	}
+	mpdBaseURL := resolveMPDBaseURL(baseURL, mpdDoc.BaseURL)
+	periodFormats := make([][]*models.MediaFormat, 0, len(mpdDoc.Period))
+	for idx, period := range mpdDoc.Period {
+		if period == nil || len(period.AdaptationSets) == 0 {
+			continue
+		}
+		periodBaseURL := resolvePeriodBaseURL(mpdBaseURL, period.BaseURL)
 
-	estimatedFormats := countRepresentations(period.AdaptationSets)
-	formats := make([]*models.MediaFormat, 0, estimatedFormats)
+		var mediaSets, textSets []*mpd.AdaptationSet
+		for _, adaptationSet := range period.AdaptationSets {
+			if adaptationSet != nil && isTextAdaptationSet(adaptationSet) {
+				textSets = append(textSets, adaptationSet)
+			} else {
+				mediaSets = append(mediaSets, adaptationSet)
+			}
+		}
 
-	mpdBaseURL := resolveMPDBaseURL(baseURL, mpdDoc.BaseURL)
-	periodBaseURL := resolvePeriodBaseURL(mpdBaseURL, period.BaseURL)
+		formats, err := processAdaptationSets(
+			ctx, mediaSets,
+			periodBaseURL, opts, mpdDoc,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed processing adaptation sets of period %d: %w", idx, err)
+		}
+		if len(formats) == 0 {
+			continue
+		}
 
-	adaptationFormats, err := processAdaptationSets(
-		ctx, period.AdaptationSets,
-		periodBaseURL, opts, mpdDoc,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed processing adaptation sets: %w", err)
+		// text tracks apply to every format of the period,
+		// they are only kept for single period manifests,
+		// as their timing would restart on every period
+		if len(mpdDoc.Period) == 1 {
+			subtitles := processTextAdaptationSets(ctx, textSets, periodBaseURL, mpdDoc)
+			for _, format := range formats {
+				format.Subtitles = subtitles
+			}
+		}
+		periodFormats = append(periodFormats, formats)
+	}
+	if len(periodFormats) == 0 {
+		return nil, errors.New("no adaptation sets found in periods")
 	}
-	formats = append(formats, adaptationFormats...)
 
-	return formats, nil
+	return concatPeriodFormats(periodFormats), nil
 }
 
 func processAdaptationSets(
@@ -113,16 +134,17 @@ func processAdaptationSets(
 	adaptationSets []*mpd.AdaptationSet,
 	baseURL *url.URL,
 	opts *ParseOptions,
-	mpdDoc *mpd.MPD,
+	mpdDoc *mpdManifest,
 ) ([]*models.MediaFormat, error) {
 	if !opts.EnableConcurrentFetch || len(adaptationSets) <= 1 {
-		return processAdaptationSetsSequential(mpdDoc, adaptationSets, baseURL)
+		return processAdaptationSetsSequential(ctx, mpdDoc, adaptationSets, baseURL)
 	}
 	return processAdaptationSetsConcurrent(ctx, adaptationSets, baseURL, opts, mpdDoc)
 }
 
 func processAdaptationSetsSequential(
-	mpdDoc *mpd.MPD,
+	ctx context.Context,
+	mpdDoc *mpdManifest,
 	adaptationSets []*mpd.AdaptationSet,
 	baseURL *url.URL,
 ) ([]*models.MediaFormat, error) {
@@ -133,7 +155,7 @@ func processAdaptationSetsSequential(
 			continue
 		}
 
-		setFormats, err := processAdaptationSet(adaptationSet, baseURL, mpdDoc)
+		setFormats, err := processAdaptationSet(ctx, adaptationSet, baseURL, mpdDoc)
 		if err != nil {
 			zap.S().Warnf("skipping adaptation set due to: %v", err)
 			continue
@@ -148,7 +170,7 @@ func processAdaptationSetsConcurrent(
 	adaptationSets []*mpd.AdaptationSet,
 	baseURL *url.URL,
 	opts *ParseOptions,
-	mpdDoc *mpd.MPD,
+	mpdDoc *mpdManifest,
 ) ([]*models.MediaFormat, error) {
 	validSets := filterValidAdaptationSets(adaptationSets)
 	if len(validSets) == 0 {
@@ -168,7 +190,7 @@ func processAdaptationSetsConcurrent(
 			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
 
-			setFormats, err := processAdaptationSet(set, baseURL, mpdDoc)
+			setFormats, err := processAdaptationSet(ctx, set, baseURL, mpdDoc)
 			if err != nil {
 				errors <- err
 				return
@@ -219,9 +241,10 @@ func processAdaptationSetsConcurrent(
 }
 
 func processAdaptationSet(
+	ctx context.Context,
 	adaptationSet *mpd.AdaptationSet,
 	baseURL *url.URL,
-	mpdDoc *mpd.MPD,
+	mpdDoc *mpdManifest,
 ) ([]*models.MediaFormat, error) {
 	if len(adaptationSet.Representations) == 0 {
 		return nil, nil
@@ -236,7 +259,7 @@ func processAdaptationSet(
 		}
 
 		format, err := processRepresentation(
-			representation, adaptationSet,
+			ctx, representation, adaptationSet,
 			adaptationBaseURL, mpdDoc,
 		)
 		if err != nil {
@@ -252,10 +275,11 @@ func processAdaptationSet(
 }
 
 func processRepresentation(
+	ctx context.Context,
 	representation mpd.Representation,
 	adaptationSet *mpd.AdaptationSet,
 	baseURL *url.URL,
-	mpdDoc *mpd.MPD,
+	mpdDoc *mpdManifest,
 ) (*models.MediaFormat, error) {
 	mediaType, videoCodec, audioCodec := parseAdaptationSetType(adaptationSet, representation)
 	representationBaseURL := resolveRepresentationBaseURL(baseURL, representation.BaseURL)
@@ -268,6 +292,11 @@ func processRepresentation(
 		height = int64(*representation.Height)
 	}
 
+	duration := mpdDoc.getPeriod(adaptationSet).duration
+	if duration == 0 {
+		duration = getDurationSeconds(mpdDoc.MediaPresentationDuration)
+	}
+
 	format := &models.MediaFormat{
 		FormatID:   fmt.Sprintf("dash-%d", *representation.Bandwidth/1000),
 		Type:       mediaType,
@@ -277,25 +306,53 @@ func processRepresentation(
 		Width:      width,
 		Height:     height,
 		URL:        []string{representationBaseURL.String()},
-		Duration:   getTotalDurationSeconds(mpdDoc.MediaPresentationDuration),
+		Duration:   int64(duration),
+	}
+	if adaptationSet.Lang != nil {
+		format.Language = *adaptationSet.Lang
 	}
 
-	// process segment template if available
-	segmentTemplate := getSegmentTemplate(representation, adaptationSet)
-	if segmentTemplate != nil {
+	segmentTemplate, segmentList, segmentBase := mpdDoc.getSegmentInfo(representation, adaptationSet)
+	switch {
+	case segmentTemplate != nil:
 		segments, initSegment, err := extractSegmentsFromTemplate(
-			segmentTemplate, representation, representationBaseURL, mpdDoc,
+			segmentTemplate, representation, representationBaseURL, duration,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed extracting segments: %w", err)
 		}
 
+		format.Segments = segments
+		if initSegment != "" {
+			format.InitSegment = &models.Segment{URL: initSegment}
+		}
+	case segmentList != nil:
+		segments, initSegment, err := extractSegmentsFromList(segmentList, representationBaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed extracting segment list: %w", err)
+		}
+		zap.S().Debugf("extracted %d list segments", len(segments))
 		format.Segments = segments
 		format.InitSegment = initSegment
+	case segmentBase != nil && segmentBase.IndexRange != "":
+		segments, initSegment, duration, err := extractSegmentsFromIndex(
+			ctx, segmentBase,
+			representationBaseURL,
+			mpdDoc.cookies,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed extracting indexed segments: %w", err)
+		}
+		zap.S().Debugf("extracted %d indexed segments", len(segments))
+		format.Segments = segments
+		format.InitSegment = initSegment
+		if format.Duration == 0 {
+			format.Duration = int64(duration)
+		}
 	}
 
 	// handle content protection
-	if err := handleContentProtection(adaptationSet, representation, format); err != nil {
+	if err := handleContentProtection(ctx, adaptationSet, representation, format, mpdDoc); err != nil {
 		return nil, err
 	}
 
@@ -307,9 +364,9 @@ func extractSegmentsFromTemplate(
 	segmentTemplate *mpd.SegmentTemplate,
 	representation mpd.Representation,
 	baseURL *url.URL,
-	mpdDoc *mpd.MPD,
-) ([]string, string, error) {
-	var segments []string
+	duration float64,
+) ([]*models.Segment, string, error) {
+	var segments []*models.Segment
 	var initSegment string
 
 	// handle initialization segment
@@ -324,7 +381,7 @@ func extractSegmentsFromTemplate(
 		zap.S().Debugf("extracted %d timeline segments", len(segments))
 	} else if segmentTemplate.Media != nil {
 		// template-based segments
-		segmentCount := calculateSegmentCount(segmentTemplate, mpdDoc)
+		segmentCount := calculateSegmentCount(segmentTemplate, duration)
 		segments = extractTemplateSegments(segmentTemplate, representation, baseURL, segmentCount)
 		zap.S().Debugf("extracted %d template segments", len(segments))
 	}
@@ -336,8 +393,8 @@ func extractTimelineSegments(
 	segmentTemplate *mpd.SegmentTemplate,
 	representation mpd.Representation,
 	baseURL *url.URL,
-) []string {
-	var segments []string
+) []*models.Segment {
+	var segments []*models.Segment
 
 	if segmentTemplate.SegmentTimeline == nil || len(segmentTemplate.SegmentTimeline.S) == 0 {
 		return segments
@@ -348,6 +405,7 @@ func extractTimelineSegments(
 		startNumber = *segmentTemplate.StartNumber
 	}
 
+	timescale := getTimescale(segmentTemplate)
 	segmentNumber := startNumber
 	var currentTime uint64
 
@@ -363,8 +421,10 @@ func extractTimelineSegments(
 
 		for i := int64(0); i <= repeatCount; i++ {
 			mediaURL := expandSegmentTemplate(*segmentTemplate.Media, representation, segmentNumber, currentTime)
-			segmentURL := resolveURL(baseURL, mediaURL)
-			segments = append(segments, segmentURL)
+			segments = append(segments, &models.Segment{
+				URL:      resolveURL(baseURL, mediaURL),
+				Duration: float64(s.D) / timescale,
+			})
 
 			currentTime += s.D
 			segmentNumber++
@@ -379,26 +439,39 @@ func extractTemplateSegments(
 	representation mpd.Representation,
 	baseURL *url.URL,
 	segmentCount int,
-) []string {
-	var segments []string
+) []*models.Segment {
+	var segments []*models.Segment
 
 	startNumber := uint64(1)
 	if segmentTemplate.StartNumber != nil {
 		startNumber = *segmentTemplate.StartNumber
 	}
+	var segmentDuration float64
+	if segmentTemplate.Duration != nil {
+		segmentDuration = float64(*segmentTemplate.Duration) / getTimescale(segmentTemplate)
+	}
 
 	for i := range segmentCount {
 		segmentNumber := startNumber + uint64(i)
 		mediaURL := expandSegmentTemplate(*segmentTemplate.Media, representation, segmentNumber, 0)
-		segmentURL := resolveURL(baseURL, mediaURL)
-		segments = append(segments, segmentURL)
+		segments = append(segments, &models.Segment{
+			URL:      resolveURL(baseURL, mediaURL),
+			Duration: segmentDuration,
+		})
 	}
 
 	return segments
 }
 
-func calculateSegmentCount(segmentTemplate *mpd.SegmentTemplate, mpdDoc *mpd.MPD) int {
-	totalDurationSeconds := getTotalDurationSeconds(mpdDoc.MediaPresentationDuration)
+// timescale of the segment durations, in units per second
+func getTimescale(segmentTemplate *mpd.SegmentTemplate) float64 {
+	if segmentTemplate.Timescale != nil && *segmentTemplate.Timescale > 0 {
+		return float64(*segmentTemplate.Timescale)
+	}
+	return 1
+}
+
+func calculateSegmentCount(segmentTemplate *mpd.SegmentTemplate, totalDurationSeconds float64) int {
 
 	var segmentDurationSeconds float64 = 10.0 // default 10 seconds
 	if segmentTemplate.Duration != nil && segmentTemplate.Timescale != nil {
@@ -407,8 +480,8 @@ func calculateSegmentCount(segmentTemplate *mpd.SegmentTemplate, mpdDoc *mpd.MPD
 			*segmentTemplate.Duration, *segmentTemplate.Timescale, segmentDurationSeconds)
 	}
 	if totalDurationSeconds > 0 && segmentDurationSeconds > 0 {
-		segmentCount := int(math.Ceil(float64(totalDurationSeconds) / segmentDurationSeconds))
-		zap.S().Debugf("total duration: %d seconds, segment duration: %.4f seconds, segment count: %d",
+		segmentCount := int(math.Ceil(totalDurationSeconds / segmentDurationSeconds))
+		zap.S().Debugf("total duration: %.2f seconds, segment duration: %.4f seconds, segment count: %d",
 			totalDurationSeconds, segmentDurationSeconds, segmentCount)
 		return segmentCount
 	}
@@ -457,54 +530,69 @@ func expandSegmentTemplate(template string, representation mpd.Representation, n
 	return result
 }
 
+// resolves the clearkey key of protected representations.
+// keys must be delivered in the clear, either through a clearkey
+// license server or inline in the manifest, as other DRM
+// systems can't be decrypted
 func handleContentProtection(
+	ctx context.Context,
 	adaptationSet *mpd.AdaptationSet,
 	representation mpd.Representation,
 	format *models.MediaFormat,
+	mpdDoc *mpdManifest,
 ) error {
-	protections := adaptationSet.ContentProtections
-	if len(representation.ContentProtections) > 0 {
-		protections = representation.ContentProtections
-	}
+	protections := mpdDoc.getContentProtections(representation, adaptationSet)
 
+	var encrypted bool
+	var keyID []byte
+	var licenseURL string
 	for _, protection := range protections {
-		if protection.SchemeIDURI == nil {
-			continue
-		}
-
-		scheme := strings.ToLower(*protection.SchemeIDURI)
-		if strings.Contains(scheme, "cenc") || strings.Contains(scheme, "clearkey") {
-			format.DecryptionKey = &models.DecryptionKey{
-				Method: "AES-128",
+		scheme := strings.ToLower(protection.SchemeIDURI)
+		switch {
+		case scheme == mp4ProtectionScheme:
+			encrypted = true
+		case isClearKeyScheme(scheme):
+			if protection.Laurl != "" {
+				licenseURL = strings.TrimSpace(protection.Laurl)
 			}
-
-			if protection.CencDefaultKeyId != nil {
-				if key, err := util.ParseHex(*protection.CencDefaultKeyId); err == nil {
-					format.DecryptionKey.Key = key
-				}
+		}
+		if protection.DefaultKID != "" {
+			kid, err := parseKeyID(protection.DefaultKID)
+			if err != nil {
+				return fmt.Errorf("invalid default key id: %w", err)
 			}
-			break
+			keyID = kid
 		}
 	}
+	if !encrypted {
+		return nil
+	}
+	if licenseURL == "" {
+		return errors.New("representation is protected without a clearkey license")
+	}
+
+	key, err := mpdDoc.getClearKey(ctx, licenseURL, keyID)
+	if err != nil {
+		return fmt.Errorf("failed to get clearkey key: %w", err)
+	}
+	format.DecryptionKey = &models.DecryptionKey{
+		Method: models.DecryptionMethodCENC,
+		Key:    key,
+		KeyID:  keyID,
+	}
 
 	return nil
 }
 
-func getTotalDurationSeconds(duration *xsd.Duration) int64 {
+func getDurationSeconds(duration *xsd.Duration) float64 {
 	if duration == nil {
 		return 0
 	}
-	var total float64
-
-	if duration.Hours != 0 {
-		total += float64(duration.Hours) * 3600
-	}
-	if duration.Minutes != 0 {
-		total += float64(duration.Minutes) * 60
+	seconds, err := duration.ToSeconds()
+	if err != nil {
+		return 0
 	}
-	total += float64(duration.Seconds)
-
-	return int64(total)
+	return seconds
 }
 
 func getSegmentTemplate(representation mpd.Representation, adaptationSet *mpd.AdaptationSet) *mpd.SegmentTemplate {
@@ -547,16 +635,6 @@ func parseAdaptationSetType(adaptationSet *mpd.AdaptationSet, representation mpd
 	return mediaType, videoCodec, audioCodec
 }
 
-func countRepresentations(adaptationSets []*mpd.AdaptationSet) int {
-	count := 0
-	for _, set := range adaptationSets {
-		if set != nil {
-			count += len(set.Representations)
-		}
-	}
-	return count
-}
-
 func filterValidAdaptationSets(adaptationSets []*mpd.AdaptationSet) []*mpd.AdaptationSet {
 	valid := make([]*mpd.AdaptationSet, 0, len(adaptationSets))
 	for _, set := range adaptationSets {
@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"bytes"
+
+	"github.com/govdbot/govd/models"
+
+	"go.uber.org/zap"
+)
+
+// joins the formats of consecutive periods, matching each format
+// of the first period with the closest one of the following periods.
+// formats without a match in every period are dropped. when none
+// has, the periods are ads or bumpers around the content, and the
+// formats of the longest period are used on their own
+func concatPeriodFormats(periodFormats [][]*models.MediaFormat) []*models.MediaFormat {
+	if len(periodFormats) == 1 {
+		return periodFormats[0]
+	}
+	zap.S().Debugf("concatenating %d periods", len(periodFormats))
+
+	formats := make([]*models.MediaFormat, 0, len(periodFormats[0]))
+	for _, format := range periodFormats[0] {
+		matches := make([]*models.MediaFormat, 0, len(periodFormats)-1)
+		for _, candidates := range periodFormats[1:] {
+			match := matchPeriodFormat(format, candidates)
+			if match == nil || !sameDecryptionKey(format.DecryptionKey, match.DecryptionKey) {
+				zap.S().Debugf("no match for format %s in every period", format.FormatID)
+				break
+			}
+			matches = append(matches, match)
+		}
+		if len(matches) < len(periodFormats)-1 {
+			continue
+		}
+		for _, match := range matches {
+			appendPeriodFormat(format, match)
+		}
+		formats = append(formats, format)
+	}
+	if len(formats) == 0 {
+		zap.S().Debug("no format spans every period, using the longest one")
+		return getLongestPeriod(periodFormats)
+	}
+	return formats
+}
+
+// returns the formats of the period with the longest duration,
+// which is the main content when the others are ads
+func getLongestPeriod(periodFormats [][]*models.MediaFormat) []*models.MediaFormat {
+	var longest []*models.MediaFormat
+	var longestDuration int64 = -1
+	for _, formats := range periodFormats {
+		var duration int64
+		for _, format := range formats {
+			duration = max(duration, format.Duration)
+		}
+		if duration > longestDuration {
+			longest = formats
+			longestDuration = duration
+		}
+	}
+	return longest
+}
+
+// returns the candidate with the same type, codecs and language,
+// with the closest height, then the closest bitrate
+func matchPeriodFormat(
+	format *models.MediaFormat,
+	candidates []*models.MediaFormat,
+) *models.MediaFormat {
+	var best *models.MediaFormat
+	for _, candidate := range candidates {
+		if candidate.Type != format.Type ||
+			candidate.VideoCodec != format.VideoCodec ||
+			candidate.AudioCodec != format.AudioCodec ||
+			candidate.Language != format.Language {
+			continue
+		}
+		if best == nil {
+			best = candidate
+			continue
+		}
+		heightDiff := absDiff(candidate.Height, format.Height)
+		bestHeightDiff := absDiff(best.Height, format.Height)
+		if heightDiff < bestHeightDiff ||
+			heightDiff == bestHeightDiff &&
+				absDiff(candidate.Bitrate, format.Bitrate) < absDiff(best.Bitrate, format.Bitrate) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// appends the segments of a period to a format. every period
+// starts a new timeline, usually with its own init segment
+func appendPeriodFormat(dst *models.MediaFormat, src *models.MediaFormat) {
+	if len(dst.Segments) == 0 {
+		dst.Segments = getPeriodSegments(dst)
+	}
+	segments := getPeriodSegments(src)
+	if len(segments) == 0 {
+		return
+	}
+	// segments may be shared by several formats,
+	// copy the first one to mark the start of the period
+	first := *segments[0]
+	first.Discontinuity = true
+	if src.InitSegment != nil {
+		first.Init = src.InitSegment
+	}
+	dst.Segments = append(dst.Segments, &first)
+	dst.Segments = append(dst.Segments, segments[1:]...)
+	dst.Duration += src.Duration
+}
+
+// returns the segments of a format, or a single
+// segment when the period is a single file
+func getPeriodSegments(format *models.MediaFormat) []*models.Segment {
+	if len(format.Segments) > 0 {
+		return format.Segments
+	}
+	if len(format.URL) == 0 {
+		return nil
+	}
+	return []*models.Segment{{
+		URL:      format.URL[0],
+		Duration: float64(format.Duration),
+	}}
+}
+
+func sameDecryptionKey(a, b *models.DecryptionKey) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return bytes.Equal(a.Key, b.Key)
+}
+
+func absDiff(a, b int64) int64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,417 @@
+package parser
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/govdbot/govd/models"
+
+	"github.com/pkg/errors"
+	"github.com/unki2aut/go-mpd"
+)
+
+// mpdManifest wraps the parsed MPD with the segment
+// and protection elements the mpd package doesn't decode
+type mpdManifest struct {
+	*mpd.MPD
+	cookies []*http.Cookie
+	// elements of the adaptation sets of every period
+	adaptationSets map[*mpd.AdaptationSet]*mpdAdaptationSetElements
+	periods        map[*mpd.AdaptationSet]*mpdPeriod
+
+	// clearkey keys by license URL and key id
+	clearKeys      map[string][]byte
+	clearKeysMutex sync.Mutex
+}
+
+type mpdURL struct {
+	SourceURL string `xml:"sourceURL,attr"`
+	Range     string `xml:"range,attr"`
+}
+
+type mpdSegmentURL struct {
+	Media      string `xml:"media,attr"`
+	MediaRange string `xml:"mediaRange,attr"`
+}
+
+type mpdSegmentBase struct {
+	IndexRange     string  `xml:"indexRange,attr"`
+	Initialization *mpdURL `xml:"Initialization"`
+}
+
+type mpdSegmentList struct {
+	Initialization *mpdURL         `xml:"Initialization"`
+	SegmentURLs    []mpdSegmentURL `xml:"SegmentURL"`
+}
+
+type mpdSegmentElements struct {
+	SegmentBase *mpdSegmentBase `xml:"SegmentBase"`
+	SegmentList *mpdSegmentList `xml:"SegmentList"`
+}
+
+type mpdContentProtection struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+	DefaultKID  string `xml:"default_KID,attr"`
+	Laurl       string `xml:"Laurl"`
+}
+
+type mpdRepresentationElements struct {
+	ID string `xml:"id,attr"`
+	mpdSegmentElements
+	ContentProtections []mpdContentProtection `xml:"ContentProtection"`
+}
+
+type mpdAdaptationSetElements struct {
+	mpdSegmentElements
+	ContentProtections []mpdContentProtection      `xml:"ContentProtection"`
+	Representations    []mpdRepresentationElements `xml:"Representation"`
+}
+
+// the period an adaptation set belongs to
+type mpdPeriod struct {
+	elements *mpdSegmentElements
+	duration float64 // seconds, 0 if unknown
+}
+
+type mpdDocumentElements struct {
+	Period []struct {
+		mpdSegmentElements
+		AdaptationSets []*mpdAdaptationSetElements `xml:"AdaptationSet"`
+	} `xml:"Period"`
+}
+
+func decodeMPDManifest(content []byte, cookies []*http.Cookie) (*mpdManifest, error) {
+	mpdDoc := &mpd.MPD{}
+	if err := mpdDoc.Decode(content); err != nil {
+		return nil, err
+	}
+	manifest := &mpdManifest{
+		MPD:            mpdDoc,
+		cookies:        cookies,
+		adaptationSets: make(map[*mpd.AdaptationSet]*mpdAdaptationSetElements),
+		periods:        make(map[*mpd.AdaptationSet]*mpdPeriod),
+		clearKeys:      make(map[string][]byte),
+	}
+
+	var segmentDoc mpdDocumentElements
+	if err := xml.Unmarshal(content, &segmentDoc); err != nil {
+		return nil, err
+	}
+	// both documents decode the same elements in
+	// the same order, so they can be matched by index
+	for i, period := range mpdDoc.Period {
+		if i >= len(segmentDoc.Period) {
+			break
+		}
+		periodElements := segmentDoc.Period[i]
+		info := &mpdPeriod{
+			elements: &periodElements.mpdSegmentElements,
+			duration: manifest.getPeriodDuration(i),
+		}
+		for j, adaptationSet := range period.AdaptationSets {
+			manifest.periods[adaptationSet] = info
+			if j < len(periodElements.AdaptationSets) {
+				manifest.adaptationSets[adaptationSet] = periodElements.AdaptationSets[j]
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// returns the duration of a period from its duration attribute,
+// or from the start of the next period or the end of the presentation
+func (manifest *mpdManifest) getPeriodDuration(idx int) float64 {
+	period := manifest.Period[idx]
+	if period.Duration != nil {
+		return getDurationSeconds(period.Duration)
+	}
+	start := getDurationSeconds(period.Start)
+	end := getDurationSeconds(manifest.MediaPresentationDuration)
+	if idx+1 < len(manifest.Period) && manifest.Period[idx+1].Start != nil {
+		end = getDurationSeconds(manifest.Period[idx+1].Start)
+	}
+	if end <= start {
+		return 0
+	}
+	return end - start
+}
+
+func (manifest *mpdManifest) getPeriod(adaptationSet *mpd.AdaptationSet) *mpdPeriod {
+	if period, ok := manifest.periods[adaptationSet]; ok {
+		return period
+	}
+	return &mpdPeriod{}
+}
+
+// returns the segment information of a representation, following
+// the representation > adaptation set > period inheritance.
+// only one of the returned values is set
+func (manifest *mpdManifest) getSegmentInfo(
+	representation mpd.Representation,
+	adaptationSet *mpd.AdaptationSet,
+) (*mpd.SegmentTemplate, *mpdSegmentList, *mpdSegmentBase) {
+	if representation.SegmentTemplate != nil {
+		return representation.SegmentTemplate, nil, nil
+	}
+	var representationSegments, setSegments *mpdSegmentElements
+	representationElements, setElements := manifest.getElements(representation, adaptationSet)
+	if representationElements != nil {
+		representationSegments = &representationElements.mpdSegmentElements
+	}
+	if setElements != nil {
+		setSegments = &setElements.mpdSegmentElements
+	}
+	if segmentList, segmentBase := representationSegments.get(); segmentList != nil || segmentBase != nil {
+		return nil, segmentList, segmentBase
+	}
+	if adaptationSet.SegmentTemplate != nil {
+		return adaptationSet.SegmentTemplate, nil, nil
+	}
+	if segmentList, segmentBase := setSegments.get(); segmentList != nil || segmentBase != nil {
+		return nil, segmentList, segmentBase
+	}
+	segmentList, segmentBase := manifest.getPeriod(adaptationSet).elements.get()
+	return nil, segmentList, segmentBase
+}
+
+// returns the content protection descriptors of a representation,
+// which override the ones of its adaptation set
+func (manifest *mpdManifest) getContentProtections(
+	representation mpd.Representation,
+	adaptationSet *mpd.AdaptationSet,
+) []mpdContentProtection {
+	representationElements, setElements := manifest.getElements(representation, adaptationSet)
+	if representationElements != nil && len(representationElements.ContentProtections) > 0 {
+		return representationElements.ContentProtections
+	}
+	if setElements != nil {
+		return setElements.ContentProtections
+	}
+	return nil
+}
+
+func (manifest *mpdManifest) getElements(
+	representation mpd.Representation,
+	adaptationSet *mpd.AdaptationSet,
+) (*mpdRepresentationElements, *mpdAdaptationSetElements) {
+	setElements := manifest.adaptationSets[adaptationSet]
+	if setElements == nil || representation.ID == nil {
+		return nil, setElements
+	}
+	for i := range setElements.Representations {
+		if setElements.Representations[i].ID == *representation.ID {
+			return &setElements.Representations[i], setElements
+		}
+	}
+	return nil, setElements
+}
+
+func (elements *mpdSegmentElements) get() (*mpdSegmentList, *mpdSegmentBase) {
+	if elements == nil {
+		return nil, nil
+	}
+	if elements.SegmentList != nil && len(elements.SegmentList.SegmentURLs) > 0 {
+		return elements.SegmentList, nil
+	}
+	return nil, elements.SegmentBase
+}
+
+func extractSegmentsFromList(
+	segmentList *mpdSegmentList,
+	baseURL *url.URL,
+) ([]*models.Segment, *models.Segment, error) {
+	var initSegment *models.Segment
+	if segmentList.Initialization != nil {
+		segment, err := newMPDSegment(
+			baseURL,
+			segmentList.Initialization.SourceURL,
+			segmentList.Initialization.Range,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid initialization: %w", err)
+		}
+		initSegment = segment
+	}
+	segments := make([]*models.Segment, 0, len(segmentList.SegmentURLs))
+	for i, segmentURL := range segmentList.SegmentURLs {
+		segment, err := newMPDSegment(baseURL, segmentURL.Media, segmentURL.MediaRange)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid segment %d: %w", i, err)
+		}
+		segments = append(segments, segment)
+	}
+	return segments, initSegment, nil
+}
+
+// builds the segments of a single-file representation
+// from the sidx box referenced by the index range
+func extractSegmentsFromIndex(
+	ctx context.Context,
+	segmentBase *mpdSegmentBase,
+	baseURL *url.URL,
+	cookies []*http.Cookie,
+) ([]*models.Segment, *models.Segment, float64, error) {
+	indexStart, indexLength, err := parseByteRange(segmentBase.IndexRange)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("invalid index range: %w", err)
+	}
+	fileURL := baseURL.String()
+
+	// without an explicit initialization, everything
+	// before the index is the init segment (ftyp and moov)
+	initSegment := &models.Segment{URL: fileURL, Length: indexStart}
+	if segmentBase.Initialization != nil {
+		initSegment, err = newMPDSegment(
+			baseURL,
+			segmentBase.Initialization.SourceURL,
+			segmentBase.Initialization.Range,
+		)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("invalid initialization: %w", err)
+		}
+	}
+	if !initSegment.HasRange() {
+		initSegment = nil
+	}
+
+	index, err := fetchRangeWithContext(ctx, fileURL, indexStart, indexLength, cookies)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to fetch index: %w", err)
+	}
+	references, timescale, anchor, err := parseSidx(index)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	segments := make([]*models.Segment, 0, len(references))
+	offset := indexStart + anchor
+	var totalDuration uint64
+	for _, reference := range references {
+		segment := &models.Segment{
+			URL:    fileURL,
+			Offset: offset,
+			Length: reference.size,
+		}
+		if timescale > 0 {
+			segment.Duration = float64(reference.duration) / float64(timescale)
+		}
+		segments = append(segments, segment)
+		offset += reference.size
+		totalDuration += reference.duration
+	}
+	var duration float64
+	if timescale > 0 {
+		duration = float64(totalDuration) / float64(timescale)
+	}
+	return segments, initSegment, duration, nil
+}
+
+type sidxReference struct {
+	size     int64
+	duration uint64
+}
+
+// parses a sidx (segment index) box, returning its references,
+// the timescale and the offset of the first referenced byte
+// relative to the start of the box
+func parseSidx(data []byte) ([]sidxReference, uint32, int64, error) {
+	if len(data) < 8 || string(data[4:8]) != "sidx" {
+		return nil, 0, 0, errors.New("index range does not point to a sidx box")
+	}
+	boxSize := int64(binary.BigEndian.Uint32(data))
+	if boxSize < 8 || boxSize > int64(len(data)) {
+		return nil, 0, 0, errors.New("truncated sidx box")
+	}
+	box := data[:boxSize]
+
+	// version (1), flags (3), reference id (4), timescale (4)
+	pos := 8
+	if len(box) < pos+12 {
+		return nil, 0, 0, errors.New("truncated sidx box")
+	}
+	version := box[pos]
+	timescale := binary.BigEndian.Uint32(box[pos+8:])
+	pos += 12
+
+	// earliest presentation time and first offset
+	var firstOffset uint64
+	if version == 0 {
+		if len(box) < pos+8 {
+			return nil, 0, 0, errors.New("truncated sidx box")
+		}
+		firstOffset = uint64(binary.BigEndian.Uint32(box[pos+4:]))
+		pos += 8
+	} else {
+		if len(box) < pos+16 {
+			return nil, 0, 0, errors.New("truncated sidx box")
+		}
+		firstOffset = binary.BigEndian.Uint64(box[pos+8:])
+		pos += 16
+	}
+
+	// reserved (2), reference count (2)
+	if len(box) < pos+4 {
+		return nil, 0, 0, errors.New("truncated sidx box")
+	}
+	referenceCount := int(binary.BigEndian.Uint16(box[pos+2:]))
+	pos += 4
+	if len(box) < pos+referenceCount*12 {
+		return nil, 0, 0, errors.New("truncated sidx references")
+	}
+
+	references := make([]sidxReference, 0, referenceCount)
+	for range referenceCount {
+		sizeField := binary.BigEndian.Uint32(box[pos:])
+		// the top bit marks references to other sidx boxes
+		if sizeField&0x80000000 != 0 {
+			return nil, 0, 0, errors.New("hierarchical sidx boxes are not supported")
+		}
+		references = append(references, sidxReference{
+			size:     int64(sizeField & 0x7fffffff),
+			duration: uint64(binary.BigEndian.Uint32(box[pos+4:])),
+		})
+		pos += 12
+	}
+	return references, timescale, boxSize + int64(firstOffset), nil
+}
+
+func newMPDSegment(baseURL *url.URL, sourceURL string, byteRange string) (*models.Segment, error) {
+	segment := &models.Segment{URL: baseURL.String()}
+	if sourceURL != "" {
+		segment.URL = resolveURL(baseURL, sourceURL)
+	}
+	if byteRange != "" {
+		offset, length, err := parseByteRange(byteRange)
+		if err != nil {
+			return nil, err
+		}
+		segment.Offset = offset
+		segment.Length = length
+	}
+	return segment, nil
+}
+
+// parses a "first-last" byte range into offset and length
+func parseByteRange(byteRange string) (int64, int64, error) {
+	first, last, ok := strings.Cut(strings.TrimSpace(byteRange), "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid byte range: %s", byteRange)
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid byte range: %s", byteRange)
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || end < start {
+		return 0, 0, fmt.Errorf("invalid byte range: %s", byteRange)
+	}
+	return start, end - start + 1, nil
+}
@@ -0,0 +1,162 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/govdbot/govd/enums"
+	"github.com/govdbot/govd/models"
+
+	"github.com/grafov/m3u8"
+	"github.com/pkg/errors"
+	"github.com/unki2aut/go-mpd"
+	"go.uber.org/zap"
+)
+
+// handles SUBTITLES alternatives of a master playlist.
+// every track is a media playlist of webvtt segments,
+// which is only fetched when the subtitles are requested
+func processSubtitleAlternatives(
+	variants []*m3u8.Variant,
+	baseURL *url.URL,
+	cookies []*http.Cookie,
+) []*models.Subtitle {
+	seen := make(map[string]bool)
+	var subtitles []*models.Subtitle
+
+	for _, variant := range variants {
+		if variant == nil {
+			continue
+		}
+		for _, alt := range variant.Alternatives {
+			if alt == nil || alt.Type != "SUBTITLES" || alt.URI == "" {
+				continue
+			}
+			altURL := resolveURL(baseURL, alt.URI)
+			if seen[altURL] {
+				continue
+			}
+			seen[altURL] = true
+
+			subtitles = append(subtitles, &models.Subtitle{
+				Language:     alt.Language,
+				Name:         alt.Name,
+				Format:       enums.SubtitleFormatWebVTT,
+				URL:          []string{altURL},
+				IsDefault:    alt.Default,
+				SegmentsFunc: newSubtitleSegmentsFunc(altURL, cookies),
+			})
+		}
+	}
+	return subtitles
+}
+
+func newSubtitleSegmentsFunc(
+	playlistURL string,
+	cookies []*http.Cookie,
+) models.SubtitleSegmentsFunc {
+	return func(ctx context.Context) ([]*models.Segment, error) {
+		content, err := fetchContentWithContext(ctx, playlistURL, cookies)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch subtitle playlist: %w", err)
+		}
+
+		// avoid infinite recursion
+		opts := &ParseOptions{
+			EnableConcurrentFetch: false,
+			MaxConcurrency:        1,
+			Timeout:               defaultHTTPTimeout,
+		}
+		formats, err := ParseM3U8ContentWithContext(
+			ctx, content, playlistURL,
+			cookies, opts,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse subtitle playlist: %w", err)
+		}
+		if len(formats) == 0 || len(formats[0].Segments) == 0 {
+			return nil, errors.New("no subtitle segments found")
+		}
+		return formats[0].Segments, nil
+	}
+}
+
+// returns the subtitle format of a text adaptation set,
+// or an empty string if it is not a supported text track.
+// subtitles packed into mp4 fragments (wvtt, stpp) are not supported
+func getTextAdaptationSetFormat(adaptationSet *mpd.AdaptationSet) enums.SubtitleFormat {
+	switch strings.ToLower(adaptationSet.MimeType) {
+	case "text/vtt":
+		return enums.SubtitleFormatWebVTT
+	case "application/ttml+xml":
+		return enums.SubtitleFormatTTML
+	}
+	return ""
+}
+
+func isTextAdaptationSet(adaptationSet *mpd.AdaptationSet) bool {
+	if strings.HasPrefix(strings.ToLower(adaptationSet.MimeType), "text/") {
+		return true
+	}
+	if getTextAdaptationSetFormat(adaptationSet) != "" {
+		return true
+	}
+	return adaptationSet.ContentType != nil &&
+		strings.ToLower(*adaptationSet.ContentType) == "text"
+}
+
+// handles text adaptation sets, using the
+// first representation of each one as the track
+func processTextAdaptationSets(
+	ctx context.Context,
+	adaptationSets []*mpd.AdaptationSet,
+	baseURL *url.URL,
+	mpdDoc *mpdManifest,
+) []*models.Subtitle {
+	var subtitles []*models.Subtitle
+
+	for _, adaptationSet := range adaptationSets {
+		subtitleFormat := getTextAdaptationSetFormat(adaptationSet)
+		if subtitleFormat == "" || len(adaptationSet.Representations) == 0 {
+			continue
+		}
+		adaptationBaseURL := resolveAdaptationSetBaseURL(baseURL, adaptationSet.BaseURL)
+		representation := adaptationSet.Representations[0]
+		if representation.Bandwidth == nil {
+			// text tracks often omit it
+			var bandwidth uint64
+			representation.Bandwidth = &bandwidth
+		}
+
+		format, err := processRepresentation(
+			ctx, representation, adaptationSet,
+			adaptationBaseURL, mpdDoc,
+		)
+		if err != nil {
+			zap.S().Warnf("skipping text adaptation set due to: %v", err)
+			continue
+		}
+
+		subtitle := &models.Subtitle{
+			Format:   subtitleFormat,
+			URL:      format.URL,
+			Segments: format.Segments,
+		}
+		if adaptationSet.Lang != nil {
+			subtitle.Language = *adaptationSet.Lang
+		}
+		if representation.ID != nil {
+			subtitle.Name = *representation.ID
+		}
+		for _, role := range adaptationSet.Role {
+			if role != nil && role.Value != nil && *role.Value == "main" {
+				subtitle.IsDefault = true
+			}
+		}
+		subtitles = append(subtitles, subtitle)
+	}
+	return subtitles
+}
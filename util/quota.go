@@ -0,0 +1,274 @@
+package util
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/govdbot/govd/config"
+
+	"github.com/dustin/go-humanize"
+	"go.uber.org/zap"
+)
+
+const (
+	// how long a download waits for space before giving up
+	diskQueueTimeout = 2 * time.Minute
+	// temporary directories untouched for this long are left over
+	staleTempDirAge = 10 * time.Minute
+	// how long the size of the downloads directory is cached
+	dirSizeTTL = 30 * time.Second
+)
+
+type diskReservation struct {
+	size int64
+	// bytes downloaded so far, which are on disk as partial files
+	written atomic.Int64
+	// bytes written before the last walk of the
+	// downloads directory, already counted in its size
+	counted int64
+}
+
+// returns the bytes of the reservation not on disk yet.
+// the estimated size may be lower than what is written
+func (reservation *diskReservation) pending(written int64) int64 {
+	return max(reservation.size-written, 0)
+}
+
+type diskReservationKey struct{}
+
+var (
+	// reservations of the downloads in progress
+	diskReservations = make(map[*diskReservation]struct{})
+	// size of the downloads directory at the last walk
+	dirSize      int64
+	dirSizeStale = true
+	dirSizeTime  time.Time
+	diskMutex    sync.Mutex
+	// serializes the walks, which run without diskMutex
+	dirSizeMutex sync.Mutex
+	// closed and replaced every time space is released,
+	// waking up queued downloads
+	diskReleased = make(chan struct{})
+)
+
+// ReserveDiskSpace reserves size bytes in the downloads directory
+// before a download starts. if there is not enough space, stale
+// temporary files are evicted and the download is queued until
+// other downloads release their space.
+// the returned context must be used for the download, so that
+// the bytes it writes aren't counted twice. the returned
+// function must be called once the download is done
+func ReserveDiskSpace(ctx context.Context, size int64) (context.Context, func(), error) {
+	quota := config.Env().DownloadsQuota
+	if quota > 0 && size > quota {
+		return nil, nil, ErrDiskSpaceLow
+	}
+
+	timeout := time.NewTimer(diskQueueTimeout)
+	defer timeout.Stop()
+
+	evicted := false
+	for {
+		if quota > 0 {
+			refreshDirSize()
+		}
+		diskMutex.Lock()
+		if hasDiskSpace(size) {
+			reservation := &diskReservation{size: size}
+			diskReservations[reservation] = struct{}{}
+			diskMutex.Unlock()
+			ctx = context.WithValue(ctx, diskReservationKey{}, reservation)
+			return ctx, releaseFunc(reservation), nil
+		}
+		released := diskReleased
+		diskMutex.Unlock()
+
+		if !evicted {
+			evictStaleFiles()
+			evicted = true
+			continue
+		}
+
+		zap.S().Debugf("not enough disk space for %s, queuing download", humanize.Bytes(uint64(size)))
+		select {
+		case <-released:
+		case <-timeout.C:
+			return nil, nil, ErrDiskSpaceLow
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+func releaseFunc(reservation *diskReservation) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			diskMutex.Lock()
+			defer diskMutex.Unlock()
+			delete(diskReservations, reservation)
+			// the downloaded file is only counted by the next walk
+			dirSizeStale = true
+			close(diskReleased)
+			diskReleased = make(chan struct{})
+		})
+	}
+}
+
+// addWrittenSpace counts bytes written to disk by the
+// download of ctx against its reservation, if it has one
+func addWrittenSpace(ctx context.Context, size int64) {
+	reservation, ok := ctx.Value(diskReservationKey{}).(*diskReservation)
+	if ok {
+		reservation.written.Add(size)
+	}
+}
+
+// returns the size reserved for the download of ctx,
+// zero if it has no reservation
+func reservedDiskSpace(ctx context.Context) int64 {
+	reservation, ok := ctx.Value(diskReservationKey{}).(*diskReservation)
+	if !ok {
+		return 0
+	}
+	return reservation.size
+}
+
+// updates the cached size of the downloads directory. the walk
+// runs without diskMutex, so it doesn't block reservations
+func refreshDirSize() {
+	dirSizeMutex.Lock()
+	defer dirSizeMutex.Unlock()
+
+	diskMutex.Lock()
+	if !dirSizeStale && time.Since(dirSizeTime) < dirSizeTTL {
+		diskMutex.Unlock()
+		return
+	}
+	// bytes written from now on may be missed by the walk,
+	// so only the ones written before are subtracted
+	written := make(map[*diskReservation]int64, len(diskReservations))
+	for reservation := range diskReservations {
+		written[reservation] = reservation.written.Load()
+	}
+	dirSizeStale = false
+	diskMutex.Unlock()
+
+	size := getDirSize(config.Env().DownloadsDirectory)
+
+	diskMutex.Lock()
+	defer diskMutex.Unlock()
+	dirSize = size
+	dirSizeTime = time.Now()
+	for reservation, n := range written {
+		reservation.counted = n
+	}
+}
+
+// must be called with diskMutex held
+func hasDiskSpace(size int64) bool {
+	if quota := config.Env().DownloadsQuota; quota > 0 {
+		var pending int64
+		for reservation := range diskReservations {
+			pending += reservation.pending(reservation.counted)
+		}
+		used := dirSize + pending
+		if used+size > quota {
+			zap.S().Debugf(
+				"downloads quota exceeded: %s used, %s requested, %s quota",
+				humanize.Bytes(uint64(used)),
+				humanize.Bytes(uint64(size)),
+				humanize.Bytes(uint64(quota)),
+			)
+			return false
+		}
+	}
+
+	if minFree := config.Env().MinFreeSpace; minFree > 0 {
+		free, err := freeDiskSpace(config.Env().DownloadsDirectory)
+		if err != nil {
+			zap.S().Debugf("failed to get free disk space: %v", err)
+			return true
+		}
+		// free space is current, so is the written size
+		var pending int64
+		for reservation := range diskReservations {
+			pending += reservation.pending(reservation.written.Load())
+		}
+		if free-pending-size < minFree {
+			zap.S().Debugf(
+				"free disk space too low: %s free, %s reserved, %s requested",
+				humanize.Bytes(uint64(max(free, 0))),
+				humanize.Bytes(uint64(pending)),
+				humanize.Bytes(uint64(size)),
+			)
+			return false
+		}
+	}
+
+	return true
+}
+
+func getDirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// prefixes of the temporary directories
+// created inside the downloads directory
+var tempDirPrefixes = []string{"segments", "live", "plugin"}
+
+// removes leftover temporary directories from
+// interrupted downloads and files older than the
+// usual cleanup age, to make room for new downloads
+func evictStaleFiles() {
+	dir := config.Env().DownloadsDirectory
+	zap.S().Debug("evicting stale files from downloads directory")
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !isTempDir(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) > staleTempDirAge {
+			path := filepath.Join(dir, entry.Name())
+			zap.S().Debugf("removing stale temporary directory: %s", path)
+			os.RemoveAll(path)
+		}
+	}
+	CleanupOldFiles(dir, 30*time.Minute)
+
+	diskMutex.Lock()
+	dirSizeStale = true
+	diskMutex.Unlock()
+}
+
+func isTempDir(name string) bool {
+	for _, prefix := range tempDirPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"github.com/govdbot/govd/models"
+	"github.com/govdbot/govd/util/libav"
+	"github.com/govdbot/govd/util/mp4box"
+
+	"go.uber.org/zap"
+)
+
+// segments sharing the same init segment and timeline
+type segmentGroup struct {
+	init     *models.Segment
+	segments []*models.Segment
+}
+
+func hasDiscontinuities(segments []*models.Segment) bool {
+	for _, segment := range segments {
+		if segment.Discontinuity || segment.Init != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// splits segments at every discontinuity or init segment change.
+// groups without their own init segment inherit the previous one
+func groupSegments(
+	initSegment *models.Segment,
+	segments []*models.Segment,
+) []*segmentGroup {
+	var groups []*segmentGroup
+	current := &segmentGroup{init: initSegment}
+	for _, segment := range segments {
+		if segment.Discontinuity || segment.Init != nil {
+			if len(current.segments) > 0 {
+				groups = append(groups, current)
+				current = &segmentGroup{init: current.init}
+			}
+			if segment.Init != nil {
+				current.init = segment.Init
+			}
+		}
+		current.segments = append(current.segments, segment)
+	}
+	if len(current.segments) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+// downloads the init segment of every group and merges
+// the already downloaded segment files into outputPath
+func mergeSegmentFiles(
+	ctx context.Context,
+	tempDir string,
+	initSegment *models.Segment,
+	segments []*models.Segment,
+	files []string,
+	outputPath string,
+	downloadConfig *models.DownloadConfig,
+) (string, error) {
+	groups := groupSegments(initSegment, segments)
+	segmentGroups := make([]libav.SegmentGroup, 0, len(groups))
+	var segmentIdx int
+	for i, group := range groups {
+		var initSegmentFile string
+		if group.init != nil {
+			segment, err := downloadFile(
+				ctx, group.init,
+				filepath.Join(tempDir, fmt.Sprintf("init_%03d", i)),
+				downloadConfig,
+			)
+			if err != nil {
+				return "", fmt.Errorf("failed to download init segment: %w", err)
+			}
+			initSegmentFile = segment
+		}
+		segmentGroups = append(segmentGroups, libav.SegmentGroup{
+			InitSegmentPath: initSegmentFile,
+			SegmentPaths:    files[segmentIdx : segmentIdx+len(group.segments)],
+		})
+		segmentIdx += len(group.segments)
+	}
+	zap.S().Debugf("merging %d segments in %d groups", len(segments), len(segmentGroups))
+	mergedFilePath, err := libav.MergeSegments(segmentGroups, outputPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to merge segments: %w", err)
+	}
+	return mergedFilePath, nil
+}
+
+func checkSegmentResponse(resp *http.Response, segment *models.Segment) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	if segment.HasRange() && resp.StatusCode == http.StatusPartialContent {
+		return nil
+	}
+	return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+}
+
+// returns the segment data from the response body.
+// servers ignoring the range header send the whole
+// resource, so the range is cut out of it here
+func segmentBody(resp *http.Response, segment *models.Segment) (io.Reader, error) {
+	if !segment.HasRange() {
+		return resp.Body, nil
+	}
+	if resp.StatusCode == http.StatusOK && segment.Offset > 0 {
+		if _, err := io.CopyN(io.Discard, resp.Body, segment.Offset); err != nil {
+			return nil, fmt.Errorf("failed to skip to segment range: %w", err)
+		}
+	}
+	return io.LimitReader(resp.Body, segment.Length), nil
+}
+
+// returns the key and media sequence used to decrypt a segment.
+// per-segment keys carry their own sequence, while the download
+// key applies to every segment with a sequential IV
+func getSegmentKey(
+	segment *models.Segment,
+	idx int,
+	fallback *models.DecryptionKey,
+) (*models.DecryptionKey, int) {
+	if segment.Key != nil {
+		return segment.Key, segment.Key.MediaSequence
+	}
+	// common encryption is applied to the merged file
+	if fallback != nil && !fallback.IsCENC() {
+		return fallback, fallback.MediaSequence + idx
+	}
+	return nil, 0
+}
+
+// decrypts downloaded segments in place, batching
+// consecutive segments that share the same key
+func decryptSegmentFiles(
+	files []string,
+	segments []*models.Segment,
+	offset int,
+	fallback *models.DecryptionKey,
+) error {
+	var (
+		batchKey       *models.DecryptionKey
+		batchFiles     []string
+		batchSequences []int
+	)
+	flush := func() error {
+		if batchKey == nil || len(batchFiles) == 0 {
+			return nil
+		}
+		zap.S().Debugf("decrypting %d segments", len(batchFiles))
+		err := DecryptSegmentsWithSequencesInPlace(
+			batchFiles, batchKey.Key,
+			batchKey.IV, batchSequences,
+		)
+		batchFiles, batchSequences = nil, nil
+		return err
+	}
+	for i, segment := range segments {
+		key, sequence := getSegmentKey(segment, offset+i, fallback)
+		if !sameKey(key, batchKey) {
+			if err := flush(); err != nil {
+				return err
+			}
+			batchKey = key
+		}
+		if key == nil {
+			continue
+		}
+		batchFiles = append(batchFiles, files[i])
+		batchSequences = append(batchSequences, sequence)
+	}
+	return flush()
+}
+
+func sameKey(a, b *models.DecryptionKey) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return bytes.Equal(a.Key, b.Key) && bytes.Equal(a.IV, b.IV)
+}
+
+// decrypts a file protected with common encryption in place.
+// does nothing for other keys
+func decryptCENCFile(filePath string, key *models.DecryptionKey) error {
+	if !key.IsCENC() {
+		return nil
+	}
+	zap.S().Debugf("decrypting cenc file: %s", filePath)
+	if err := mp4box.DecryptCENC(filePath, key.Key, key.KeyID); err != nil {
+		return fmt.Errorf("failed to decrypt file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package util
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/govdbot/govd/models"
+	"github.com/govdbot/govd/util/libav"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// amount of data inspected to detect the container
+const sniffSize = 64 * 1024
+
+var errNotStreamable = errors.New("source is not streamable")
+
+// streamPart fetches a single piece of a stream in memory
+type streamPart func(ctx context.Context) ([]byte, error)
+
+type streamPartResult struct {
+	data []byte
+	err  error
+}
+
+// streamReader fetches parts concurrently and exposes them as
+// a single ordered stream. at most window parts are kept in memory,
+// a new part is only fetched once a previous one has been consumed
+type streamReader struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	parts    []streamPart
+	results  []chan streamPartResult
+	slots    chan struct{}
+	progress func(float64)
+
+	current []byte
+	next    int
+	err     error
+}
+
+func newStreamReader(
+	ctx context.Context,
+	parts []streamPart,
+	window int,
+	progress func(float64),
+) *streamReader {
+	streamCtx, cancel := context.WithCancel(ctx)
+	reader := &streamReader{
+		ctx:      streamCtx,
+		cancel:   cancel,
+		parts:    parts,
+		results:  make([]chan streamPartResult, len(parts)),
+		slots:    make(chan struct{}, max(1, window)),
+		progress: progress,
+	}
+	for i := range reader.results {
+		reader.results[i] = make(chan streamPartResult, 1)
+	}
+	go reader.dispatch()
+	return reader
+}
+
+func (reader *streamReader) dispatch() {
+	for i, part := range reader.parts {
+		select {
+		case reader.slots <- struct{}{}:
+		case <-reader.ctx.Done():
+			return
+		}
+		go func(idx int, part streamPart) {
+			data, err := part(reader.ctx)
+			reader.results[idx] <- streamPartResult{data: data, err: err}
+		}(i, part)
+	}
+}
+
+func (reader *streamReader) Read(p []byte) (int, error) {
+	for len(reader.current) == 0 {
+		if reader.err != nil {
+			return 0, reader.err
+		}
+		if reader.next >= len(reader.parts) {
+			return 0, io.EOF
+		}
+		select {
+		case result := <-reader.results[reader.next]:
+			<-reader.slots
+			if result.err != nil {
+				reader.err = fmt.Errorf("part %d: %w", reader.next, result.err)
+				reader.cancel()
+				return 0, reader.err
+			}
+			reader.current = result.data
+			reader.next++
+			if reader.progress != nil {
+				reader.progress(float64(reader.next) / float64(len(reader.parts)))
+			}
+		case <-reader.ctx.Done():
+			reader.err = reader.ctx.Err()
+			return 0, reader.err
+		}
+	}
+	n := copy(p, reader.current)
+	reader.current = reader.current[n:]
+	return n, nil
+}
+
+// returns the error that interrupted the stream, if any
+func (reader *streamReader) Err() error {
+	return reader.err
+}
+
+func (reader *streamReader) Close() error {
+	reader.cancel()
+	return nil
+}
+
+// remuxes a progressive download while it's being downloaded,
+// writing the final file in a single pass.
+// returns errNotStreamable when the source can't be demuxed
+// without seeking, so the caller can fall back to a file download
+func streamDownload(
+	ctx context.Context,
+	selector *mirrorSelector,
+	filePath string,
+	downloadConfig *models.DownloadConfig,
+) error {
+	fileSize := selector.Size()
+	if fileSize <= 0 {
+		size, err := getFileSize(ctx, selector.URL(), downloadConfig)
+		if err != nil {
+			recordMirrorFailure(selector.URL())
+			return err
+		}
+		fileSize = size
+	}
+	if fileSize <= 0 {
+		// chunks can't be planned without the size
+		return errNotStreamable
+	}
+	if ExceedsMaxFileSize(int64(fileSize), downloadConfig) {
+		return ErrFileTooLarge
+	}
+
+	header, err := downloadChunkInMemory(
+		ctx, selector,
+		0, min(sniffSize, fileSize)-1,
+		downloadConfig,
+	)
+	if err != nil {
+		return err
+	}
+	inputFormat := detectStreamableFormat(header)
+	if inputFormat == "" {
+		return errNotStreamable
+	}
+	zap.S().Debugf("streaming %s source into remuxer", inputFormat)
+
+	// reuse the header as the first part
+	parts := []streamPart{
+		func(context.Context) ([]byte, error) {
+			return header, nil
+		},
+	}
+	for start := len(header); start < fileSize; start += downloadConfig.ChunkSize {
+		end := min(start+downloadConfig.ChunkSize, fileSize) - 1
+		parts = append(parts, func(ctx context.Context) ([]byte, error) {
+			return downloadChunkInMemory(ctx, selector, start, end, downloadConfig)
+		})
+	}
+
+	stream := newStreamReader(
+		ctx, parts,
+		downloadConfig.Concurrency,
+		downloadConfig.ProgressUpdater,
+	)
+	defer stream.Close()
+
+	if err := libav.RemuxReader(stream, inputFormat, filePath); err != nil {
+		os.Remove(filePath)
+		if streamErr := stream.Err(); streamErr != nil {
+			return streamErr
+		}
+		return fmt.Errorf("remuxing failed: %w", err)
+	}
+	return nil
+}
+
+// downloads the segments in order and feeds them straight
+// to the remuxer, without writing them to disk.
+// containers that can't be remuxed are just concatenated
+func streamSegments(
+	ctx context.Context,
+	initSegment *models.Segment,
+	segments []*models.Segment,
+	outputPath string,
+	downloadConfig *models.DownloadConfig,
+) error {
+	parts := make([]streamPart, 0, len(segments)+1)
+	if initSegment != nil {
+		parts = append(parts, func(ctx context.Context) ([]byte, error) {
+			data, err := downloadInMemory(ctx, initSegment, downloadConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to download init segment: %w", err)
+			}
+			return data, nil
+		})
+	}
+	for i, segment := range segments {
+		parts = append(parts, func(ctx context.Context) ([]byte, error) {
+			return fetchSegment(ctx, i, segment, downloadConfig)
+		})
+	}
+
+	stream := newStreamReader(
+		ctx, parts,
+		downloadConfig.Concurrency,
+		downloadConfig.ProgressUpdater,
+	)
+	defer stream.Close()
+
+	buffered := bufio.NewReaderSize(stream, sniffSize)
+	header, err := buffered.Peek(sniffSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read segments: %w", err)
+	}
+
+	inputFormat := detectStreamableFormat(header)
+	if inputFormat != "" && libav.CanRemux(outputPath) {
+		zap.S().Debugf("streaming %s segments into remuxer", inputFormat)
+		if err := libav.RemuxReader(buffered, inputFormat, outputPath); err != nil {
+			os.Remove(outputPath)
+			if streamErr := stream.Err(); streamErr != nil {
+				return streamErr
+			}
+			return fmt.Errorf("remuxing failed: %w", err)
+		}
+		return nil
+	}
+
+	zap.S().Debug("concatenating segments")
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer output.Close()
+	if _, err := io.Copy(output, buffered); err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("failed to write segments: %w", err)
+	}
+	return nil
+}
+
+// downloads a single segment in memory, decrypting it if needed
+func fetchSegment(
+	ctx context.Context,
+	idx int,
+	segment *models.Segment,
+	downloadConfig *models.DownloadConfig,
+) ([]byte, error) {
+	data, err := downloadInMemory(ctx, segment, downloadConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download segment %d: %w", idx, err)
+	}
+	key, sequence := getSegmentKey(segment, idx, downloadConfig.DecryptionKey)
+	if key == nil {
+		return data, nil
+	}
+	data, err = DecryptSegmentBytes(data, key.Key, key.IV, sequence)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt segment %d: %w", idx, err)
+	}
+	return data, nil
+}
+
+// returns the libav input format for containers that can be
+// demuxed from a non-seekable stream, or an empty string.
+// mp4 files are streamable only when the moov box comes
+// before mdat (faststart) or when they are fragmented
+func detectStreamableFormat(header []byte) string {
+	// mpeg-ts packets are 188 bytes long, starting with a sync byte
+	if len(header) > 0 && header[0] == 0x47 &&
+		(len(header) <= 188 || header[188] == 0x47) {
+		return "mpegts"
+	}
+	if len(header) < 8 {
+		return ""
+	}
+	if firstBox := string(header[4:8]); firstBox != "ftyp" && firstBox != "styp" {
+		return ""
+	}
+	offset := 0
+	for offset+8 <= len(header) {
+		size := uint64(binary.BigEndian.Uint32(header[offset:]))
+		switch string(header[offset+4 : offset+8]) {
+		case "moov", "moof":
+			return "mp4"
+		case "mdat":
+			return ""
+		}
+		switch size {
+		case 0:
+			// box extends to the end of the file
+			return ""
+		case 1:
+			// 64-bit size follows the box type
+			if offset+16 > len(header) {
+				return ""
+			}
+			size = binary.BigEndian.Uint64(header[offset+8:])
+		}
+		if size < 8 || size > uint64(len(header)) {
+			return ""
+		}
+		offset += int(size)
+	}
+	return ""
+}
@@ -0,0 +1,407 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/govdbot/govd/config"
+	"github.com/govdbot/govd/enums"
+	"github.com/govdbot/govd/models"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+var (
+	vttTagRE       = regexp.MustCompile(`<(/?)([a-z]*)[^>]*>`)
+	whitespaceRE   = regexp.MustCompile(`\s+`)
+	ttmlOffsetRE   = regexp.MustCompile(`^([\d.]+)(h|ms|m|s|f|t)$`)
+	ttmlClockRE    = regexp.MustCompile(`^(\d+):(\d{2}):(\d{2})(?:([.:])(\d+))?$`)
+	vttTimestampRE = regexp.MustCompile(`^(?:(\d+):)?(\d{2}):(\d{2})\.(\d{3})$`)
+)
+
+type subtitleCue struct {
+	start time.Duration
+	end   time.Duration
+	text  string
+}
+
+// DownloadSubtitle downloads a subtitle track and
+// converts it to srt, returning the path of the file
+func DownloadSubtitle(
+	ctx context.Context,
+	subtitle *models.Subtitle,
+	fileName string,
+	downloadConfig *models.DownloadConfig,
+) (string, error) {
+	downloadConfig = models.GetDownloadConfig(downloadConfig)
+
+	if err := subtitle.LoadSegments(ctx); err != nil {
+		return "", fmt.Errorf("failed to get subtitle segments: %w", err)
+	}
+
+	var data []byte
+	if len(subtitle.Segments) > 0 {
+		// segmented webvtt, every segment is a complete
+		// document, so they can be joined before parsing
+		var buf bytes.Buffer
+		for _, segment := range subtitle.Segments {
+			segmentData, err := downloadInMemory(ctx, segment, downloadConfig)
+			if err != nil {
+				return "", fmt.Errorf("failed to download subtitle segment: %w", err)
+			}
+			buf.Write(segmentData)
+			buf.WriteString("\n\n")
+		}
+		data = buf.Bytes()
+	} else {
+		reader, err := DownloadFileInMemory(ctx, subtitle.URL, downloadConfig)
+		if err != nil {
+			return "", fmt.Errorf("failed to download subtitle: %w", err)
+		}
+		data, err = io.ReadAll(reader)
+		if err != nil {
+			return "", fmt.Errorf("failed to read subtitle: %w", err)
+		}
+	}
+
+	srt, err := ConvertSubtitleToSRT(data, subtitle.Format)
+	if err != nil {
+		return "", err
+	}
+
+	filePath := filepath.Join(config.Env().DownloadsDirectory, fileName)
+	if err := os.WriteFile(filePath, srt, 0644); err != nil {
+		return "", fmt.Errorf("failed to write subtitle: %w", err)
+	}
+	return filePath, nil
+}
+
+// ConvertSubtitleToSRT converts a webvtt or ttml document to srt
+func ConvertSubtitleToSRT(data []byte, format enums.SubtitleFormat) ([]byte, error) {
+	var cues []*subtitleCue
+	var err error
+
+	switch format {
+	case enums.SubtitleFormatSRT:
+		return data, nil
+	case enums.SubtitleFormatWebVTT:
+		cues = parseWebVTT(data)
+	case enums.SubtitleFormatTTML:
+		cues, err = parseTTML(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ttml: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported subtitle format: %s", format)
+	}
+	if len(cues) == 0 {
+		return nil, errors.New("no cues found in subtitle")
+	}
+	zap.S().Debugf("converting %d subtitle cues to srt", len(cues))
+
+	var buf bytes.Buffer
+	for idx, cue := range cues {
+		fmt.Fprintf(
+			&buf, "%d\n%s --> %s\n%s\n\n",
+			idx+1,
+			formatSRTTimestamp(cue.start),
+			formatSRTTimestamp(cue.end),
+			cue.text,
+		)
+	}
+	return buf.Bytes(), nil
+}
+
+func parseWebVTT(data []byte) []*subtitleCue {
+	content := strings.ReplaceAll(string(data), "\r\n", "\n")
+	content = strings.TrimPrefix(content, "\ufeff")
+
+	var cues []*subtitleCue
+	seen := make(map[subtitleCue]bool)
+
+	// hls segments map their cues to the mpeg-ts timeline,
+	// cues are moved relative to the first segment
+	var offset time.Duration
+	baseMPEGTS := int64(-1)
+
+	for _, block := range strings.Split(content, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+
+		if strings.HasPrefix(lines[0], "WEBVTT") {
+			mpegts, local, ok := parseVTTTimestampMap(lines)
+			if ok {
+				if baseMPEGTS < 0 {
+					baseMPEGTS = mpegts
+				}
+				offset = mpegtsToDuration(mpegts-baseMPEGTS) - local
+			}
+			continue
+		}
+
+		// header, comment, style and region blocks have no timing
+		timingIdx := -1
+		for idx, line := range lines {
+			if strings.Contains(line, "-->") {
+				timingIdx = idx
+				break
+			}
+		}
+		if timingIdx == -1 || strings.HasPrefix(lines[0], "NOTE") {
+			continue
+		}
+
+		fields := strings.Fields(lines[timingIdx])
+		if len(fields) < 3 || fields[1] != "-->" {
+			continue
+		}
+		start, ok := parseVTTTimestamp(fields[0])
+		if !ok {
+			continue
+		}
+		end, ok := parseVTTTimestamp(fields[2])
+		if !ok {
+			continue
+		}
+
+		textLines := make([]string, 0, len(lines)-timingIdx-1)
+		for _, line := range lines[timingIdx+1:] {
+			line = strings.TrimSpace(vttTagRE.ReplaceAllStringFunc(line, convertVTTTag))
+			if line != "" {
+				textLines = append(textLines, unescapeVTT(line))
+			}
+		}
+		if len(textLines) == 0 {
+			continue
+		}
+
+		cue := subtitleCue{
+			start: max(start+offset, 0),
+			end:   max(end+offset, 0),
+			text:  strings.Join(textLines, "\n"),
+		}
+		// cues spanning several segments are repeated in each of them
+		if seen[cue] {
+			continue
+		}
+		seen[cue] = true
+		cues = append(cues, &cue)
+	}
+	return cues
+}
+
+func parseVTTTimestamp(value string) (time.Duration, bool) {
+	matches := vttTimestampRE.FindStringSubmatch(value)
+	if matches == nil {
+		return 0, false
+	}
+	hours, _ := strconv.Atoi(matches[1])
+	minutes, _ := strconv.Atoi(matches[2])
+	seconds, _ := strconv.Atoi(matches[3])
+	millis, _ := strconv.Atoi(matches[4])
+	return time.Duration(hours)*time.Hour +
+		time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second +
+		time.Duration(millis)*time.Millisecond, true
+}
+
+// parses the X-TIMESTAMP-MAP header of hls webvtt segments,
+// e.g. X-TIMESTAMP-MAP=MPEGTS:900000,LOCAL:00:00:00.000
+func parseVTTTimestampMap(header []string) (int64, time.Duration, bool) {
+	for _, line := range header {
+		value, found := strings.CutPrefix(line, "X-TIMESTAMP-MAP=")
+		if !found {
+			continue
+		}
+		var mpegts int64
+		var local time.Duration
+		for _, field := range strings.Split(value, ",") {
+			key, fieldValue, _ := strings.Cut(strings.TrimSpace(field), ":")
+			switch key {
+			case "MPEGTS":
+				mpegts, _ = strconv.ParseInt(fieldValue, 10, 64)
+			case "LOCAL":
+				local, _ = parseVTTTimestamp(fieldValue)
+			}
+		}
+		return mpegts, local, true
+	}
+	return 0, 0, false
+}
+
+// mpeg-ts timestamps use a 90khz clock
+func mpegtsToDuration(timestamp int64) time.Duration {
+	return time.Duration(float64(timestamp) / 90000 * float64(time.Second))
+}
+
+// keeps italic, bold and underline tags, which are
+// the only ones supported by srt, dropping their classes
+func convertVTTTag(tag string) string {
+	matches := vttTagRE.FindStringSubmatch(tag)
+	switch matches[2] {
+	case "i", "b", "u":
+		return "<" + matches[1] + matches[2] + ">"
+	}
+	return ""
+}
+
+func unescapeVTT(text string) string {
+	return strings.NewReplacer(
+		"&amp;", "&",
+		"&lt;", "<",
+		"&gt;", ">",
+		"&nbsp;", " ",
+		"&lrm;", "",
+		"&rlm;", "",
+	).Replace(text)
+}
+
+// timing parameters declared on the root element
+type ttmlTiming struct {
+	tickRate  float64
+	frameRate float64
+}
+
+func parseTTML(data []byte) ([]*subtitleCue, error) {
+	timing := &ttmlTiming{frameRate: 30}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var cues []*subtitleCue
+	var text strings.Builder
+	var cue *subtitleCue
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "tt":
+				for _, attr := range element.Attr {
+					value, _ := strconv.ParseFloat(attr.Value, 64)
+					switch {
+					case attr.Name.Local == "tickRate" && value > 0:
+						timing.tickRate = value
+					case attr.Name.Local == "frameRate" && value > 0:
+						timing.frameRate = value
+					}
+				}
+			case "p":
+				cue = parseTTMLCue(element, timing)
+				text.Reset()
+			case "br":
+				if cue != nil {
+					text.WriteString("\n")
+				}
+			}
+		case xml.CharData:
+			if cue != nil {
+				text.WriteString(whitespaceRE.ReplaceAllString(string(element), " "))
+			}
+		case xml.EndElement:
+			if element.Name.Local != "p" || cue == nil {
+				continue
+			}
+			lines := strings.Split(text.String(), "\n")
+			for idx, line := range lines {
+				lines[idx] = strings.TrimSpace(line)
+			}
+			cue.text = strings.TrimSpace(strings.Join(lines, "\n"))
+			if cue.text != "" && cue.end > cue.start {
+				cues = append(cues, cue)
+			}
+			cue = nil
+		}
+	}
+	return cues, nil
+}
+
+func parseTTMLCue(element xml.StartElement, timing *ttmlTiming) *subtitleCue {
+	cue := &subtitleCue{}
+	var duration time.Duration
+	for _, attr := range element.Attr {
+		switch attr.Name.Local {
+		case "begin":
+			cue.start = parseTTMLTime(attr.Value, timing)
+		case "end":
+			cue.end = parseTTMLTime(attr.Value, timing)
+		case "dur":
+			duration = parseTTMLTime(attr.Value, timing)
+		}
+	}
+	if cue.end == 0 && duration > 0 {
+		cue.end = cue.start + duration
+	}
+	return cue
+}
+
+// parses clock times (hh:mm:ss.fff, hh:mm:ss:ff)
+// and offset times (e.g. 1.5s, 1500ms, 15000000t)
+func parseTTMLTime(value string, timing *ttmlTiming) time.Duration {
+	value = strings.TrimSpace(value)
+	if matches := ttmlClockRE.FindStringSubmatch(value); matches != nil {
+		hours, _ := strconv.Atoi(matches[1])
+		minutes, _ := strconv.Atoi(matches[2])
+		seconds, _ := strconv.Atoi(matches[3])
+		total := time.Duration(hours)*time.Hour +
+			time.Duration(minutes)*time.Minute +
+			time.Duration(seconds)*time.Second
+		switch matches[4] {
+		case ".":
+			fraction, _ := strconv.ParseFloat("0."+matches[5], 64)
+			total += time.Duration(fraction * float64(time.Second))
+		case ":":
+			frames, _ := strconv.ParseFloat(matches[5], 64)
+			total += time.Duration(frames / timing.frameRate * float64(time.Second))
+		}
+		return total
+	}
+	if matches := ttmlOffsetRE.FindStringSubmatch(value); matches != nil {
+		amount, _ := strconv.ParseFloat(matches[1], 64)
+		switch matches[2] {
+		case "h":
+			return time.Duration(amount * float64(time.Hour))
+		case "m":
+			return time.Duration(amount * float64(time.Minute))
+		case "s":
+			return time.Duration(amount * float64(time.Second))
+		case "ms":
+			return time.Duration(amount * float64(time.Millisecond))
+		case "f":
+			return time.Duration(amount / timing.frameRate * float64(time.Second))
+		case "t":
+			if timing.tickRate > 0 {
+				return time.Duration(amount / timing.tickRate * float64(time.Second))
+			}
+			// without a tick rate, ticks are frames
+			return time.Duration(amount / timing.frameRate * float64(time.Second))
+		}
+	}
+	return 0
+}
+
+func formatSRTTimestamp(duration time.Duration) string {
+	millis := duration.Milliseconds()
+	return fmt.Sprintf(
+		"%02d:%02d:%02d,%03d",
+		millis/3600000,
+		millis/60000%60,
+		millis/1000%60,
+		millis%1000,
+	)
+}
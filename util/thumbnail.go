@@ -0,0 +1,60 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+)
+
+const (
+	// limits of telegram for thumbnails,
+	// larger ones are silently ignored
+	telegramThumbnailMaxDimension = 320
+	telegramThumbnailMaxSize      = 200 * 1024
+
+	thumbnailMaxQuality = 90
+	thumbnailMinQuality = 30
+)
+
+// SaveThumbnail saves the image as a jpeg thumbnail, downscaled
+// to fit in 320px and encoded at the highest quality that keeps
+// it under 200KB, as telegram requires
+func SaveThumbnail(img image.Image, outputPath string) error {
+	img = fitImage(img, telegramThumbnailMaxDimension)
+
+	var buf bytes.Buffer
+	for quality := thumbnailMaxQuality; ; quality -= 10 {
+		buf.Reset()
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+		if err != nil {
+			return fmt.Errorf("failed to encode thumbnail: %w", err)
+		}
+		if buf.Len() <= telegramThumbnailMaxSize || quality <= thumbnailMinQuality {
+			break
+		}
+	}
+	if err := os.WriteFile(outputPath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write thumbnail: %w", err)
+	}
+	return nil
+}
+
+// ImgToThumbnail decodes the image, of any supported
+// format, and saves it as a jpeg thumbnail
+func ImgToThumbnail(file io.ReadSeeker, outputPath string) error {
+	img, err := DecodeImage(file)
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+	if img == nil {
+		// jpeg images are not decoded by default
+		img, err = jpeg.Decode(file)
+		if err != nil {
+			return fmt.Errorf("failed to decode image: %w", err)
+		}
+	}
+	return SaveThumbnail(img, outputPath)
+}
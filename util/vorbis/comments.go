@@ -0,0 +1,161 @@
+package vorbis
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/govdbot/govd/models"
+
+	_ "image/jpeg" // register JPEG decoder
+	_ "image/png"  // register PNG decoder
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultVendor = "govd"
+	// front cover, as defined by the id3v2 apic frame
+	pictureTypeFrontCover = 3
+)
+
+var pngHeader = []byte{0x89, 0x50, 0x4E, 0x47}
+
+// returns the comments of the given tags, as KEY=value pairs.
+// the cover is only included when embedPicture is set,
+// as flac stores it in a separate metadata block
+func buildComments(tags *models.MediaTags, embedPicture bool) ([]string, error) {
+	var comments []string
+	fields := []struct {
+		key   string
+		value string
+	}{
+		{"TITLE", tags.Title},
+		{"ARTIST", tags.Artist},
+		{"COMMENT", tags.Comment},
+		{"URL", tags.SourceURL},
+	}
+	for _, field := range fields {
+		if field.value != "" {
+			comments = append(comments, field.key+"="+field.value)
+		}
+	}
+	if embedPicture && len(tags.Cover) > 0 {
+		picture, err := marshalPicture(tags.Cover)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(
+			comments,
+			"METADATA_BLOCK_PICTURE="+base64.StdEncoding.EncodeToString(picture),
+		)
+	}
+	return comments, nil
+}
+
+// keeps the existing comments whose field
+// is not set by the new ones
+func mergeComments(existing []string, comments []string) []string {
+	keys := make(map[string]bool, len(comments))
+	for _, comment := range comments {
+		keys[commentKey(comment)] = true
+	}
+	merged := make([]string, 0, len(existing)+len(comments))
+	for _, comment := range existing {
+		if !keys[commentKey(comment)] {
+			merged = append(merged, comment)
+		}
+	}
+	return append(merged, comments...)
+}
+
+// field names are case insensitive
+func commentKey(comment string) string {
+	key, _, _ := strings.Cut(comment, "=")
+	return strings.ToUpper(key)
+}
+
+// parses a comment header, without its packet magic.
+// returns the data following the comments, if any
+func parseComments(data []byte) (string, []string, []byte, error) {
+	vendor, data, err := readCommentString(data)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if len(data) < 4 {
+		return "", nil, nil, errors.New("truncated comment header")
+	}
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+
+	var comments []string
+	for range count {
+		var comment string
+		comment, data, err = readCommentString(data)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return vendor, comments, data, nil
+}
+
+func readCommentString(data []byte) (string, []byte, error) {
+	if len(data) < 4 {
+		return "", nil, errors.New("truncated comment header")
+	}
+	length := binary.LittleEndian.Uint32(data)
+	if uint64(length) > uint64(len(data)-4) {
+		return "", nil, errors.New("truncated comment header")
+	}
+	end := 4 + int(length)
+	return string(data[4:end]), data[end:], nil
+}
+
+// builds a comment header, without its packet magic
+func marshalComments(vendor string, comments []string) []byte {
+	var buf bytes.Buffer
+	writeCommentString(&buf, vendor)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(comments)))
+	for _, comment := range comments {
+		writeCommentString(&buf, comment)
+	}
+	return buf.Bytes()
+}
+
+func writeCommentString(buf *bytes.Buffer, value string) {
+	binary.Write(buf, binary.LittleEndian, uint32(len(value)))
+	buf.WriteString(value)
+}
+
+// builds a flac picture block, also used (base64 encoded)
+// by the METADATA_BLOCK_PICTURE comment of ogg streams
+func marshalPicture(cover []byte) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(cover))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cover: %w", err)
+	}
+	mimeType := "image/jpeg"
+	if bytes.HasPrefix(cover, pngHeader) {
+		mimeType = "image/png"
+	}
+	description := "Front Cover"
+
+	var buf bytes.Buffer
+	for _, value := range []any{
+		uint32(pictureTypeFrontCover),
+		uint32(len(mimeType)), []byte(mimeType),
+		uint32(len(description)), []byte(description),
+		uint32(config.Width),
+		uint32(config.Height),
+		uint32(24), // color depth
+		uint32(0),  // palette size, not indexed
+		uint32(len(cover)), cover,
+	} {
+		binary.Write(&buf, binary.BigEndian, value)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,147 @@
+package vorbis
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/govdbot/govd/models"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	flacBlockPadding       = 1
+	flacBlockVorbisComment = 4
+	flacBlockPicture       = 6
+
+	flacLastBlock      = 0x80
+	flacMaxBlockLength = 1<<24 - 1
+)
+
+var flacMagic = []byte("fLaC")
+
+type flacBlock struct {
+	blockType byte
+	data      []byte
+}
+
+// WriteFLACTags writes the tags into a flac file as vorbis
+// comments, with the cover as a picture block. existing
+// comments for other fields are kept, padding is dropped
+func WriteFLACTags(filePath string, tags *models.MediaTags) error {
+	input, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer input.Close()
+	reader := bufio.NewReader(input)
+
+	magic := make([]byte, len(flacMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil || !bytes.Equal(magic, flacMagic) {
+		return errors.New("not a flac file")
+	}
+
+	vendor := defaultVendor
+	var existing []string
+	var blocks []*flacBlock
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return fmt.Errorf("failed to read metadata block: %w", err)
+		}
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		block := &flacBlock{
+			blockType: header[0] &^ flacLastBlock,
+			data:      make([]byte, length),
+		}
+		if _, err := io.ReadFull(reader, block.data); err != nil {
+			return fmt.Errorf("failed to read metadata block: %w", err)
+		}
+
+		switch {
+		case block.blockType == flacBlockVorbisComment:
+			if blockVendor, comments, _, err := parseComments(block.data); err == nil {
+				vendor = blockVendor
+				existing = comments
+			}
+		case block.blockType == flacBlockPicture && len(tags.Cover) > 0:
+			// replaced by the new cover
+		case block.blockType == flacBlockPadding:
+		default:
+			blocks = append(blocks, block)
+		}
+		if header[0]&flacLastBlock != 0 {
+			break
+		}
+	}
+
+	comments, err := buildComments(tags, false)
+	if err != nil {
+		return err
+	}
+	blocks = append(blocks, &flacBlock{
+		blockType: flacBlockVorbisComment,
+		data:      marshalComments(vendor, mergeComments(existing, comments)),
+	})
+	if len(tags.Cover) > 0 {
+		picture, err := marshalPicture(tags.Cover)
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, &flacBlock{
+			blockType: flacBlockPicture,
+			data:      picture,
+		})
+	}
+
+	tempPath := filePath + ".temp"
+	output, err := os.Create(tempPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tempPath)
+
+	err = writeFLAC(output, blocks, reader)
+	output.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write tags: %w", err)
+	}
+	if err := os.Rename(tempPath, filePath); err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+	return nil
+}
+
+// writes the metadata blocks followed by the audio frames
+func writeFLAC(w io.Writer, blocks []*flacBlock, frames io.Reader) error {
+	if _, err := w.Write(flacMagic); err != nil {
+		return err
+	}
+	for idx, block := range blocks {
+		length := len(block.data)
+		if length > flacMaxBlockLength {
+			return errors.New("metadata block too large")
+		}
+		blockType := block.blockType
+		if idx == len(blocks)-1 {
+			blockType |= flacLastBlock
+		}
+		header := []byte{
+			blockType,
+			byte(length >> 16),
+			byte(length >> 8),
+			byte(length),
+		}
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := w.Write(block.data); err != nil {
+			return err
+		}
+	}
+	_, err := io.Copy(w, frames)
+	return err
+}
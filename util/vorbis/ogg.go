@@ -0,0 +1,297 @@
+package vorbis
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/govdbot/govd/models"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	oggHeaderSize  = 27
+	oggMaxSegments = 255
+	oggMaxLacing   = 255
+	oggContinued   = 0x01
+)
+
+var (
+	oggMagic = []byte("OggS")
+
+	opusHeadMagic   = []byte("OpusHead")
+	opusTagsMagic   = []byte("OpusTags")
+	vorbisHeadMagic = []byte("\x01vorbis")
+	vorbisTagsMagic = []byte("\x03vorbis")
+
+	// crc-32 with the 0x04c11db7 polynomial,
+	// no reflection and no final xor
+	oggCRCTable = func() (table [256]uint32) {
+		for idx := range table {
+			crc := uint32(idx) << 24
+			for range 8 {
+				if crc&0x80000000 != 0 {
+					crc = crc<<1 ^ 0x04c11db7
+				} else {
+					crc <<= 1
+				}
+			}
+			table[idx] = crc
+		}
+		return table
+	}()
+)
+
+type oggPage struct {
+	headerType byte
+	granule    uint64
+	serial     uint32
+	sequence   uint32
+	segments   []byte // lacing values
+	data       []byte
+}
+
+// WriteOggTags replaces the comment header of an ogg opus or vorbis
+// stream with the given tags, keeping the existing comments for other
+// fields. the cover is stored as a METADATA_BLOCK_PICTURE comment.
+// the header pages are rebuilt, and the following pages are
+// renumbered with their checksum recomputed
+func WriteOggTags(filePath string, tags *models.MediaTags) error {
+	input, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer input.Close()
+	reader := bufio.NewReader(input)
+
+	first, err := readOggPage(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read first page: %w", err)
+	}
+	// the identification header tells the codec, and
+	// how many header packets follow its page
+	var commentMagic []byte
+	var headerPackets int
+	switch {
+	case bytes.HasPrefix(first.data, opusHeadMagic):
+		commentMagic = opusTagsMagic
+		headerPackets = 1
+	case bytes.HasPrefix(first.data, vorbisHeadMagic):
+		// comment and setup headers
+		commentMagic = vorbisTagsMagic
+		headerPackets = 2
+	default:
+		return errors.New("unsupported ogg stream")
+	}
+
+	packets, pageCount, err := readOggPackets(reader, first.serial, headerPackets)
+	if err != nil {
+		return fmt.Errorf("failed to read header packets: %w", err)
+	}
+	if !bytes.HasPrefix(packets[0], commentMagic) {
+		return errors.New("comment header not found")
+	}
+	vendor, existing, rest, err := parseComments(packets[0][len(commentMagic):])
+	if err != nil {
+		return fmt.Errorf("failed to parse comment header: %w", err)
+	}
+	comments, err := buildComments(tags, true)
+	if err != nil {
+		return err
+	}
+
+	packet := bytes.Clone(commentMagic)
+	packet = append(packet, marshalComments(vendor, mergeComments(existing, comments))...)
+	if bytes.Equal(commentMagic, vorbisTagsMagic) {
+		// framing bit
+		packet = append(packet, 1)
+	} else if len(rest) > 0 && rest[0]&1 != 0 {
+		// binary data kept by opus encoders
+		packet = append(packet, rest...)
+	}
+	packets[0] = packet
+	pages := paginateOggPackets(first.serial, first.sequence+1, packets)
+
+	tempPath := filePath + ".temp"
+	output, err := os.Create(tempPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tempPath)
+
+	writer := bufio.NewWriter(output)
+	err = writeOggPages(
+		writer, reader,
+		append([]*oggPage{first}, pages...),
+		first.serial,
+		len(pages)-pageCount,
+	)
+	if err == nil {
+		err = writer.Flush()
+	}
+	output.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write tags: %w", err)
+	}
+	if err := os.Rename(tempPath, filePath); err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+	return nil
+}
+
+// reads the given number of packets of a logical stream,
+// which must end on a page boundary, as header packets do.
+// returns the packets and the number of pages read
+func readOggPackets(r io.Reader, serial uint32, count int) ([][]byte, int, error) {
+	var packets [][]byte
+	var packet []byte
+	var pageCount int
+	for len(packets) < count {
+		page, err := readOggPage(r)
+		if err != nil {
+			return nil, 0, err
+		}
+		if page.serial != serial {
+			return nil, 0, errors.New("multiplexed ogg streams are not supported")
+		}
+		pageCount++
+
+		var offset int
+		for _, lacing := range page.segments {
+			if len(packets) == count {
+				return nil, 0, errors.New("header packets do not end a page")
+			}
+			packet = append(packet, page.data[offset:offset+int(lacing)]...)
+			offset += int(lacing)
+			// otherwise the packet continues
+			if lacing < oggMaxLacing {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+	}
+	return packets, pageCount, nil
+}
+
+// splits packets into pages, starting a new page
+// for the first packet
+func paginateOggPackets(serial uint32, sequence uint32, packets [][]byte) []*oggPage {
+	var pages []*oggPage
+	page := &oggPage{serial: serial, sequence: sequence}
+	for _, packet := range packets {
+		var offset int
+		for continued := false; ; continued = true {
+			if len(page.segments) == oggMaxSegments {
+				pages = append(pages, page)
+				sequence++
+				page = &oggPage{serial: serial, sequence: sequence}
+				if continued {
+					page.headerType = oggContinued
+				}
+			}
+			// a packet ends with a lacing value lower than 255,
+			// zero when its size is a multiple of 255
+			lacing := min(len(packet)-offset, oggMaxLacing)
+			page.segments = append(page.segments, byte(lacing))
+			page.data = append(page.data, packet[offset:offset+lacing]...)
+			offset += lacing
+			if lacing < oggMaxLacing {
+				break
+			}
+		}
+	}
+	if len(page.segments) > 0 {
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// writes the header pages, then copies the remaining ones,
+// shifting the sequence number of the pages of the stream
+func writeOggPages(
+	w io.Writer,
+	r io.Reader,
+	headerPages []*oggPage,
+	serial uint32,
+	sequenceDelta int,
+) error {
+	for _, page := range headerPages {
+		if _, err := w.Write(page.marshal()); err != nil {
+			return err
+		}
+	}
+	if sequenceDelta == 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+	for {
+		page, err := readOggPage(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if page.serial == serial {
+			page.sequence = uint32(int64(page.sequence) + int64(sequenceDelta))
+		}
+		if _, err := w.Write(page.marshal()); err != nil {
+			return err
+		}
+	}
+}
+
+func readOggPage(r io.Reader) (*oggPage, error) {
+	header := make([]byte, oggHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:4], oggMagic) {
+		return nil, errors.New("invalid ogg page")
+	}
+	page := &oggPage{
+		headerType: header[5],
+		granule:    binary.LittleEndian.Uint64(header[6:]),
+		serial:     binary.LittleEndian.Uint32(header[14:]),
+		sequence:   binary.LittleEndian.Uint32(header[18:]),
+		segments:   make([]byte, header[26]),
+	}
+	if _, err := io.ReadFull(r, page.segments); err != nil {
+		return nil, err
+	}
+	var size int
+	for _, lacing := range page.segments {
+		size += int(lacing)
+	}
+	page.data = make([]byte, size)
+	if _, err := io.ReadFull(r, page.data); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (page *oggPage) marshal() []byte {
+	buf := make([]byte, oggHeaderSize, oggHeaderSize+len(page.segments)+len(page.data))
+	copy(buf, oggMagic)
+	buf[5] = page.headerType
+	binary.LittleEndian.PutUint64(buf[6:], page.granule)
+	binary.LittleEndian.PutUint32(buf[14:], page.serial)
+	binary.LittleEndian.PutUint32(buf[18:], page.sequence)
+	buf[26] = byte(len(page.segments))
+	buf = append(buf, page.segments...)
+	buf = append(buf, page.data...)
+	binary.LittleEndian.PutUint32(buf[22:], oggCRC(buf))
+	return buf
+}
+
+func oggCRC(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}